@@ -40,6 +40,13 @@ var (
 func main() {
 	// Disable prefix, we are invoked directly.
 	log.SetFlags(0)
+
+	// Subcommands don't start the web interface and handle their
+	// own flags.
+	if len(os.Args) > 1 && os.Args[1] == "tokens" {
+		os.Exit(tokensCommand(os.Args[2:]))
+	}
+
 	isTerminal := isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())
 
 	// Listen for interrupt and allow to cancel program early.
@@ -63,6 +70,7 @@ func main() {
 	version := flag.Bool("version", false, "print DSK version")
 	noColor := flag.Bool("no-color", false, "disables color output")
 	ffrontend := flag.String("frontend", "", "path to a frontend, to use instead of the built-in")
+	fdataDir := flag.String("data-dir", "", "path to a directory for persisting search indexes across restarts; by default indexes are kept in memory")
 	fallowOrigin := flag.String("allow-origin", "", "origins from which browsers can access the HTTP API; for multiple origins, use a comma as a separator, the wildcard * is supported; to allow all use *")
 	flag.Parse()
 
@@ -116,6 +124,15 @@ func main() {
 	}
 	log.Printf("Detected live path: %s", livePath)
 
+	var dataDir string
+	if *fdataDir != "" {
+		dataDir, err = filepath.Abs(*fdataDir)
+		if err != nil {
+			log.Fatal(red.Sprintf("Failed to use data directory: %s", err))
+		}
+		log.Printf("Persisting data in: %s", dataDir)
+	}
+
 	allowOrigins := strings.Split(*fallowOrigin, ",")
 	if len(allowOrigins) != 0 {
 		log.Print(yellow.Sprintf("Allowing access of the HTTP API from origins: %s", strings.Join(allowOrigins, ", ")))
@@ -125,6 +142,7 @@ func main() {
 		Version,
 		livePath,
 		*ffrontend,
+		dataDir,
 	)
 	ctx, cancel := context.WithCancel(context.Background())
 	app.Teardown.AddCancelFunc(cancel)
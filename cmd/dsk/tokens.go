@@ -0,0 +1,140 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rundsk/dsk/internal/author"
+	"github.com/rundsk/dsk/internal/bus"
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+	"github.com/rundsk/dsk/internal/meta"
+	"github.com/rundsk/dsk/internal/tokens"
+	"golang.org/x/text/unicode/norm"
+)
+
+// tokensCommand exports the design tokens of a DDT into a platform
+// format, without starting the web interface. Returns the exit code.
+//
+//   dsk tokens -format css [-node Colors] [-o tokens.css] [path]
+func tokensCommand(args []string) int {
+	fs := flag.NewFlagSet("tokens", flag.ExitOnError)
+
+	formats := make([]string, 0, len(tokens.ExportFormats))
+	for _, f := range tokens.ExportFormats {
+		formats = append(formats, f.Name)
+	}
+
+	format := fs.String("format", "css", fmt.Sprintf("export format, one of: %s", strings.Join(formats, ", ")))
+	node := fs.String("node", "", "export only the tokens of the node with this URL, i.e. Colors/Brand")
+	out := fs.String("o", "", "path to the output file, defaults to stdout")
+	fs.Parse(args)
+
+	if len(fs.Args()) > 1 {
+		log.Print("Too many arguments given, expecting exactly 0 or 1")
+		return 1
+	}
+
+	ok, f := tokens.ExportFormatByName(*format)
+	if !ok {
+		log.Printf("Unsupported format: %s", *format)
+		return 1
+	}
+
+	path := "."
+	if fs.Arg(0) != "" {
+		path = fs.Arg(0)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var cdb config.DB
+	ok, cf, err := config.FindFile(path)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	if ok {
+		cdb, err = config.NewFileDB(cf, norm.NFC.String(filepath.Base(path)))
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+	} else {
+		cdb = config.NewStaticDB(norm.NFC.String(filepath.Base(path)))
+	}
+	defer cdb.Close()
+
+	b, err := bus.NewBroker()
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer b.Close()
+
+	t, err := ddt.NewTree(path, cdb, author.NewNoopDB(), meta.NewNoopDB(), b)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	db, err := tokens.NewDB(t)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	ts := db.All()
+	if *node != "" {
+		ok, n, err := t.Get(*node)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if !ok {
+			log.Printf("No such node: %s", *node)
+			return 1
+		}
+		ts = db.ForNode(n.URL())
+	}
+
+	var w io.Writer
+	if *out == "" {
+		w = os.Stdout
+	} else {
+		o, err := os.Create(*out)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		defer o.Close()
+		w = o
+	}
+	bw := bufio.NewWriter(w)
+
+	if err := f.Export(bw, ts, cdb.Data().Tokens, "live"); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if err := bw.Flush(); err != nil {
+		log.Print(err)
+		return 1
+	}
+	if *out != "" {
+		log.Printf("Exported %d token/s to %s", len(ts), *out)
+	}
+	return 0
+}
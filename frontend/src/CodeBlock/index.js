@@ -85,6 +85,10 @@ function CodeBlock(props) {
       const nodes = codeRef.current.querySelectorAll('code');
 
       for (let i = 0; i < nodes.length; i++) {
+        // Skip code that has already been highlighted on the server.
+        if (nodes[i].querySelector('.chroma')) {
+          continue;
+        }
         hljs.highlightElement(nodes[i]);
       }
     }
@@ -55,6 +55,10 @@ function Doc(props) {
   const transforms = {
     Banner: props => <Banner {...props} />,
     CodeBlock: props => {
+      // Contents have already been highlighted and escaped on the server.
+      if (props['data-highlighted']) {
+        return <CodeBlock escaped {...props} />;
+      }
       // When using <CodeBlock> directly within documents, its contents aren't
       // automatically protected from interpration as HTML, when they processed
       // by the DocTransformer. Thus we expect users to wrap their literal code
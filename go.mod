@@ -9,8 +9,11 @@ module github.com/rundsk/dsk
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/Microsoft/go-winio v0.4.16 // indirect
 	github.com/RoaringBitmap/roaring v0.5.5 // indirect
+	github.com/alecthomas/chroma v0.10.0
+	github.com/andybalholm/brotli v1.0.4
 	github.com/blevesearch/bleve v1.0.14
 	github.com/coreos/go-semver v0.3.0
 	github.com/fatih/color v1.10.0
@@ -33,6 +36,7 @@ require (
 	github.com/tinylib/msgp v1.1.5 // indirect
 	github.com/willf/bitset v1.1.11 // indirect
 	github.com/xanzy/ssh-agent v0.3.0 // indirect
+	github.com/yuin/goldmark v1.4.13
 	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2 // indirect
 	golang.org/x/net v0.0.0-20210410081132-afb366fc7cd1
 	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
@@ -53,6 +57,7 @@ require (
 	github.com/blevesearch/zap/v14 v14.0.5 // indirect
 	github.com/blevesearch/zap/v15 v15.0.3 // indirect
 	github.com/couchbase/vellum v1.0.2 // indirect
+	github.com/dlclark/regexp2 v1.4.0 // indirect
 	github.com/emirpasic/gods v1.12.0 // indirect
 	github.com/gorilla/css v1.0.0 // indirect
 	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
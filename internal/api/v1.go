@@ -8,6 +8,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -85,6 +86,9 @@ type V1Node struct {
 	Prev        *V1RefNode      `json:"prev"`
 	Next        *V1RefNode      `json:"next"`
 
+	// Nodes whose documents are included by the node's documents.
+	Dependencies []*V1RefNode `json:"dependencies"`
+
 	// Deprecated, to be removed in APIv3, please use Assets:
 	Downloads []*V1NodeAsset `json:"downloads"`
 }
@@ -121,14 +125,33 @@ type V1NodeDoc struct {
 	Raw        string                `json:"raw"`
 	Components []*V1NodeDocComponent `json:"components"`
 	Toc        []*V1NodeDocTocEntry  `json:"toc"`
+	Errors     []*V1NodeDocError     `json:"errors"`
+	Warnings   []*V1NodeDocError     `json:"warnings"`
+}
+
+// V1NodeDocError is a problem found in a document, i.e. the usage of
+// an unknown component or an undefined template variable.
+type V1NodeDocError struct {
+	Component string `json:"component,omitempty"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	Message   string `json:"message"`
 }
 
 type V1NodeDocComponent struct {
-	Raw      string `json:"raw"`
-	Position int    `json:"position"`
+	Name     string                `json:"name"`
+	Props    map[string]string     `json:"props"`
+	Children []*V1NodeDocComponent `json:"children"`
+	Raw      string                `json:"raw"`
+	Level    int                   `json:"level"`
+	Position int                   `json:"position"`
+	Length   int                   `json:"length"`
+	Line     int                   `json:"line"`
+	Column   int                   `json:"column"`
 }
 
 type V1NodeDocTocEntry struct {
+	ID       string               `json:"id"`
 	Title    string               `json:"title"`
 	Level    int                  `json:"level"`
 	Children []*V1NodeDocTocEntry `json:"children"`
@@ -141,8 +164,28 @@ type V1NodeAsset struct {
 	Size     int64  `json:"size"`
 
 	// Optional, format dependent, fields.
-	Width  int `json:"width,omitempty"`
-	Height int `json:"height,omitempty"`
+	Width   int                `json:"width,omitempty"`
+	Height  int                `json:"height,omitempty"`
+	Preview string             `json:"preview,omitempty"`
+	Pages   []*V1NodeAssetPage `json:"pages,omitempty"`
+	Font    *V1NodeAssetFont   `json:"font,omitempty"`
+}
+
+// V1NodeAssetFont describes a font file.
+type V1NodeAssetFont struct {
+	Family        string   `json:"family"`
+	Subfamily     string   `json:"subfamily"`
+	Weight        int      `json:"weight"`
+	Italic        bool     `json:"italic"`
+	Version       string   `json:"version"`
+	License       string   `json:"license"`
+	UnicodeRanges []string `json:"unicode_ranges"`
+}
+
+// V1NodeAssetPage is a page inside a design file, i.e. a Sketch file.
+type V1NodeAssetPage struct {
+	Name      string   `json:"name"`
+	Artboards []string `json:"artboards"`
 }
 
 type V1SearchResults struct {
@@ -223,12 +266,33 @@ func parseTocChildren(h *ddt.TocEntry) *V1NodeDocTocEntry {
 	}
 
 	return &V1NodeDocTocEntry{
+		ID:       h.ID,
 		Title:    h.Title,
 		Level:    h.Level,
 		Children: children,
 	}
 }
 
+func parseComponentChildren(c *ddt.NodeDocComponent) *V1NodeDocComponent {
+	children := make([]*V1NodeDocComponent, 0, len(c.Children))
+
+	for _, cc := range c.Children {
+		children = append(children, parseComponentChildren(cc))
+	}
+
+	return &V1NodeDocComponent{
+		Name:     c.Name,
+		Props:    c.Props,
+		Children: children,
+		Raw:      c.Raw,
+		Level:    c.Level,
+		Position: c.Position,
+		Length:   c.Length,
+		Line:     c.Line,
+		Column:   c.Column,
+	}
+}
+
 func (api V1) NewNode(n *ddt.Node, s *plex.Source) (*V1Node, error) {
 	hash, err := n.CalculateHash()
 	if err != nil {
@@ -265,7 +329,7 @@ func (api V1) NewNode(n *ddt.Node, s *plex.Source) (*V1Node, error) {
 		return nil, err
 	}
 	for _, v := range nDocs {
-		html, err := v.HTML("/api/v1/tree", n.URL(), s.Tree.Get, s.Name)
+		rendered, err := v.Render("/api/v1/tree", n.URL(), s.Tree.Get, s.Name)
 		if err != nil {
 			return nil, err
 		}
@@ -277,24 +341,42 @@ func (api V1) NewNode(n *ddt.Node, s *plex.Source) (*V1Node, error) {
 		nComponents, _ := v.Components()
 		components := make([]*V1NodeDocComponent, 0, len(nComponents))
 		for _, n := range nComponents {
-			components = append(components, &V1NodeDocComponent{
-				Raw:      n.Raw,
-				Position: n.Position,
-			})
+			components = append(components, parseComponentChildren(n))
 		}
 
-		nToc, _ := v.Toc()
-		toc := make([]*V1NodeDocTocEntry, 0, len(nToc))
-		for _, n := range nToc {
+		toc := make([]*V1NodeDocTocEntry, 0, len(rendered.Toc))
+		for _, n := range rendered.Toc {
 			toc = append(toc, parseTocChildren(n))
 		}
 
+		nErrors, _ := v.ComponentErrors()
+		docErrors := make([]*V1NodeDocError, 0, len(nErrors))
+		for _, e := range nErrors {
+			docErrors = append(docErrors, &V1NodeDocError{
+				Component: e.Component,
+				Line:      e.Line,
+				Column:    e.Column,
+				Message:   e.Message,
+			})
+		}
+
+		docWarnings := make([]*V1NodeDocError, 0, len(rendered.Warnings))
+		for _, w := range rendered.Warnings {
+			docWarnings = append(docWarnings, &V1NodeDocError{
+				Line:    w.Line,
+				Column:  w.Column,
+				Message: w.Message,
+			})
+		}
+
 		docs = append(docs, &V1NodeDoc{
 			Title:      v.Title(),
-			HTML:       string(html[:]),
+			HTML:       string(rendered.HTML[:]),
 			Raw:        string(raw[:]),
 			Components: components,
 			Toc:        toc,
+			Errors:     docErrors,
+			Warnings:   docWarnings,
 		})
 	}
 
@@ -327,6 +409,14 @@ func (api V1) NewNode(n *ddt.Node, s *plex.Source) (*V1Node, error) {
 		})
 	}
 
+	nDependencies := n.Dependencies()
+	dependencies := make([]*V1RefNode, 0, len(nDependencies))
+	for _, n := range nDependencies {
+		dependencies = append(dependencies, &V1RefNode{
+			n.URL(), n.Title(),
+		})
+	}
+
 	var prev *V1RefNode
 	var next *V1RefNode
 	prevNode, nextNode, err := s.Tree.NeighborNodes(n)
@@ -363,6 +453,8 @@ func (api V1) NewNode(n *ddt.Node, s *plex.Source) (*V1Node, error) {
 		Next:        next,
 		Custom:      n.Custom(),
 
+		Dependencies: dependencies,
+
 		// Deprecated, to be removed in APIv3:
 		Downloads: assets,
 	}, nil
@@ -425,6 +517,46 @@ func (api V1) NewNodeAsset(a *ddt.NodeAsset) (*V1NodeAsset, error) {
 		return nil, err
 	}
 
+	// Sketch files, that we cannot read, should not prevent the
+	// node from being served, see fonts below.
+	var preview string
+	hasPreview, err := a.HasPreview()
+	if err != nil {
+		log.Printf("Failed to look up preview of %s: %s", a.Name(), err)
+	}
+	if hasPreview {
+		preview = a.URL + "?preview"
+	}
+
+	var pages []*V1NodeAssetPage
+	_, aPages, err := a.SketchPages()
+	if err != nil {
+		log.Printf("Failed to read pages of %s: %s", a.Name(), err)
+		aPages = nil
+	}
+	for _, p := range aPages {
+		pages = append(pages, &V1NodeAssetPage{p.Name, p.Artboards})
+	}
+
+	var font *V1NodeAssetFont
+	_, aFont, err := a.Font()
+	if err != nil {
+		// Font files come from many sources, a font we cannot read
+		// should not prevent the node from being served.
+		log.Print(err)
+	}
+	if aFont != nil {
+		font = &V1NodeAssetFont{
+			Family:        aFont.Family,
+			Subfamily:     aFont.Subfamily,
+			Weight:        aFont.Weight,
+			Italic:        aFont.Italic,
+			Version:       aFont.Version,
+			License:       aFont.License,
+			UnicodeRanges: aFont.UnicodeRanges,
+		}
+	}
+
 	return &V1NodeAsset{
 		URL:      a.URL,
 		Name:     a.Name(),
@@ -432,8 +564,11 @@ func (api V1) NewNodeAsset(a *ddt.NodeAsset) (*V1NodeAsset, error) {
 		Size:     size,
 
 		// Optional, these can be empty.
-		Width:  width,
-		Height: height,
+		Width:   width,
+		Height:  height,
+		Preview: preview,
+		Pages:   pages,
+		Font:    font,
 	}, nil
 }
 
@@ -633,6 +768,8 @@ func (api V1) NodeHandler(w http.ResponseWriter, r *http.Request) {
 //   /api/v1/tree/Button/foo.mp4&v={version}
 //   /api/v1/tree/Button/colors.json&v={version}
 //   /api/v1/tree/Button/colors.yaml&v={version}
+//   /api/v1/tree/Button/colors.csv&v={version}
+//   /api/v1/tree/Button/exploration.sketch?preview&v={version}
 func (api V1) NodeAssetHandler(w http.ResponseWriter, r *http.Request) {
 	wr := httputil.NewResponder(w, r, "application/octet-stream")
 	r.Body.Close()
@@ -667,6 +804,10 @@ func (api V1) NodeAssetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if ok {
+		if _, isPreview := r.URL.Query()["preview"]; isPreview {
+			api.serveNodeAssetPreview(wr, w, r, a)
+			return
+		}
 		http.ServeFile(w, r, a.Path)
 		return
 	}
@@ -694,6 +835,11 @@ func (api V1) NodeAssetHandler(w http.ResponseWriter, r *http.Request) {
 	// we serve the converted contents.
 	ok, content, err := a.As(filepath.Ext(path))
 	if err != nil {
+		var cerr *ddt.AssetConversionError
+		if errors.As(err, &cerr) {
+			wr.Error(httputil.ErrUnconvertibleAsset.With(cerr), err)
+			return
+		}
 		wr.Error(httputil.Err, err)
 		return
 	}
@@ -713,6 +859,29 @@ func (api V1) NodeAssetHandler(w http.ResponseWriter, r *http.Request) {
 	http.ServeContent(w, r, filepath.Base(path), modified, content)
 }
 
+// Serves the preview image embedded into a node asset.
+func (api V1) serveNodeAssetPreview(wr *httputil.Responder, w http.ResponseWriter, r *http.Request, a *ddt.NodeAsset) {
+	ok, content, err := a.Preview()
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	if !ok {
+		wr.Error(httputil.ErrNoSuchAsset, nil)
+		return
+	}
+
+	// The preview changes, when the original file changes.
+	modified, err := a.Modified()
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	// Using the name for content type detection.
+	http.ServeContent(w, r, a.Title()+".png", modified, content)
+}
+
 // Performs a search over the design defintions tree and returns
 // results in form of a flat list of URLs of matched nodes.
 //
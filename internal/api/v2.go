@@ -7,16 +7,29 @@
 package api
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/cors"
 	"github.com/rundsk/dsk/internal/bus"
+	"github.com/rundsk/dsk/internal/config"
 	"github.com/rundsk/dsk/internal/ddt"
 	"github.com/rundsk/dsk/internal/httputil"
 	"github.com/rundsk/dsk/internal/plex"
 	"github.com/rundsk/dsk/internal/search"
+	"github.com/rundsk/dsk/internal/tokens"
 )
 
 func NewV2(ss *plex.Sources, appVersion string, b *bus.Broker, allowOrigins []string) *V2 {
@@ -42,24 +55,109 @@ type V2 struct {
 }
 
 // V2FullSearchResults differs from V2FilterResults in some
-// important ways: The results may be paginated. FilterResults always
-// contains all found results in form of a list of node URLs.
+// important ways: Hits carry fragments of matching text and are
+// counted by facets. FilterResults contain just a list of node URLs.
+// Both are paginated, Next is the URL of the next page, if any.
 type V2FullSearchResults struct {
-	Hits  []*V2FullSearchHit `json:"hits"`
-	Total int                `json:"total"`
-	Took  int64              `json:"took"` // nanoseconds
+	Hits   []*V2FullSearchHit `json:"hits"`
+	Facets []*V2Facet         `json:"facets"`
+	Total  int                `json:"total"`
+	Took   int64              `json:"took"` // nanoseconds
+	Offset int                `json:"offset"`
+	Limit  int                `json:"limit"`
+	Next   string             `json:"next,omitempty"`
+
+	// Versions, that were requested but couldn't be searched, as
+	// they are still being prepared.
+	Skipped []string `json:"skipped,omitempty"`
 }
 
 type V2FullSearchHit struct {
 	V1RefNode
 	Description string   `json:"description"`
 	Fragments   []string `json:"fragments"`
+
+	// The version the hit was found in, when searching across versions.
+	Version string `json:"version,omitempty"`
+
+	// Assets, whose text matched.
+	Assets []*V2AssetHit `json:"assets,omitempty"`
+}
+
+// V2AssetHit points to an asset, whose text matched, fragment is the
+// matching part of its text.
+type V2AssetHit struct {
+	URL      string `json:"url"`
+	Name     string `json:"name"`
+	Fragment string `json:"fragment"`
+}
+
+// V2Facet counts the hits by the values of a field, i.e. by tag.
+type V2Facet struct {
+	Name    string          `json:"name"`
+	Values  []*V2FacetValue `json:"values"`
+	Missing int             `json:"missing"`
+}
+
+type V2FacetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
 }
 
 type V2FilterResults struct {
-	Nodes []*V1RefNode `json:"nodes"`
-	Total int          `json:"total"`
-	Took  int64        `json:"took"` // nanoseconds
+	Nodes  []*V1RefNode `json:"nodes"`
+	Total  int          `json:"total"`
+	Took   int64        `json:"took"` // nanoseconds
+	Offset int          `json:"offset"`
+	Limit  int          `json:"limit"`
+	Next   string       `json:"next,omitempty"`
+}
+
+// V2Suggestions are queries completing or correcting the query, that
+// is being typed.
+type V2Suggestions struct {
+	Completions []string `json:"completions"`
+	Corrections []string `json:"corrections"`
+	Took        int64    `json:"took"` // nanoseconds
+}
+
+type V2Tokens struct {
+	Tokens []*V2Token `json:"tokens"`
+	Total  int        `json:"total"`
+}
+
+type V2Token struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Value       interface{} `json:"value"`
+	Description string      `json:"description"`
+
+	// Name of the aliased token, if the token is an alias.
+	Alias string `json:"alias,omitempty"`
+
+	// Node and asset the token was defined in.
+	Node  *V1RefNode `json:"node"`
+	Asset string     `json:"asset"`
+
+	// Set when the token's value could not be resolved.
+	Error string `json:"error,omitempty"`
+}
+
+type V2Components struct {
+	Components []*V2Component `json:"components"`
+	Total      int            `json:"total"`
+}
+
+type V2Component struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+
+	// Allowed props, null allows any.
+	Props    []string `json:"props"`
+	Required []string `json:"required"`
+
+	// Names of allowed child components, null allows any.
+	Children []string `json:"children"`
 }
 
 // HTTPMux returns a HTTP mux that can be mounted onto a root mux.
@@ -71,14 +169,26 @@ func (api V2) HTTPMux() http.Handler {
 	mux.HandleFunc("/sources", api.v1.SourcesHandler)
 	mux.HandleFunc("/tree", api.v1.TreeHandler)
 	mux.HandleFunc("/tree/", func(w http.ResponseWriter, r *http.Request) {
-		if filepath.Ext(r.URL.Path) != "" {
+		if filepath.Base(r.URL.Path) == "fonts.css" {
+			api.NodeFontsHandler(w, r)
+		} else if filepath.Ext(r.URL.Path) == ".zip" {
+			api.NodeArchiveHandler(w, r)
+		} else if filepath.Ext(r.URL.Path) != "" {
 			api.v1.NodeAssetHandler(w, r)
 		} else {
 			api.v1.NodeHandler(w, r)
 		}
 	})
+	mux.HandleFunc("/highlight.css", api.HighlightCSSHandler)
+	mux.HandleFunc("/components", api.ComponentsHandler)
+	mux.HandleFunc("/tokens", api.TokensHandler)
+	for _, f := range tokens.ExportFormats {
+		mux.HandleFunc("/tokens"+f.Ext, api.TokensHandler)
+	}
+	mux.HandleFunc("/tokens/", api.NodeTokensHandler)
 	mux.HandleFunc("/filter", api.FilterHandler)
 	mux.HandleFunc("/search", api.SearchHandler)
+	mux.HandleFunc("/suggest", api.SuggestHandler)
 	mux.HandleFunc("/messages", api.v1.MessagesHandler)
 	mux.HandleFunc("/", api.v1.NotFoundHandler)
 
@@ -95,10 +205,15 @@ func (api V2) HTTPMux() http.Handler {
 	}).Handler(mux)
 }
 
-func (api V2) NewTreeSearchResults(hs []*search.FullSearchHit, total int, took time.Duration) *V2FullSearchResults {
+func (api V2) NewTreeSearchResults(hs []*search.FullSearchHit, fs []*search.Facet, total int, took time.Duration) *V2FullSearchResults {
 	hits := make([]*V2FullSearchHit, 0, len(hs))
 
 	for _, hit := range hs {
+		assets := make([]*V2AssetHit, 0, len(hit.Assets))
+		for _, a := range hit.Assets {
+			assets = append(assets, &V2AssetHit{a.Asset.URL, a.Asset.Name(), a.Fragment})
+		}
+
 		hits = append(hits, &V2FullSearchHit{
 			V1RefNode: V1RefNode{
 				hit.Node.URL(),
@@ -106,9 +221,19 @@ func (api V2) NewTreeSearchResults(hs []*search.FullSearchHit, total int, took t
 			},
 			Description: hit.Node.Description(),
 			Fragments:   hit.Fragments,
+			Assets:      assets,
 		})
 	}
-	return &V2FullSearchResults{hits, total, took.Nanoseconds()}
+
+	facets := make([]*V2Facet, 0, len(fs))
+	for _, f := range fs {
+		values := make([]*V2FacetValue, 0, len(f.Values))
+		for _, v := range f.Values {
+			values = append(values, &V2FacetValue{v.Value, v.Count})
+		}
+		facets = append(facets, &V2Facet{f.Name, values, f.Missing})
+	}
+	return &V2FullSearchResults{Hits: hits, Facets: facets, Total: total, Took: took.Nanoseconds()}
 }
 
 func (api V2) NewTreeFilterResults(nodes []*ddt.Node, total int, took time.Duration) *V2FilterResults {
@@ -116,14 +241,486 @@ func (api V2) NewTreeFilterResults(nodes []*ddt.Node, total int, took time.Durat
 	for _, n := range nodes {
 		ns = append(ns, &V1RefNode{n.URL(), n.Title()})
 	}
-	return &V2FilterResults{ns, total, took.Nanoseconds()}
+	return &V2FilterResults{Nodes: ns, Total: total, Took: took.Nanoseconds()}
+}
+
+func (api V2) NewTokens(ts []*tokens.Token) *V2Tokens {
+	vts := make([]*V2Token, 0, len(ts))
+
+	for _, t := range ts {
+		vt := &V2Token{
+			Name:        t.Name,
+			Type:        t.Type,
+			Value:       t.Value,
+			Description: t.Description,
+			Alias:       t.Alias(),
+			Node:        &V1RefNode{t.Node.URL(), t.Node.Title()},
+			Asset:       t.Asset.Name(),
+		}
+		if t.Error != nil {
+			vt.Error = t.Error.Error()
+		}
+		vts = append(vts, vt)
+	}
+	return &V2Tokens{vts, len(vts)}
+}
+
+func (api V2) NewComponents(r *ddt.ComponentRegistry) *V2Components {
+	all := r.All()
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cs := make([]*V2Component, 0, len(names))
+	for _, name := range names {
+		c := all[name]
+
+		required := c.Required
+		if required == nil {
+			required = make([]string, 0)
+		}
+		cs = append(cs, &V2Component{
+			Name:        name,
+			Description: c.Description,
+			Props:       c.Props,
+			Required:    required,
+			Children:    c.Children,
+		})
+	}
+	return &V2Components{cs, len(cs)}
+}
+
+// Returns the documentation components declared in the configuration
+// or the components file, including their props and allowed
+// children.
+//
+// Handles these URLs:
+//   /api/v2/components
+//   /api/v2/components?v={version}
+func (api V2) ComponentsHandler(w http.ResponseWriter, r *http.Request) {
+	wr := httputil.NewResponder(w, r, "application/json")
+	r.Body.Close()
+
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	registry := s.Tree.Components
+
+	if wr.Cached(registry.CalculateHash) {
+		return
+	}
+	wr.Cache(registry.CalculateHash)
+	wr.OK(api.NewComponents(registry))
+}
+
+// Returns the stylesheet for code highlighted on the server side,
+// using the configured style.
+//
+// Handles these URLs:
+//   /api/v2/highlight.css
+//   /api/v2/highlight.css?v={version}
+func (api V2) HighlightCSSHandler(w http.ResponseWriter, r *http.Request) {
+	wr := httputil.NewResponder(w, r, "text/css; charset=utf-8")
+	r.Body.Close()
+
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	var style string
+	if c := s.ConfigDB.Data().Highlight; c != nil {
+		style = c.Style
+	}
+	if style == "" {
+		style = ddt.DefaultHighlightStyle
+	}
+	// The generated stylesheet only changes with the style or
+	// when we upgrade the highlighter.
+	hash := func() (string, error) {
+		return style + "@" + api.v1.appVersion, nil
+	}
+	if wr.Cached(hash) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := ddt.HighlightCSS(&buf, style); err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	wr.Cache(hash)
+	wr.OK(buf.Bytes())
+}
+
+// Returns all design tokens found in the design definitions tree. When
+// the URL has an extension, the tokens are exported in the
+// corresponding platform format.
+//
+// Handles these URLs:
+//   /api/v2/tokens
+//   /api/v2/tokens?v={version}
+//   /api/v2/tokens.css?v={version}
+//   /api/v2/tokens.xml?v={version}
+func (api V2) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body.Close()
+
+	ext := filepath.Ext(r.URL.Path)
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
+	if err != nil {
+		httputil.NewResponder(w, r, "application/json").Error(httputil.Err, err)
+		return
+	}
+	api.respondTokens(w, r, s, s.Tokens.All(), ext)
+}
+
+// Returns the design tokens defined in a single node. When the URL
+// has an extension, the tokens are exported in the corresponding
+// platform format.
+//
+// Handles these kinds of URLs:
+//   /api/v2/tokens/Colors?v={version}
+//   /api/v2/tokens/Colors.scss?v={version}
+func (api V2) NodeTokensHandler(w http.ResponseWriter, r *http.Request) {
+	wr := httputil.NewResponder(w, r, "application/json")
+	r.Body.Close()
+
+	path := r.URL.Path[len("/tokens/"):]
+	ext := filepath.Ext(path)
+	path = strings.TrimSuffix(path, ext)
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	if err := httputil.CheckSafePath(path, s.Tree.Path); err != nil {
+		wr.Error(httputil.ErrUnsafePath, err)
+		return
+	}
+
+	ok, n, err := s.Tree.Get(path)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	if !ok {
+		wr.Error(httputil.ErrNoSuchNode, nil)
+		return
+	}
+	api.respondTokens(w, r, s, s.Tokens.ForNode(n.URL()), ext)
+}
+
+// respondTokens responds with the given tokens, exported into the
+// format identified by ext. When ext is empty, responds with JSON.
+func (api V2) respondTokens(w http.ResponseWriter, r *http.Request, s *plex.Source, ts []*tokens.Token, ext string) {
+	// Tokens may reference tokens from other nodes, so we must use
+	// the tree hash for caching. Exports depend on the format and
+	// its configuration, too.
+	hash := func() (string, error) {
+		th, err := s.Tree.CalculateHash()
+		if err != nil {
+			return "", err
+		}
+		return tokensHash(th, ext, s.Name, s.ConfigDB.Data().Tokens)
+	}
+
+	if ext == "" {
+		wr := httputil.NewResponder(w, r, "application/json")
+
+		if wr.Cached(hash) {
+			return
+		}
+		wr.Cache(hash)
+		wr.OK(api.NewTokens(ts))
+		return
+	}
+
+	ok, f := tokens.ExportFormatByExt(ext)
+	if !ok {
+		httputil.NewResponder(w, r, "application/json").Error(httputil.ErrNotFound, nil)
+		return
+	}
+	wr := httputil.NewResponder(w, r, f.ContentType)
+
+	if wr.Cached(hash) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := f.Export(&buf, ts, s.ConfigDB.Data().Tokens, s.Name); err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	wr.Cache(hash)
+	wr.OK(buf.Bytes())
+}
+
+// tokensHash calculates the hash of exported tokens, from the hash of
+// the tree they were found in and everything an export depends on.
+func tokensHash(treeHash string, ext string, version string, c *config.TokensConfig) (string, error) {
+	j, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	fmt.Fprintf(h, "%s:%s:%s:%s", treeHash, ext, version, j)
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// Streams a ZIP archive of a node's assets. Use the "recursive"
+// parameter to include the assets of all descendant nodes, and the
+// "docs" parameter to include documents, too. A ZIP asset with the
+// same name takes precedence.
+//
+// Handles these URLs:
+//   /api/v2/tree/Icons.zip
+//   /api/v2/tree/Icons.zip?v={version}
+//   /api/v2/tree/Icons.zip?recursive=1&docs=1&v={version}
+func (api V2) NodeArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	wr := httputil.NewResponder(w, r, "application/zip")
+	r.Body.Close()
+
+	path := r.URL.Path[len("/tree/"):]
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	if err := httputil.CheckSafePath(path, s.Tree.Path); err != nil {
+		wr.Error(httputil.ErrUnsafePath, err)
+		return
+	}
+
+	ok, pn, err := s.Tree.Get(filepath.Dir(path))
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	if ok {
+		ok, _, err = pn.Asset(filepath.Base(path))
+		if err != nil {
+			wr.Error(httputil.Err, err)
+			return
+		}
+		if ok {
+			api.v1.NodeAssetHandler(w, r)
+			return
+		}
+	}
+
+	ok, n, err := s.Tree.Get(strings.TrimSuffix(path, ".zip"))
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	if !ok {
+		wr.Error(httputil.ErrNoSuchNode, nil)
+		return
+	}
+
+	recursive, _ := strconv.ParseBool(r.URL.Query().Get("recursive"))
+	docs, _ := strconv.ParseBool(r.URL.Query().Get("docs"))
+	o := ddt.ArchiveOptions{Recursive: recursive, Docs: docs}
+
+	hash := func() (string, error) {
+		return n.ArchiveHash(o)
+	}
+	if wr.Cached(hash) {
+		return
+	}
+	wr.Cache(hash)
+
+	// We cannot use the responder for the response body, as the
+	// archive is streamed. Once streaming has started, we can only
+	// log errors.
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", n.Name()+".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	if err := n.WriteArchive(w, o); err != nil {
+		log.Printf("Failed to stream archive for node %s: %s", n.URL(), err)
+	}
+}
+
+// Returns a stylesheet with @font-face rules for all fonts found in
+// a node's assets. Fonts are grouped by family, weight and style, so
+// that the different formats of the same font end up in a single
+// rule. A fonts.css asset, when present, takes precedence.
+//
+// Handles these URLs:
+//   /api/v2/tree/Typography/fonts.css
+//   /api/v2/tree/Typography/fonts.css?v={version}
+func (api V2) NodeFontsHandler(w http.ResponseWriter, r *http.Request) {
+	wr := httputil.NewResponder(w, r, "text/css; charset=utf-8")
+	r.Body.Close()
+
+	path := r.URL.Path[len("/tree/"):]
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	if err := httputil.CheckSafePath(path, s.Tree.Path); err != nil {
+		wr.Error(httputil.ErrUnsafePath, err)
+		return
+	}
+
+	ok, n, err := s.Tree.Get(filepath.Dir(path))
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	if !ok {
+		wr.Error(httputil.ErrNoSuchNode, nil)
+		return
+	}
+
+	ok, _, err = n.Asset(filepath.Base(path))
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	if ok {
+		api.v1.NodeAssetHandler(w, r)
+		return
+	}
+
+	if wr.Cached(n.CalculateHash) {
+		return
+	}
+
+	as, err := n.Assets()
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeFontFaces(&buf, as, v); err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	wr.Cache(n.CalculateHash)
+	wr.OK(buf.Bytes())
+}
+
+// writeFontFaces writes @font-face rules for the font assets in as.
+// Asset URLs carry the given version, if any.
+func writeFontFaces(w io.Writer, as []*ddt.NodeAsset, v string) error {
+	type fontSrc struct {
+		url    string
+		format string
+	}
+	type fontFace struct {
+		font *ddt.Font
+		srcs []fontSrc
+	}
+	// Prefer the most compact formats, browsers use the first
+	// source they support.
+	formatOrder := map[string]int{
+		"woff2":    0,
+		"woff":     1,
+		"opentype": 2,
+		"truetype": 3,
+	}
+
+	faces := make([]*fontFace, 0)
+	byKey := make(map[string]*fontFace)
+
+	for _, a := range as {
+		ok, f, err := a.Font()
+		if err != nil {
+			// A font we cannot read should not prevent the other
+			// fonts from being served.
+			log.Print(err)
+			continue
+		}
+		if !ok || f.Family == "" {
+			continue
+		}
+		u := "/api/v2/tree/" + a.URL
+		if v != "" {
+			u += "?v=" + url.QueryEscape(v)
+		}
+
+		key := fmt.Sprintf("%s|%d|%s", f.Family, f.Weight, f.Style())
+		face, ok := byKey[key]
+		if !ok {
+			face = &fontFace{font: f}
+			byKey[key] = face
+			faces = append(faces, face)
+		}
+		face.srcs = append(face.srcs, fontSrc{u, f.Format})
+	}
+
+	for _, face := range faces {
+		sort.SliceStable(face.srcs, func(i, j int) bool {
+			return formatOrder[face.srcs[i].format] < formatOrder[face.srcs[j].format]
+		})
+		srcs := make([]string, 0, len(face.srcs))
+		for _, src := range face.srcs {
+			srcs = append(srcs, fmt.Sprintf("url(%q) format(%q)", src.url, src.format))
+		}
+
+		fmt.Fprint(w, "@font-face {\n")
+		fmt.Fprintf(w, "  font-family: %q;\n", face.font.Family)
+		fmt.Fprintf(w, "  font-style: %s;\n", face.font.Style())
+		if face.font.Weight != 0 {
+			fmt.Fprintf(w, "  font-weight: %d;\n", face.font.Weight)
+		}
+		fmt.Fprintf(w, "  src: %s;\n", strings.Join(srcs, ",\n       "))
+		if len(face.font.UnicodeRanges) > 0 {
+			fmt.Fprintf(w, "  unicode-range: %s;\n", strings.Join(face.font.UnicodeRanges, ", "))
+		}
+		if _, err := fmt.Fprint(w, "}\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Performs a full broad search over the design defintions tree.
 //
+// The query may narrow results using fields, i.e. "tag:forms",
+// "author:jane@example.org", "version:2.x", "custom.platform:web" or
+// "under:DataEntry". Clauses are negated with a leading "-" and
+// phrases are quoted.
+//
+// Results are counted by facets, i.e. by "tag", "author", "section"
+// or "asset". Values of facets are selected using parameters named
+// after the facet, i.e. "tag=forms&tag=navigation".
+//
+// Multiple versions are searched at once, when given as a comma
+// separated list or as "*" for all versions.
+//
 // Handles these URLs:
 //   /api/v2/search?q={query}
 //   /api/v2/search?q={query}&v={version}
+//   /api/v2/search?q={query}&v={version},{version}
+//   /api/v2/search?q={query}&v=*
+//   /api/v2/search?q={query}&{facet}={value}
+//   /api/v2/search?q={query}&offset={offset}&limit={limit}
 func (api V2) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	wr := httputil.NewResponder(w, r, "application/json")
 	r.Body.Close()
@@ -131,19 +728,180 @@ func (api V2) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query().Get("q")
 	v := r.URL.Query().Get("v")
 
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		wr.Error(httputil.ErrInvalidQuery.With(err), err)
+		return
+	}
+
+	if v == "*" || strings.Contains(v, ",") {
+		api.searchVersions(wr, r, q, v, offset, limit)
+		return
+	}
+
 	s, err := api.sources.MustGet(v)
 	if err != nil {
 		wr.Error(httputil.Err, err)
 		return
 	}
+	limit = s.Search.Limits().SearchLimit(limit)
+	selected := selectedFacets(r, s.Search)
+
+	results, facets, total, took, _, err := s.Search.FacetedFullSearch(q, selected, offset, limit)
+	if err != nil {
+		var qerr *search.QueryError
+		if errors.As(err, &qerr) {
+			wr.Error(httputil.ErrInvalidQuery.With(qerr), err)
+			return
+		}
+		wr.Error(httputil.Err, err)
+		return
+	}
+
+	res := api.NewTreeSearchResults(results, facets, total, took)
+	res.Offset = offset
+	res.Limit = limit
+	res.Next = nextPage("/api/v2/search", r, offset, limit, total)
+	wr.OK(res)
+}
+
+// searchVersions performs a full search across the given versions.
+// Versions, which are not yet complete, are skipped instead of
+// waiting for them. When all are skipped, there is nothing to search.
+//
+// Paging through the hits of all versions is costly, the offset is
+// limited, see search.MaxMultiSearchOffset.
+func (api V2) searchVersions(wr *httputil.Responder, r *http.Request, q string, v string, offset int, limit int) {
+	if offset > search.MaxMultiSearchOffset {
+		err := fmt.Errorf("offset must not exceed %d, when searching across versions", search.MaxMultiSearchOffset)
+		wr.Error(httputil.ErrInvalidQuery.With(err), err)
+		return
+	}
+	whitelisted := api.sources.WhitelistedNames()
+
+	var names []string
+	if v == "*" {
+		names = whitelisted
+	} else {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+
+			if !isWhitelisted(whitelisted, name) {
+				err := fmt.Errorf("no such version: %s", name)
+				wr.Error(httputil.ErrInvalidQuery.With(err), err)
+				return
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	searches := make(map[string]*search.Search)
+	skipped := make([]string, 0)
+
+	var selected map[string][]string
+	for _, name := range names {
+		_, s, err := api.sources.Get(name)
+		if err != nil {
+			wr.Error(httputil.Err, err)
+			return
+		}
+		if !s.IsComplete() || s.Search == nil {
+			skipped = append(skipped, name)
+			continue
+		}
+		searches[name] = s.Search
+
+		// All versions share the same configuration.
+		if selected == nil {
+			limit = s.Search.Limits().SearchLimit(limit)
+			selected = selectedFacets(r, s.Search)
+		}
+	}
+	if len(searches) == 0 {
+		err := fmt.Errorf("none of the versions can be searched yet: %s", strings.Join(skipped, ", "))
+		wr.Error(httputil.ErrNoSuchVersion.With(err), err)
+		return
+	}
+
+	results, facets, total, took, err := search.MultiFullSearch(searches, q, selected, offset, limit)
+	if err != nil {
+		var qerr *search.QueryError
+		if errors.As(err, &qerr) {
+			wr.Error(httputil.ErrInvalidQuery.With(qerr), err)
+			return
+		}
+		wr.Error(httputil.Err, err)
+		return
+	}
 
-	results, total, took, _, err := s.Search.FullSearch(q)
+	hits := make([]*search.FullSearchHit, 0, len(results))
+	for _, result := range results {
+		hits = append(hits, result.FullSearchHit)
+	}
+	res := api.NewTreeSearchResults(hits, facets, total, took)
+	for i, result := range results {
+		res.Hits[i].Version = result.Name
+	}
+	res.Offset = offset
+	res.Limit = limit
+	if offset+limit <= search.MaxMultiSearchOffset {
+		res.Next = nextPage("/api/v2/search", r, offset, limit, total)
+	}
+	res.Skipped = skipped
+	wr.OK(res)
+}
+
+// selectedFacets returns the facet values selected by the request,
+// keyed by facet name.
+func selectedFacets(r *http.Request, s *search.Search) map[string][]string {
+	selected := make(map[string][]string)
+	for _, f := range s.Facets() {
+		if vs, ok := r.URL.Query()[f]; ok {
+			selected[f] = vs
+		}
+	}
+	return selected
+}
+
+func isWhitelisted(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggests completions and corrections for a query, while it is being
+// typed. Suggestions are cheap and can be requested on every keystroke.
+//
+// Handles these URLs:
+//   /api/v2/suggest?q={query}
+//   /api/v2/suggest?q={query}&v={version}
+func (api V2) SuggestHandler(w http.ResponseWriter, r *http.Request) {
+	wr := httputil.NewResponder(w, r, "application/json")
+	r.Body.Close()
+
+	q := r.URL.Query().Get("q")
+	v := r.URL.Query().Get("v")
+
+	s, err := api.sources.MustGet(v)
 	if err != nil {
 		wr.Error(httputil.Err, err)
 		return
 	}
 
-	wr.OK(api.NewTreeSearchResults(results, total, took))
+	suggestions, took, err := s.Search.Suggest(q)
+	if err != nil {
+		wr.Error(httputil.Err, err)
+		return
+	}
+	wr.OK(&V2Suggestions{
+		Completions: suggestions.Completions,
+		Corrections: suggestions.Corrections,
+		Took:        took.Nanoseconds(),
+	})
 }
 
 // Performs a restricted narrow search over the design defintions tree.
@@ -151,6 +909,7 @@ func (api V2) SearchHandler(w http.ResponseWriter, r *http.Request) {
 // Handles these URLs:
 //   /api/v2/filter?q={query}
 //   /api/v2/filter?q={query}&v={version}
+//   /api/v2/filter?q={query}&offset={offset}&limit={limit}
 func (api V2) FilterHandler(w http.ResponseWriter, r *http.Request) {
 	wr := httputil.NewResponder(w, r, "application/json")
 	r.Body.Close()
@@ -158,17 +917,62 @@ func (api V2) FilterHandler(w http.ResponseWriter, r *http.Request) {
 	q := r.URL.Query().Get("q")
 	v := r.URL.Query().Get("v")
 
+	offset, limit, err := pageParams(r)
+	if err != nil {
+		wr.Error(httputil.ErrInvalidQuery.With(err), err)
+		return
+	}
+
 	s, err := api.sources.MustGet(v)
 	if err != nil {
 		wr.Error(httputil.Err, err)
 		return
 	}
+	limit = s.Search.Limits().FilterLimit(limit)
 
-	results, total, took, _, err := s.Search.FilterSearch(q)
+	results, total, took, _, err := s.Search.FilterSearch(q, offset, limit)
 	if err != nil {
 		wr.Error(httputil.Err, err)
 		return
 	}
 
-	wr.OK(api.NewTreeFilterResults(results, total, took))
+	res := api.NewTreeFilterResults(results, total, took)
+	res.Offset = offset
+	res.Limit = limit
+	res.Next = nextPage("/api/v2/filter", r, offset, limit, total)
+	wr.OK(res)
+}
+
+// pageParams parses the optional offset and limit parameters of the
+// request. A limit of zero selects the default limit.
+func pageParams(r *http.Request) (int, int, error) {
+	var offset, limit int
+	var err error
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative integer: %s", v)
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("limit must be a positive integer: %s", v)
+		}
+	}
+	return offset, limit, nil
+}
+
+// nextPage returns the URL of the page following the current one,
+// keeping all other parameters. Returns an empty string, when the
+// current page is the last one.
+func nextPage(path string, r *http.Request, offset int, limit int, total int) string {
+	if offset+limit >= total {
+		return ""
+	}
+	q := r.URL.Query()
+	q.Set("offset", strconv.Itoa(offset+limit))
+	q.Set("limit", strconv.Itoa(limit))
+	return path + "?" + q.Encode()
 }
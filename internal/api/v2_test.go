@@ -0,0 +1,94 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+	"github.com/rundsk/dsk/internal/plex"
+)
+
+func TestSearchVersionsNoneSearchable(t *testing.T) {
+	ss, err := plex.NewSources(config.NewStaticDB("Example"), "")
+	if err != nil {
+		t.Fatalf("Failed to initialize sources: %s", err)
+	}
+	defer ss.Close()
+
+	// Never completed, so it has not been indexed yet.
+	if _, err := ss.AddLazy("live", nil); err != nil {
+		t.Fatalf("Failed to add source: %s", err)
+	}
+	api := NewV2(ss, "test", nil, nil)
+
+	for _, v := range []string{"*", "live,live"} {
+		r := httptest.NewRequest("GET", "/api/v2/search?q=button&v="+v, nil)
+		w := httptest.NewRecorder()
+		api.SearchHandler(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for v=%s, got: %d %s", http.StatusNotFound, v, w.Code, w.Body)
+		}
+	}
+}
+
+func TestTokensHash(t *testing.T) {
+	c := &config.TokensConfig{RemBase: 16}
+
+	h, _ := tokensHash("abc", ".css", "live", c)
+	if other, _ := tokensHash("abc", ".scss", "live", c); other == h {
+		t.Errorf("Expected hash to change with the format")
+	}
+
+	c.Formats = map[string]*config.TokensFormatConfig{"css": {Unit: "rem"}}
+	if other, _ := tokensHash("abc", ".css", "live", c); other == h {
+		t.Errorf("Expected hash to change with the configuration")
+	}
+}
+
+func TestWriteFontFacesSkipsUnreadable(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "Broken.ttf")
+	ioutil.WriteFile(path, []byte("ttcf00000000"), 0644)
+
+	var buf bytes.Buffer
+	if err := writeFontFaces(&buf, []*ddt.NodeAsset{ddt.NewNodeAsset(path, "Fonts/Broken.ttf", nil)}, ""); err != nil {
+		t.Errorf("Expected unreadable font to be skipped, got: %s", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no font faces, got: %s", buf.String())
+	}
+}
+
+func TestPageParams(t *testing.T) {
+	expected := map[string]string{
+		"offset=abc": "offset must be a non-negative integer: abc",
+		"offset=-1":  "offset must be a non-negative integer: -1",
+		"limit=abc":  "limit must be a positive integer: abc",
+		"limit=0":    "limit must be a positive integer: 0",
+	}
+	for q, e := range expected {
+		_, _, err := pageParams(httptest.NewRequest("GET", "/api/v2/search?"+q, nil))
+		if err == nil || err.Error() != e {
+			t.Errorf("expected error '%s' for %s, got: %v", e, q, err)
+		}
+	}
+
+	offset, limit, err := pageParams(httptest.NewRequest("GET", "/api/v2/search?offset=20&limit=10", nil))
+	if err != nil || offset != 20 || limit != 10 {
+		t.Errorf("failed to parse page parameters, got: %d, %d, %v", offset, limit, err)
+	}
+}
@@ -23,6 +23,11 @@ type Message struct {
 	ID    int
 	Topic string
 	Text  string
+
+	// Payload is optionally provided to subscribers inside the
+	// process, it is neither passed on to connected brokers nor to
+	// clients.
+	Payload interface{}
 }
 
 func (m *Message) String() string {
@@ -35,6 +35,29 @@ type Config struct {
 	// Configuration related to figma.com.
 	Figma *FigmaConfig `json:"figma,omitempty" yaml:"figma,omitempty"`
 
+	// Configuration for exporting design tokens into platform formats.
+	Tokens *TokensConfig `json:"tokens,omitempty" yaml:"tokens,omitempty"`
+
+	// Configuration for rendering Markdown documents.
+	Markdown *MarkdownConfig `json:"markdown,omitempty" yaml:"markdown,omitempty"`
+
+	// Configuration for server-side syntax highlighting of code in documents.
+	Highlight *HighlightConfig `json:"highlight,omitempty" yaml:"highlight,omitempty"`
+
+	// Configuration for embedding code snippets from files outside the design definitions tree.
+	Snippets *SnippetsConfig `json:"snippets,omitempty" yaml:"snippets,omitempty"`
+
+	// Configuration for sanitizing the HTML of rendered documents.
+	Sanitize *SanitizeConfig `json:"sanitize,omitempty" yaml:"sanitize,omitempty"`
+
+	// Configuration for indexing nodes for search.
+	Search *SearchConfig `json:"search,omitempty" yaml:"search,omitempty"`
+
+	// Documentation components available in documents, keyed by component name, i.e. "Banner".
+	// Component usage is validated against these, when at least one component is declared.
+	// Components may alternatively be declared in a components.yml next to dsk.yml.
+	Components map[string]*ComponentConfig `json:"components,omitempty" yaml:"components,omitempty"`
+
 	Custom interface{} `json:"custom,omitempty" yaml:"custom,omitempty"`
 }
 
@@ -47,3 +70,122 @@ type FigmaConfig struct {
 	// A generated figma personal access token, used for accessing the Figma API on users behalf.
 	AccessToken string `json:"accessToken,omitempty" yaml:"accessToken,omitempty"`
 }
+
+type TokensConfig struct {
+	// The root font size in pixels, used when converting px to rem, defaults to 16.
+	RemBase float64 `json:"remBase,omitempty" yaml:"remBase,omitempty"`
+
+	// Per export format configuration, keyed by format name, i.e. "css" or "android".
+	Formats map[string]*TokensFormatConfig `json:"formats,omitempty" yaml:"formats,omitempty"`
+}
+
+type TokensFormatConfig struct {
+	// How token names are transformed: "kebab", "camel" or "snake".
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// The unit pixel dimensions are converted to: "px", "rem" or "dp".
+	Unit string `json:"unit,omitempty" yaml:"unit,omitempty"`
+
+	// A prefix prepended to each token name.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+}
+
+type MarkdownConfig struct {
+	// The Markdown engine: "blackfriday" or the CommonMark compliant "commonmark", defaults to "blackfriday".
+	Engine string `json:"engine,omitempty" yaml:"engine,omitempty"`
+
+	// A list of enabled extensions: "tables", "footnotes", "taskLists", "definitionLists",
+	// "headingIds", "strikethrough", "autolinks" and "typographer". When omitted all are enabled.
+	Extensions []string `json:"extensions,omitempty" yaml:"extensions,omitempty"`
+}
+
+type HighlightConfig struct {
+	// Enables highlighting of fenced code blocks and <CodeBlock> contents, disabled by default.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+
+	// The name of the color theme, i.e. "monokai", defaults to "github".
+	Style string `json:"style,omitempty" yaml:"style,omitempty"`
+}
+
+type SnippetsConfig struct {
+	// Directories, in addition to the repository root, code snippets may be embedded from.
+	// Relative paths are resolved against the root of the design definitions tree.
+	Paths []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+type SanitizeConfig struct {
+	// Enables sanitization of rendered documents, disabled by default. When enabled, only
+	// safe HTML elements, the known documentation components and their props are kept.
+	Enabled bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+
+	// Additional elements or components to allow, keyed by name, with the attributes
+	// allowed on them, i.e. {"iframe": ["src", "width", "height"]}.
+	Elements map[string][]string `json:"elements,omitempty" yaml:"elements,omitempty"`
+
+	// URL schemes allowed in links and sources, defaults to "http", "https" and "mailto".
+	// Relative URLs are always allowed.
+	URLSchemes []string `json:"urlSchemes,omitempty" yaml:"urlSchemes,omitempty"`
+
+	// URLs of nodes, whose documents - including the ones of their descendants - are
+	// trusted and not sanitized, i.e. "Playground".
+	Trusted []string `json:"trusted,omitempty" yaml:"trusted,omitempty"`
+}
+
+type SearchConfig struct {
+	// The analyzer used for titles, descriptions and documents, overrides the one selected
+	// by the language, i.e. "cjk" for documents mixing CJK and latin text. Besides the
+	// language analyzers "standard", "simple", "keyword" and "web" are available.
+	Analyzer string `json:"analyzer,omitempty" yaml:"analyzer,omitempty"`
+
+	// Analyzers for individual fields, keyed by field name, i.e. {"Docs": "cjk"}. These replace
+	// the analyzers otherwise used for the field, the standard analyzer is always used in addition.
+	Fields map[string]string `json:"fields,omitempty" yaml:"fields,omitempty"`
+
+	// Custom fields to provide facets for, in addition to tags, authors, sections and asset
+	// types, i.e. ["custom.lifecycle"].
+	Facets []string `json:"facets,omitempty" yaml:"facets,omitempty"`
+
+	// The number of full search hits per page, when no limit is requested, defaults to 50.
+	Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+
+	// The maximum number of full search hits, that can be requested per page, defaults to 200.
+	MaxLimit int `json:"maxLimit,omitempty" yaml:"maxLimit,omitempty"`
+
+	// The number of filter results per page, when no limit is requested, defaults to 500.
+	FilterLimit int `json:"filterLimit,omitempty" yaml:"filterLimit,omitempty"`
+
+	// The maximum number of filter results, that can be requested per page, defaults to 1000.
+	MaxFilterLimit int `json:"maxFilterLimit,omitempty" yaml:"maxFilterLimit,omitempty"`
+
+	// Weights of matches in individual fields, keyed by field name, i.e. {"Title": 2, "Tags": 1.5}.
+	// These are merged with the default weights, which boost matches in the title by 2.
+	Boosts map[string]float64 `json:"boosts,omitempty" yaml:"boosts,omitempty"`
+
+	// The number of edits a word of a query may differ from indexed words by: 0, 1 or 2, defaults to 1.
+	// Set to 0 to disable fuzzy matching.
+	Fuzziness *int `json:"fuzziness,omitempty" yaml:"fuzziness,omitempty"`
+
+	// Where words of a query also match words starting with them: "all" in all fields, "boosted"
+	// only in boosted fields, or "none", defaults to "all".
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+
+	// Groups of words with the same meaning, i.e. ["dropdown = select = picker"]. Searching for
+	// any of the words finds nodes, that contain any other word of the group.
+	Synonyms []string `json:"synonyms,omitempty" yaml:"synonyms,omitempty"`
+}
+
+type ComponentConfig struct {
+	// A short description of what the component is used for.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+
+	// Props the component accepts. When omitted any props are allowed, an empty list
+	// allows no props at all.
+	Props []string `json:"props" yaml:"props"`
+
+	// Props that must always be given.
+	Required []string `json:"required,omitempty" yaml:"required,omitempty"`
+
+	// Names of the components allowed as children. When omitted any components are
+	// allowed, an empty list allows no components at all.
+	Children []string `json:"children" yaml:"children"`
+}
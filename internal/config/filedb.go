@@ -25,12 +25,18 @@ func NewFileDB(path string, project string) (*FileDB, error) {
 	db := &FileDB{
 		path: path,
 		data: &Config{
-			Org:     "DSK",
-			Project: project,
-			Lang:    "en",
-			Tags:    make([]*TagConfig, 0),
-			Sources: []string{"live"},
-			Figma:   &FigmaConfig{},
+			Org:       "DSK",
+			Project:   project,
+			Lang:      "en",
+			Tags:      make([]*TagConfig, 0),
+			Sources:   []string{"live"},
+			Figma:     &FigmaConfig{},
+			Tokens:    &TokensConfig{RemBase: 16},
+			Markdown:  &MarkdownConfig{},
+			Highlight: &HighlightConfig{},
+			Snippets:  &SnippetsConfig{},
+			Sanitize:  &SanitizeConfig{},
+			Search:    &SearchConfig{},
 		},
 	}
 	if err := db.Open(); err != nil {
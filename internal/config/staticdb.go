@@ -9,12 +9,18 @@ package config
 func NewStaticDB(project string) *StaticDB {
 	return &StaticDB{
 		data: &Config{
-			Org:     "DSK",
-			Project: project,
-			Lang:    "en",
-			Tags:    make([]*TagConfig, 0),
-			Sources: []string{"live"},
-			Figma:   &FigmaConfig{},
+			Org:       "DSK",
+			Project:   project,
+			Lang:      "en",
+			Tags:      make([]*TagConfig, 0),
+			Sources:   []string{"live"},
+			Figma:     &FigmaConfig{},
+			Tokens:    &TokensConfig{RemBase: 16},
+			Markdown:  &MarkdownConfig{},
+			Highlight: &HighlightConfig{},
+			Snippets:  &SnippetsConfig{},
+			Sanitize:  &SanitizeConfig{},
+			Search:    &SearchConfig{},
 		},
 	}
 }
@@ -0,0 +1,295 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-yaml/yaml"
+	"github.com/rundsk/dsk/internal/config"
+)
+
+var (
+	// Basenames matching this pattern are considered component
+	// registry files, when found in the root of the tree.
+	ComponentRegistryRegexp = regexp.MustCompile(`(?i)^components\.(json|ya?ml)$`)
+
+	// Components handled on the server side, that are always
+	// available and don't need to be declared.
+	builtinComponents = map[string]*config.ComponentConfig{
+		"Include": {
+			Description: "Inlines another document or a section of it.",
+			Props:       []string{"src"},
+			Required:    []string{"src"},
+			Children:    []string{},
+		},
+	}
+)
+
+// NewComponentRegistry initializes a registry from the components
+// declared in the configuration and - optionally - a components file
+// found in root.
+func NewComponentRegistry(root string, cdb config.DB) (*ComponentRegistry, error) {
+	r := &ComponentRegistry{
+		configDB: cdb,
+		file:     make(map[string]*config.ComponentConfig),
+	}
+
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		return r, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !ComponentRegistryRegexp.MatchString(f.Name()) {
+			continue
+		}
+		r.path = filepath.Join(root, f.Name())
+		return r, r.load()
+	}
+	return r, nil
+}
+
+// ComponentRegistry declares the documentation components, that can
+// be used inside documents, together with their props and the
+// components they may contain. When no components are declared,
+// any component usage is considered valid.
+type ComponentRegistry struct {
+	// Absolute path to the components file, optional.
+	path string
+
+	configDB config.DB
+
+	// Components declared in the components file.
+	file map[string]*config.ComponentConfig
+}
+
+func (r *ComponentRegistry) load() error {
+	contents, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(r.path)) {
+	case ".json":
+		err = json.Unmarshal(contents, &r.file)
+	default:
+		err = yaml.Unmarshal(contents, &r.file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse component registry %s: %s", filepath.Base(r.path), err)
+	}
+	return nil
+}
+
+// All returns the declared components, keyed by name. Components
+// declared in the components file take precedence over the ones
+// declared in the configuration.
+func (r *ComponentRegistry) All() map[string]*config.ComponentConfig {
+	all := make(map[string]*config.ComponentConfig)
+
+	if r.configDB != nil {
+		for name, c := range r.configDB.Data().Components {
+			all[name] = c
+		}
+	}
+	for name, c := range r.file {
+		all[name] = c
+	}
+	// Components may be declared just by name, i.e. "Do:" in YAML.
+	for name, c := range all {
+		if c == nil {
+			all[name] = &config.ComponentConfig{}
+		}
+	}
+	return all
+}
+
+// CalculateHash returns a hash over all declared components.
+func (r *ComponentRegistry) CalculateHash() (string, error) {
+	// Map keys are sorted when encoding, so the result is stable.
+	j, err := json.Marshal(r.All())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha1.Sum(j)), nil
+}
+
+// ComponentError describes an invalid usage of a documentation
+// component inside a document.
+type ComponentError struct {
+	Component string
+
+	// Line and Column of the component's start tag.
+	Line   int
+	Column int
+
+	Message string
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Validate checks the usage of documentation components against the
+// registry. Plain HTML elements are not validated, but components
+// nested inside them are.
+func (r *ComponentRegistry) Validate(components []*NodeDocComponent) []*ComponentError {
+	errs := make([]*ComponentError, 0)
+
+	all := r.All()
+	if len(all) == 0 {
+		return errs
+	}
+	for name, c := range builtinComponents {
+		if _, ok := all[name]; !ok {
+			all[name] = c
+		}
+	}
+
+	report := func(c *NodeDocComponent, format string, a ...interface{}) {
+		errs = append(errs, &ComponentError{
+			Component: c.Name,
+			Line:      c.Line,
+			Column:    c.Column,
+			Message:   fmt.Sprintf(format, a...),
+		})
+	}
+
+	var validate func(cs []*NodeDocComponent)
+	validate = func(cs []*NodeDocComponent) {
+		for _, c := range cs {
+			if !isComponentName(c.Name) {
+				validate(c.Children)
+				continue
+			}
+
+			spec, ok := all[c.Name]
+			if !ok {
+				if suggestion := suggestComponentName(c.Name, all); suggestion != "" {
+					report(c, "unknown component <%s>, did you mean <%s>?", c.Name, suggestion)
+				} else {
+					report(c, "unknown component <%s>", c.Name)
+				}
+				validate(c.Children)
+				continue
+			}
+
+			if spec.Props != nil {
+				for _, prop := range sortedProps(c.Props) {
+					if !containsString(spec.Props, prop) {
+						report(c, "unknown prop %q on <%s>", prop, c.Name)
+					}
+				}
+			}
+			for _, prop := range spec.Required {
+				if _, ok := c.Props[prop]; !ok {
+					report(c, "missing required prop %q on <%s>", prop, c.Name)
+				}
+			}
+			if spec.Children != nil {
+				for _, child := range childComponents(c) {
+					if !containsString(spec.Children, child.Name) {
+						report(child, "component <%s> is not allowed inside <%s>", child.Name, c.Name)
+					}
+				}
+			}
+			validate(c.Children)
+		}
+	}
+	validate(components)
+
+	return errs
+}
+
+// childComponents returns the nearest components nested inside c,
+// looking through any plain HTML elements in between.
+func childComponents(c *NodeDocComponent) []*NodeDocComponent {
+	found := make([]*NodeDocComponent, 0)
+
+	for _, child := range c.Children {
+		if isComponentName(child.Name) {
+			found = append(found, child)
+			continue
+		}
+		found = append(found, childComponents(child)...)
+	}
+	return found
+}
+
+// suggestComponentName finds a declared component with a similar
+// name, to help with typos like <Dodont>.
+func suggestComponentName(name string, all map[string]*config.ComponentConfig) string {
+	names := make([]string, 0, len(all))
+	for n := range all {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	best, bestDistance := "", 3
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return n
+		}
+		if d := levenshtein(strings.ToLower(n), strings.ToLower(name)); d < bestDistance {
+			best, bestDistance = n, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a string, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, minInt(cur[j-1]+1, prev[j-1]+cost))
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func sortedProps(props map[string]string) []string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
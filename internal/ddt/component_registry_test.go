@@ -0,0 +1,99 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+)
+
+func TestComponentRegistryValidate(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	registry := `
+Banner:
+  props: [title, type]
+  required: [title]
+DoDont:
+  children: [Do, Dont]
+Do:
+Dont:
+`
+	ioutil.WriteFile(filepath.Join(tmp, "components.yml"), []byte(registry), 0644)
+
+	r, err := NewComponentRegistry(tmp, nil)
+	if err != nil {
+		t.Fatalf("failed to load registry: %s", err)
+	}
+
+	doc := `<Banner titel="Hi"></Banner>
+<Dodont></Dodont>
+<DoDont>
+  <div><Do></Do></div>
+  <Banner title="Nope"></Banner>
+</DoDont>
+<p>Just <em>HTML</em></p>`
+
+	var messages []string
+	for _, e := range r.Validate(findComponentsInMarkdown([]byte(doc))) {
+		messages = append(messages, e.Error())
+	}
+	expected := []string{
+		`1:1: unknown prop "titel" on <Banner>`,
+		`1:1: missing required prop "title" on <Banner>`,
+		`2:1: unknown component <Dodont>, did you mean <DoDont>?`,
+		`5:3: component <Banner> is not allowed inside <DoDont>`,
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("unexpected errors, got: %#v", messages)
+	}
+}
+
+func TestComponentRegistryPrecedence(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	cdb := config.NewStaticDB("test")
+	cdb.Data().Components = map[string]*config.ComponentConfig{
+		"Banner": {Description: "from config"},
+		"Color":  {Description: "from config"},
+	}
+	ioutil.WriteFile(filepath.Join(tmp, "components.json"), []byte(`{"Banner": {"description": "from file"}}`), 0644)
+
+	r, err := NewComponentRegistry(tmp, cdb)
+	if err != nil {
+		t.Fatalf("failed to load registry: %s", err)
+	}
+	all := r.All()
+
+	if all["Banner"].Description != "from file" {
+		t.Errorf("expected file to take precedence, got: %s", all["Banner"].Description)
+	}
+	if all["Color"].Description != "from config" {
+		t.Errorf("expected component from config, got: %v", all["Color"])
+	}
+}
+
+func TestComponentRegistryEmpty(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	r, err := NewComponentRegistry(tmp, nil)
+	if err != nil {
+		t.Fatalf("failed to initialize registry: %s", err)
+	}
+	errs := r.Validate(findComponentsInMarkdown([]byte(`<Anything goes="yes"></Anything>`)))
+
+	if len(errs) != 0 {
+		t.Errorf("expected no errors without declared components, got: %v", errs)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"golang.org/x/net/html"
+)
+
+// DefaultHighlightStyle is used, when no style has been configured.
+const DefaultHighlightStyle = "github"
+
+var (
+	codeBlockScriptStartRegexp = regexp.MustCompile(`^\s*<script>`)
+	codeBlockScriptEndRegexp   = regexp.MustCompile(`</script>\s*$`)
+)
+
+// NewHighlighter returns a Highlighter, the style is only used to
+// decide which token types receive a class.
+func NewHighlighter(style string) *Highlighter {
+	return &Highlighter{
+		style: highlightStyle(style),
+		formatter: chromahtml.New(
+			chromahtml.WithClasses(true),
+			chromahtml.PreventSurroundingPre(true),
+		),
+	}
+}
+
+// Highlighter highlights source code on the server side. It emits
+// class-based markup, the corresponding stylesheet is generated by
+// HighlightCSS().
+type Highlighter struct {
+	style     *chroma.Style
+	formatter *chromahtml.Formatter
+}
+
+// Highlight writes the highlighted code wrapped into an element with
+// the "chroma" class, or - when the language isn't known - just the
+// escaped code. "ok" indicates if the code was highlighted.
+func (h *Highlighter) Highlight(w io.Writer, lang string, code string) (bool, error) {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		_, err := io.WriteString(w, html.EscapeString(code))
+		return false, err
+	}
+
+	it, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprint(w, `<span class="chroma">`)
+	if err := h.formatter.Format(w, h.style, it); err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprint(w, `</span>`)
+	return true, err
+}
+
+// HighlightCSS writes the stylesheet for highlighted code.
+func HighlightCSS(w io.Writer, style string) error {
+	return chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(w, highlightStyle(style))
+}
+
+// codeLanguage extracts the language from a class attribute in the
+// form of "language-go", as generated for fenced code blocks.
+func codeLanguage(class string) string {
+	for _, c := range strings.Fields(class) {
+		if strings.HasPrefix(c, "language-") {
+			return strings.TrimPrefix(c, "language-")
+		}
+	}
+	return ""
+}
+
+// unwrapCodeBlock removes the <script> tags, that are used to protect
+// the contents of <CodeBlock>s from being interpreted as HTML, as
+// well as an initial empty line. Contents not wrapped into a <script>
+// are HTML, their entities are unescaped, so they aren't escaped
+// twice once highlighted.
+func unwrapCodeBlock(code string) string {
+	if !codeBlockScriptStartRegexp.MatchString(code) || !codeBlockScriptEndRegexp.MatchString(code) {
+		return strings.TrimPrefix(html.UnescapeString(code), "\n")
+	}
+	code = codeBlockScriptStartRegexp.ReplaceAllString(code, "")
+	code = codeBlockScriptEndRegexp.ReplaceAllString(code, "")
+	return strings.TrimPrefix(code, "\n")
+}
+
+func highlightStyle(name string) *chroma.Style {
+	if name == "" {
+		name = DefaultHighlightStyle
+	}
+	// Returns the fallback style, when name isn't known.
+	return styles.Get(name)
+}
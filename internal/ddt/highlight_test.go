@@ -0,0 +1,140 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHighlightFencedCode(t *testing.T) {
+	get := func(url string) (bool, *Node, error) {
+		return false, &Node{}, nil
+	}
+	dt, _ := NewNodeDocTransformer("/tree", "foo/bar", get, "test")
+	dt.highlighter = NewHighlighter("")
+
+	r, err := dt.ProcessHTML([]byte("<pre><code class=\"language-go\">if a &lt; b {}\n</code></pre>"))
+	if err != nil {
+		t.Fatalf("failed to process HTML: %s", err)
+	}
+	if !strings.HasPrefix(string(r), `<pre><code class="language-go"><span class="chroma">`) {
+		t.Errorf("failed to highlight code, got: %s", r)
+	}
+	if !strings.Contains(string(r), `<span class="k">if</span>`) {
+		t.Errorf("failed to highlight keyword, got: %s", r)
+	}
+	if !strings.Contains(string(r), `&lt;`) || strings.Contains(string(r), `&amp;lt;`) {
+		t.Errorf("failed to escape code, got: %s", r)
+	}
+}
+
+func TestHighlightKeepsEscapingOtherCode(t *testing.T) {
+	get := func(url string) (bool, *Node, error) {
+		return false, &Node{}, nil
+	}
+	dt, _ := NewNodeDocTransformer("/tree", "foo/bar", get, "test")
+	dt.highlighter = NewHighlighter("")
+
+	expected := map[string]string{
+		"<code><Banner>Hi</Banner></code>":                     "<code>&lt;Banner&gt;Hi&lt;/Banner&gt;</code>",
+		"<code class=\"language-unknown\">&lt;b&gt;</code>":    "<code class=\"language-unknown\">&lt;b&gt;</code>",
+		"<CodeBlock title=\"Example\"><b>bold</b></CodeBlock>": "<CodeBlock title=\"Example\"><b>bold</b></CodeBlock>",
+	}
+	for h, e := range expected {
+		r, _ := dt.ProcessHTML([]byte(h))
+
+		if string(r) != e {
+			t.Errorf("\nexpected input : %s\nto parse to    : %s\nbut got instead: %s", h, e, r)
+		}
+	}
+}
+
+func TestHighlightCodeBlock(t *testing.T) {
+	get := func(url string) (bool, *Node, error) {
+		return false, &Node{}, nil
+	}
+	dt, _ := NewNodeDocTransformer("/tree", "foo/bar", get, "test")
+	dt.highlighter = NewHighlighter("")
+
+	h := "<CodeBlock language=\"html\"><script>\n<div class=\"a\"></div>\n</script></CodeBlock>"
+
+	r, err := dt.ProcessHTML([]byte(h))
+	if err != nil {
+		t.Fatalf("failed to process HTML: %s", err)
+	}
+	if !strings.HasPrefix(string(r), `<CodeBlock language="html" data-highlighted="true"><span class="chroma">`) {
+		t.Errorf("failed to highlight code block, got: %s", r)
+	}
+	if strings.Contains(string(r), "script") || !strings.Contains(string(r), `&lt;`) {
+		t.Errorf("failed to unwrap and escape code block, got: %s", r)
+	}
+	if !strings.HasSuffix(string(r), "</span></CodeBlock>") {
+		t.Errorf("failed to close code block, got: %s", r)
+	}
+}
+
+func TestHighlightCodeBlockEntities(t *testing.T) {
+	get := func(url string) (bool, *Node, error) {
+		return false, &Node{}, nil
+	}
+	dt, _ := NewNodeDocTransformer("/tree", "foo/bar", get, "test")
+	dt.highlighter = NewHighlighter("")
+
+	// Without a <script>, the contents are HTML.
+	r, err := dt.ProcessHTML([]byte(`<CodeBlock language="go">if a &lt; b &amp;&amp; c {}</CodeBlock>`))
+	if err != nil {
+		t.Fatalf("failed to process HTML: %s", err)
+	}
+	if strings.Contains(string(r), "&amp;lt;") || strings.Contains(string(r), "&amp;amp;") {
+		t.Errorf("failed to unescape code block, got: %s", r)
+	}
+	if !strings.Contains(string(r), "&lt;") || !strings.Contains(string(r), "&amp;&amp;") {
+		t.Errorf("failed to escape code block once, got: %s", r)
+	}
+
+	// Inside a <script>, entities are taken literally.
+	r, err = dt.ProcessHTML([]byte(`<CodeBlock language="html"><script>&lt;</script></CodeBlock>`))
+	if err != nil {
+		t.Fatalf("failed to process HTML: %s", err)
+	}
+	if !strings.Contains(string(r), "&amp;lt;") {
+		t.Errorf("failed to keep entity inside script, got: %s", r)
+	}
+}
+
+func TestHighlightUnclosed(t *testing.T) {
+	get := func(url string) (bool, *Node, error) {
+		return false, &Node{}, nil
+	}
+	dt, _ := NewNodeDocTransformer("/tree", "foo/bar", get, "test")
+	dt.highlighter = NewHighlighter("")
+
+	expected := map[string]string{
+		"<CodeBlock language=\"go\"><script>a := 1</script><p>Rest of the document.</p>": "<CodeBlock language=\"go\"><script>a := 1</script><p>Rest of the document.</p>",
+		"<pre><code class=\"language-go\">if a &lt; b {}\n<p>Rest</p>":                   "<pre><code class=\"language-go\">if a &lt; b {}\n&lt;p&gt;Rest&lt;/p&gt;",
+	}
+	for h, e := range expected {
+		r, err := dt.ProcessHTML([]byte(h))
+		if err != nil {
+			t.Fatalf("failed to process HTML: %s", err)
+		}
+		if string(r) != e {
+			t.Errorf("\nexpected input : %s\nto parse to    : %s\nbut got instead: %s", h, e, r)
+		}
+	}
+}
+
+func TestHighlightCSS(t *testing.T) {
+	var buf bytes.Buffer
+	if err := HighlightCSS(&buf, "monokai"); err != nil {
+		t.Fatalf("failed to generate CSS: %s", err)
+	}
+	if !strings.Contains(buf.String(), ".chroma .k {") {
+		t.Errorf("failed to generate keyword rule, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/russross/blackfriday/v2"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// Names of the Markdown engines.
+const (
+	MarkdownEngineBlackfriday = "blackfriday"
+	MarkdownEngineCommonMark  = "commonmark"
+)
+
+// Names of the Markdown extensions, that can be enabled in the
+// configuration.
+const (
+	MarkdownExtTables          = "tables"
+	MarkdownExtFootnotes       = "footnotes"
+	MarkdownExtTaskLists       = "taskLists"
+	MarkdownExtDefinitionLists = "definitionLists"
+	MarkdownExtHeadingIDs      = "headingIds"
+	MarkdownExtStrikethrough   = "strikethrough"
+	MarkdownExtAutolinks       = "autolinks"
+	MarkdownExtTypographer     = "typographer"
+)
+
+var (
+	// DefaultMarkdownExtensions are enabled, when the configuration
+	// doesn't list any extensions.
+	DefaultMarkdownExtensions = []string{
+		MarkdownExtTables,
+		MarkdownExtFootnotes,
+		MarkdownExtTaskLists,
+		MarkdownExtDefinitionLists,
+		MarkdownExtHeadingIDs,
+		MarkdownExtStrikethrough,
+		MarkdownExtAutolinks,
+		MarkdownExtTypographer,
+	}
+
+	// Renderers are reused, as constructing them is not free; keyed
+	// by engine and extensions.
+	markdownRenderers sync.Map
+)
+
+// MarkdownRenderer converts Markdown into HTML. Implementations must
+// pass through any raw HTML unaltered, as documentation components
+// are embedded as HTML.
+type MarkdownRenderer interface {
+	Render(contents []byte) ([]byte, error)
+}
+
+// NewMarkdownRenderer returns a renderer for the configured engine,
+// with the configured extensions enabled. Extensions an engine
+// doesn't support are ignored.
+func NewMarkdownRenderer(c *config.MarkdownConfig) (MarkdownRenderer, error) {
+	engine := MarkdownEngineBlackfriday
+	exts := DefaultMarkdownExtensions
+
+	if c != nil {
+		if c.Engine != "" {
+			engine = c.Engine
+		}
+		if c.Extensions != nil {
+			exts = c.Extensions
+		}
+	}
+	enabled := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		enabled[ext] = true
+	}
+
+	key := engine + ":" + strings.Join(exts, ",")
+	if r, ok := markdownRenderers.Load(key); ok {
+		return r.(MarkdownRenderer), nil
+	}
+
+	var r MarkdownRenderer
+	switch engine {
+	case MarkdownEngineBlackfriday:
+		r = newBlackfridayRenderer(enabled)
+	case MarkdownEngineCommonMark:
+		r = newCommonMarkRenderer(enabled)
+	default:
+		return nil, fmt.Errorf("unknown Markdown engine: %s", engine)
+	}
+	markdownRenderers.Store(key, r)
+	return r, nil
+}
+
+// blackfridayRenderer is the original renderer. It does not support
+// task lists.
+type blackfridayRenderer struct {
+	flags      blackfriday.HTMLFlags
+	extensions blackfriday.Extensions
+}
+
+func newBlackfridayRenderer(enabled map[string]bool) *blackfridayRenderer {
+	r := &blackfridayRenderer{
+		extensions: blackfriday.NoIntraEmphasis |
+			blackfriday.FencedCode |
+			blackfriday.SpaceHeadings |
+			blackfriday.BackslashLineBreak |
+			blackfriday.NoEmptyLineBeforeBlock,
+	}
+
+	extensions := map[string]blackfriday.Extensions{
+		MarkdownExtTables:          blackfriday.Tables,
+		MarkdownExtFootnotes:       blackfriday.Footnotes,
+		MarkdownExtDefinitionLists: blackfriday.DefinitionLists,
+		MarkdownExtHeadingIDs:      blackfriday.HeadingIDs,
+		MarkdownExtStrikethrough:   blackfriday.Strikethrough,
+		MarkdownExtAutolinks:       blackfriday.Autolink,
+	}
+	for name, ext := range extensions {
+		if enabled[name] {
+			r.extensions |= ext
+		}
+	}
+	if enabled[MarkdownExtTypographer] {
+		r.flags |= blackfriday.Smartypants |
+			blackfriday.SmartypantsFractions |
+			blackfriday.SmartypantsDashes |
+			blackfriday.SmartypantsLatexDashes
+	}
+	return r
+}
+
+func (r *blackfridayRenderer) Render(contents []byte) ([]byte, error) {
+	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+		Flags: r.flags,
+	})
+	return blackfriday.Run(
+		contents,
+		blackfriday.WithRenderer(renderer),
+		blackfriday.WithExtensions(r.extensions),
+	), nil
+}
+
+// commonMarkRenderer is a CommonMark compliant renderer, with GitHub
+// Flavored Markdown extensions.
+type commonMarkRenderer struct {
+	md goldmark.Markdown
+}
+
+func newCommonMarkRenderer(enabled map[string]bool) *commonMarkRenderer {
+	extensions := map[string]goldmark.Extender{
+		MarkdownExtTables:          extension.Table,
+		MarkdownExtFootnotes:       extension.Footnote,
+		MarkdownExtTaskLists:       extension.TaskList,
+		MarkdownExtDefinitionLists: extension.DefinitionList,
+		MarkdownExtStrikethrough:   extension.Strikethrough,
+		MarkdownExtAutolinks:       extension.Linkify,
+		MarkdownExtTypographer:     extension.Typographer,
+	}
+	exts := make([]goldmark.Extender, 0, len(extensions))
+
+	// Iterate in the order of the defaults, so that extensions are
+	// always registered in the same order.
+	for _, name := range DefaultMarkdownExtensions {
+		if ext, ok := extensions[name]; ok && enabled[name] {
+			exts = append(exts, ext)
+		}
+	}
+
+	parserOptions := make([]parser.Option, 0)
+	if enabled[MarkdownExtHeadingIDs] {
+		parserOptions = append(parserOptions, parser.WithHeadingAttribute())
+	}
+
+	return &commonMarkRenderer{
+		md: goldmark.New(
+			goldmark.WithExtensions(exts...),
+			goldmark.WithParserOptions(parserOptions...),
+			goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+		),
+	}
+}
+
+func (r *commonMarkRenderer) Render(contents []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	err := r.md.Convert(contents, &buf)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+)
+
+func TestMarkdownRenderersExtensions(t *testing.T) {
+	doc := `# Colors {#colors}
+
+| Name | Value |
+|:-----|------:|
+| Red  | #f00  |
+
+Term
+: Definition
+
+Use "quotes"[^1] and ~~strike~~.
+
+[^1]: A footnote.
+`
+	expected := map[string][]string{
+		MarkdownEngineBlackfriday: {
+			`<h1 id="colors">Colors</h1>`,
+			`<td align="right">#f00</td>`,
+			`<dt>Term</dt>`,
+			`<del>strike</del>`,
+			`&ldquo;quotes&rdquo;`,
+			`<div class="footnotes">`,
+		},
+		MarkdownEngineCommonMark: {
+			`<h1 id="colors">Colors</h1>`,
+			`<td style="text-align:right">#f00</td>`,
+			`<dt>Term</dt>`,
+			`<del>strike</del>`,
+			`&ldquo;quotes&rdquo;`,
+			`<div class="footnotes"`,
+		},
+	}
+	for engine, es := range expected {
+		r, err := NewMarkdownRenderer(&config.MarkdownConfig{Engine: engine})
+		if err != nil {
+			t.Fatalf("failed to create renderer: %s", err)
+		}
+		html, err := r.Render([]byte(doc))
+		if err != nil {
+			t.Fatalf("failed to render with %s: %s", engine, err)
+		}
+		for _, e := range es {
+			if !strings.Contains(string(html), e) {
+				t.Errorf("%s: expected %s in output, got: %s", engine, e, html)
+			}
+		}
+	}
+}
+
+func TestMarkdownRendererDisabledExtensions(t *testing.T) {
+	for _, engine := range []string{MarkdownEngineBlackfriday, MarkdownEngineCommonMark} {
+		r, _ := NewMarkdownRenderer(&config.MarkdownConfig{
+			Engine:     engine,
+			Extensions: []string{},
+		})
+		html, _ := r.Render([]byte("Term\n: Definition\n\n~~strike~~\n"))
+
+		if strings.Contains(string(html), "<dt>") || strings.Contains(string(html), "<del>") {
+			t.Errorf("%s: expected extensions to be disabled, got: %s", engine, html)
+		}
+	}
+}
+
+func TestMarkdownRendererTaskLists(t *testing.T) {
+	r, _ := NewMarkdownRenderer(&config.MarkdownConfig{Engine: MarkdownEngineCommonMark})
+	html, _ := r.Render([]byte("- [x] Done\n- [ ] Todo\n"))
+
+	if !strings.Contains(string(html), `<input checked="" disabled="" type="checkbox">`) {
+		t.Errorf("failed to render task list, got: %s", html)
+	}
+}
+
+func TestMarkdownRendererUnknownEngine(t *testing.T) {
+	_, err := NewMarkdownRenderer(&config.MarkdownConfig{Engine: "foo"})
+	if err == nil {
+		t.Errorf("expected error for unknown engine")
+	}
+}
+
+func TestCommonMarkComponentsAndToc(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "readme.md")
+	ioutil.WriteFile(path, []byte("# Usage\n\n<Banner title=\"Hi\">*Hello*</Banner>\n\n## Details\n"), 0644)
+
+	cdb := config.NewStaticDB("test")
+	cdb.Data().Markdown.Engine = MarkdownEngineCommonMark
+
+	doc := &NodeDoc{path: path, configDB: cdb}
+
+	html, err := doc.HTML("/api/v1/tree", "foo", nil, "live")
+	if err != nil {
+		t.Fatalf("failed to render document: %s", err)
+	}
+	if !strings.Contains(string(html), `<Banner title="Hi">*Hello*</Banner>`) {
+		t.Errorf("failed to keep component, got: %s", html)
+	}
+
+	toc, err := doc.Toc("foo", nil, "live")
+	if err != nil {
+		t.Fatalf("failed to generate ToC: %s", err)
+	}
+	if len(toc) != 1 || toc[0].Title != "Usage" || len(toc[0].Children) != 1 {
+		t.Errorf("unexpected ToC, got: %+v", toc)
+	}
+}
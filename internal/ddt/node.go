@@ -8,6 +8,7 @@ package ddt
 
 import (
 	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -36,7 +37,7 @@ var (
 
 	// Files that are not considered to be assets in addition to node
 	// meta and doc files.
-	NodeAssetsIgnoreRegexp = regexp.MustCompile(`(?i)^(dsk|dsk\.(json|ya?ml)|AUTHORS\.txt|empty)$`)
+	NodeAssetsIgnoreRegexp = regexp.MustCompile(`(?i)^(dsk|dsk\.(json|ya?ml)|components\.(json|ya?ml)|AUTHORS\.txt|empty)$`)
 
 	// Characters that are ignored when looking up an URL,
 	// i.e. "foo/bar baz" and "foo/barbaz" are than equal.
@@ -97,6 +98,22 @@ type Node struct {
 
 	authorDB author.DB
 
+	// The registry component usage in documents is validated
+	// against, optional.
+	components *ComponentRegistry
+
+	// Nodes whose documents are included by our documents, see
+	// Dependencies().
+	dependencies []*Node
+
+	// Absolute path to the repository root, code snippets may be
+	// embedded from, optional.
+	repoPath string
+
+	// Files outside the tree, our documents embed code from, see
+	// findSnippetFiles().
+	snippetFiles []string
+
 	// hash is the lazily cached hash set, than used by
 	// CalculateHash(). The calculation is not super expensive on its
 	// own but once the top of node tree branch is queried for its
@@ -181,6 +198,50 @@ func (n *Node) CalculateHash() (string, error) {
 	}
 	h.Write([]byte(strconv.FormatInt(m.Unix(), 10)))
 
+	// Our documents change, when included documents change. We must
+	// not use the hash of the dependency, as includes may be
+	// circular.
+	for _, dep := range n.dependencies {
+		dm, err := dep.lastModifiedForIdentity()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(dep.Path))
+		h.Write([]byte(strconv.FormatInt(dm.Unix(), 10)))
+	}
+
+	// Code embedded from outside the tree, see embedSnippets(). A
+	// missing file is a problem of rendering, not of the hash.
+	for _, f := range n.snippetFiles {
+		h.Write([]byte(f))
+
+		info, err := os.Stat(f)
+		if err != nil {
+			h.Write([]byte(":missing"))
+			continue
+		}
+		h.Write([]byte(strconv.FormatInt(info.ModTime().Unix(), 10)))
+	}
+
+	// Documents may reference the configuration, see
+	// expandTemplate().
+	if n.configDB != nil {
+		j, err := json.Marshal(n.configDB.Data())
+		if err != nil {
+			return "", err
+		}
+		h.Write(j)
+	}
+
+	// Validation results of our documents depend on the registry.
+	if n.components != nil {
+		rh, err := n.components.CalculateHash()
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(rh))
+	}
+
 	hcom.Write(h.Sum(nil))
 	for _, v := range n.Children {
 		hv, err := v.CalculateHash()
@@ -191,10 +252,18 @@ func (n *Node) CalculateHash() (string, error) {
 	}
 	n.Lock()
 	defer n.Unlock()
-	n.hash = fmt.Sprintf("%x", h.Sum(nil))
+	n.hash = fmt.Sprintf("%x", hcom.Sum(nil))
 	return n.hash, nil
 }
 
+// cachedHash returns the hash, when it has already been calculated,
+// otherwise an empty string.
+func (n *Node) cachedHash() string {
+	n.RLock()
+	defer n.RUnlock()
+	return n.hash
+}
+
 // Returns the normalized URL path fragment, that can be used to
 // address this node i.e Input/Password.
 func (n *Node) URL() string {
@@ -343,6 +412,21 @@ func (n *Node) Version() string {
 	return n.meta.Version
 }
 
+// SearchBoost is the factor the relevance of the node in search
+// results is multiplied by.
+func (n *Node) SearchBoost() float64 {
+	if n.meta.Search == nil || n.meta.Search.Boost <= 0 {
+		return 1
+	}
+	return n.meta.Search.Boost
+}
+
+// IsSearchExcluded checks whether the node must not be found by
+// search.
+func (n *Node) IsSearchExcluded() bool {
+	return n.meta.Search != nil && n.meta.Search.Exclude
+}
+
 // Asset returns the that matches name. Generally we don't support
 // order numbers on assets, they make sense on documents and design
 // aspects but do not make sense on assets.
@@ -435,7 +519,11 @@ func (n *Node) Docs() ([]*NodeDoc, error) {
 			continue
 		}
 		docs = append(docs, &NodeDoc{
-			path: filepath.Join(n.Path, f.Name()),
+			path:       filepath.Join(n.Path, f.Name()),
+			configDB:   n.configDB,
+			components: n.components,
+			node:       n,
+			repoPath:   n.repoPath,
 		})
 	}
 	return docs, nil
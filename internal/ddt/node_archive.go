@@ -0,0 +1,154 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ArchiveOptions control what goes into a node archive.
+type ArchiveOptions struct {
+	// Recursive includes the assets of all descendant nodes.
+	Recursive bool
+
+	// Docs includes the document files, in addition to the assets.
+	Docs bool
+}
+
+// ArchiveHash calculates a hash over the node and - when archiving
+// recursively - all of its descendants. It changes whenever the
+// contents of the archive would change and is suitable for use as
+// an ETag.
+func (n *Node) ArchiveHash(o ArchiveOptions) (string, error) {
+	h := sha1.New()
+	fmt.Fprintf(h, "%t:%t", o.Recursive, o.Docs)
+
+	var walk func(n *Node) error
+	walk = func(n *Node) error {
+		hv, err := n.CalculateHash()
+		if err != nil {
+			return err
+		}
+		h.Write([]byte(hv))
+
+		if !o.Recursive {
+			return nil
+		}
+		for _, c := range n.Children {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(n); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// WriteArchive streams a ZIP archive with the node's assets to w.
+// Descendant nodes are stored in sub-directories, mirroring the
+// directory structure of the tree. Order numbers are stripped off
+// directory and file names.
+func (n *Node) WriteArchive(w io.Writer, o ArchiveOptions) error {
+	zw := zip.NewWriter(w)
+
+	if err := n.writeArchive(zw, "", o); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+func (n *Node) writeArchive(zw *zip.Writer, prefix string, o ArchiveOptions) error {
+	files := make([]string, 0)
+
+	as, err := n.Assets()
+	if err != nil {
+		return err
+	}
+	for _, a := range as {
+		files = append(files, a.Path)
+	}
+	if o.Docs {
+		docs, err := n.Docs()
+		if err != nil {
+			return err
+		}
+		for _, d := range docs {
+			files = append(files, d.path)
+		}
+	}
+
+	// Stripping order numbers may lead to duplicate names, in this
+	// case we fall back to the original name.
+	seen := make(map[string]bool, len(files))
+
+	for _, f := range files {
+		base := norm.NFC.String(filepath.Base(f))
+
+		name := removeOrderNumber(base)
+		if seen[name] {
+			name = base
+		}
+		seen[name] = true
+
+		if err := addFileToArchive(zw, f, path.Join(prefix, name)); err != nil {
+			return err
+		}
+	}
+
+	if !o.Recursive {
+		return nil
+	}
+	for _, c := range n.Children {
+		name := c.Name()
+		if seen[name] {
+			name = norm.NFC.String(filepath.Base(c.Path))
+		}
+		seen[name] = true
+
+		if err := c.writeArchive(zw, path.Join(prefix, name), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addFileToArchive(zw *zip.Writer, file string, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	fw, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, f)
+	return err
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNodeArchive(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	files := []string{
+		"01_Icons/02_arrow.svg",
+		"01_Icons/readme.md",
+		"01_Icons/index.json",
+		"01_Icons/.DS_Store",
+		"01_Icons/03_Social/twitter.svg",
+	}
+	for _, f := range files {
+		path := filepath.Join(tmp, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(f), 0644)
+	}
+	child := &Node{root: tmp, Path: filepath.Join(tmp, "01_Icons", "03_Social")}
+	n := &Node{root: tmp, Path: filepath.Join(tmp, "01_Icons"), Children: []*Node{child}}
+
+	expected := map[ArchiveOptions][]string{
+		{}:                            {"arrow.svg"},
+		{Docs: true}:                  {"arrow.svg", "readme.md"},
+		{Recursive: true}:             {"Social/twitter.svg", "arrow.svg"},
+		{Recursive: true, Docs: true}: {"Social/twitter.svg", "arrow.svg", "readme.md"},
+	}
+	for o, e := range expected {
+		var buf bytes.Buffer
+		if err := n.WriteArchive(&buf, o); err != nil {
+			t.Fatalf("failed to write archive: %s", err)
+		}
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("failed to read archive: %s", err)
+		}
+		names := make([]string, 0, len(zr.File))
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(names, e) {
+			t.Errorf("unexpected archive contents for %+v, got: %v", o, names)
+		}
+	}
+}
@@ -8,7 +8,6 @@ package ddt
 
 import (
 	"bytes"
-	"encoding/json"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
@@ -19,8 +18,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-yaml/yaml"
-	"github.com/icza/dyno"
 	"github.com/rundsk/dsk/internal/meta"
 
 	"golang.org/x/text/unicode/norm"
@@ -88,54 +85,49 @@ func (a NodeAsset) Dimensions() (ok bool, w int, h int, err error) {
 
 // As returns the node assets' contents, converted to the type
 // indicated by given extensions. The extensions should include the a
-// leading ".".
+// leading ".". Structured data assets can be converted between all
+// DataAssetExts, when the data's shape allows it. When the contents
+// cannot be converted an *AssetConversionError is returned.
 func (a NodeAsset) As(targetExt string) (bool, io.ReadSeeker, error) {
-	sourceExt := filepath.Ext(a.Path)
+	sourceExt := strings.ToLower(filepath.Ext(a.Path))
+	targetExt = strings.ToLower(targetExt)
+
+	if !isDataAssetExt(sourceExt) || !isDataAssetExt(targetExt) {
+		return false, nil, nil
+	}
 
 	contents, err := ioutil.ReadFile(a.Path)
 	if err != nil {
 		return true, nil, err
 	}
-	var data interface{}
 
-	switch sourceExt {
-	case ".json":
-		if err := json.Unmarshal(contents, &data); err != nil {
-			return true, nil, err
-		}
-	case ".yaml", ".yml":
-		if err := yaml.Unmarshal(contents, &data); err != nil {
-			return true, nil, err
-		}
-		// Fixup converted format, otherwise we can't convert to JSON.
-		data = dyno.ConvertMapI2MapS(data)
-	default:
-		return false, nil, nil
+	data, err := decodeData(sourceExt, contents)
+	if err != nil {
+		return true, nil, &AssetConversionError{sourceExt, targetExt, err}
 	}
-
-	switch targetExt {
-	case ".json":
-		marshalled, err := json.Marshal(data)
-		return true, bytes.NewReader(marshalled), err
-	case ".yaml", ".yml":
-		marshalled, err := yaml.Marshal(data)
-		return true, bytes.NewReader(marshalled), err
-	default:
-		return false, nil, nil
+	marshalled, err := encodeData(targetExt, data)
+	if err != nil {
+		return true, nil, &AssetConversionError{sourceExt, targetExt, err}
 	}
+	return true, bytes.NewReader(marshalled), nil
 }
 
+// AlternateNames returns the names of assets, the given asset name
+// may be converted from.
 func AlternateNames(name string) []string {
 	names := make([]string, 0)
 
 	ext := filepath.Ext(name)
 	filename := name[0 : len(name)-len(ext)]
 
-	switch ext {
-	case ".json":
-		names = append(names, filename+".yaml", filename+".yml")
-	case ".yaml", ".yml":
-		names = append(names, filename+".json")
+	if !isDataAssetExt(strings.ToLower(ext)) {
+		return names
+	}
+	for _, e := range DataAssetExts {
+		if e == strings.ToLower(ext) {
+			continue
+		}
+		names = append(names, filename+e)
 	}
 	return names
 }
@@ -0,0 +1,261 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-yaml/yaml"
+	"github.com/icza/dyno"
+)
+
+var (
+	// DataAssetExts are the extensions of structured data assets, that
+	// can be converted into each other. All extensions include the
+	// leading ".".
+	DataAssetExts = []string{".json", ".yaml", ".yml", ".toml", ".csv", ".tsv", ".ndjson"}
+)
+
+// AssetConversionError is returned when the contents of an asset
+// cannot be converted into the requested format. This is usually
+// caused by malformed source data or by data that has a shape the
+// target format cannot represent.
+type AssetConversionError struct {
+	SourceExt string
+	TargetExt string
+	Err       error
+}
+
+func (e *AssetConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %s to %s: %s", e.SourceExt, e.TargetExt, e.Err)
+}
+
+func (e *AssetConversionError) Unwrap() error {
+	return e.Err
+}
+
+func isDataAssetExt(ext string) bool {
+	for _, e := range DataAssetExts {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeData parses contents in the format indicated by ext into a
+// generic structure, made of maps with string keys, slices and
+// scalars.
+func decodeData(ext string, contents []byte) (interface{}, error) {
+	var data interface{}
+
+	switch ext {
+	case ".json":
+		if err := json.Unmarshal(contents, &data); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(contents, &data); err != nil {
+			return nil, err
+		}
+		// Fixup converted format, otherwise we can't convert to JSON.
+		data = dyno.ConvertMapI2MapS(data)
+	case ".toml":
+		var table map[string]interface{}
+		if err := toml.Unmarshal(contents, &table); err != nil {
+			return nil, err
+		}
+		data = table
+	case ".csv":
+		return decodeRecords(contents, ',')
+	case ".tsv":
+		return decodeRecords(contents, '\t')
+	case ".ndjson":
+		return decodeNDJSON(contents)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", ext)
+	}
+	return data, nil
+}
+
+// encodeData is the counterpart to decodeData.
+func encodeData(ext string, data interface{}) ([]byte, error) {
+	switch ext {
+	case ".json":
+		return json.Marshal(data)
+	case ".yaml", ".yml":
+		return yaml.Marshal(data)
+	case ".toml":
+		if _, ok := data.(map[string]interface{}); !ok {
+			return nil, errors.New("TOML requires a table at the top level")
+		}
+		var buf bytes.Buffer
+		err := toml.NewEncoder(&buf).Encode(data)
+		return buf.Bytes(), err
+	case ".csv":
+		return encodeRecords(data, ',')
+	case ".tsv":
+		return encodeRecords(data, '\t')
+	case ".ndjson":
+		return encodeNDJSON(data)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", ext)
+	}
+}
+
+// decodeRecords parses CSV or TSV, using the first row as the header,
+// into a slice of records. Each record maps the column names to the
+// cell values, which are always strings.
+func decodeRecords(contents []byte, comma rune) (interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(contents))
+	r.Comma = comma
+	if comma == '\t' {
+		r.LazyQuotes = true
+	}
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]interface{}, 0, len(rows))
+
+	if len(rows) == 0 {
+		return records, nil
+	}
+	header := rows[0]
+
+	for _, row := range rows[1:] {
+		record := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			if i < len(row) {
+				record[name] = row[i]
+			} else {
+				record[name] = ""
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// encodeRecords writes a slice of records as CSV or TSV. The header
+// row is formed by the sorted union of all record keys. Non-scalar
+// cell values are encoded as JSON.
+func encodeRecords(data interface{}, comma rune) ([]byte, error) {
+	rows, ok := data.([]interface{})
+	if !ok {
+		return nil, errors.New("tabular formats require an array of records")
+	}
+
+	seen := make(map[string]bool)
+	header := make([]string, 0)
+
+	records := make([]map[string]interface{}, 0, len(rows))
+	for i, row := range rows {
+		record, ok := row.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %d is not an object", i)
+		}
+		for k := range record {
+			if !seen[k] {
+				seen[k] = true
+				header = append(header, k)
+			}
+		}
+		records = append(records, record)
+	}
+	sort.Strings(header)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		cells := make([]string, 0, len(header))
+
+		for _, k := range header {
+			cell, err := formatCell(record[k])
+			if err != nil {
+				return nil, err
+			}
+			cells = append(cells, cell)
+		}
+		if err := w.Write(cells); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func formatCell(v interface{}) (string, error) {
+	switch tv := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return tv, nil
+	case map[string]interface{}, []interface{}:
+		b, err := json.Marshal(tv)
+		return string(b), err
+	default:
+		return fmt.Sprint(tv), nil
+	}
+}
+
+// decodeNDJSON parses newline delimited JSON into a slice, holding
+// one element per non-empty line.
+func decodeNDJSON(contents []byte) (interface{}, error) {
+	values := make([]interface{}, 0)
+
+	s := bufio.NewScanner(bytes.NewReader(contents))
+	s.Buffer(make([]byte, 0, 64*1024), len(contents)+1)
+
+	var line int
+	for s.Scan() {
+		line++
+
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(s.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		values = append(values, v)
+	}
+	return values, s.Err()
+}
+
+// encodeNDJSON writes each element of a slice on its own line, any
+// other value is written as a single line.
+func encodeNDJSON(data interface{}) ([]byte, error) {
+	values, ok := data.([]interface{})
+	if !ok {
+		values = []interface{}{data}
+	}
+
+	var buf bytes.Buffer
+	for _, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
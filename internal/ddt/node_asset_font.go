@@ -0,0 +1,524 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Compressed font data is decompressed up to this size. Even large
+// CJK fonts stay well below it, while a small crafted file may
+// otherwise decompress to gigabytes.
+const fontMaxDecompressedSize = 64 << 20
+
+var (
+	errFontMalformed = errors.New("malformed font file")
+
+	// Tags known to WOFF2, indexed by their flag value. See:
+	// https://www.w3.org/TR/WOFF2/#table_dir_format
+	woff2KnownTags = []string{
+		"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+		"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+		"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+		"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+		"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+		"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+		"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+		"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+	}
+)
+
+// Font holds information about a font, as read from the font file's
+// name, OS/2 and cmap tables.
+type Font struct {
+	Family    string
+	Subfamily string
+
+	// Weight as defined by the usWeightClass, usually a multiple of
+	// 100, i.e. 400 for regular and 700 for bold.
+	Weight int
+
+	Italic bool
+
+	Version string
+	License string
+
+	// Format of the font file: "truetype", "opentype", "woff" or
+	// "woff2". Matches the CSS @font-face format hint.
+	Format string
+
+	// UnicodeRanges are the ranges of code points the font has
+	// glyphs for, in CSS unicode-range syntax, i.e. "U+0020-007E".
+	UnicodeRanges []string
+}
+
+// Style returns the CSS font style.
+func (f *Font) Style() string {
+	if f.Italic {
+		return "italic"
+	}
+	return "normal"
+}
+
+func (a NodeAsset) isFont() bool {
+	switch strings.ToLower(filepath.Ext(a.Path)) {
+	case ".ttf", ".otf", ".woff", ".woff2":
+		return true
+	}
+	return false
+}
+
+// Font returns information about the font, when the asset is a font
+// file. "ok" indicates if the format was supported.
+func (a NodeAsset) Font() (bool, *Font, error) {
+	if !a.isFont() {
+		return false, nil, nil
+	}
+	contents, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return true, nil, err
+	}
+
+	format, tables, err := readFontTables(contents, "name", "OS/2", "cmap")
+	if err != nil {
+		return true, nil, fmt.Errorf("failed to read font %s: %s", a.Name(), err)
+	}
+	f := &Font{Format: format}
+
+	if name, ok := tables["name"]; ok {
+		names := parseFontNames(name)
+
+		f.Family = firstNonEmpty(names[16], names[1])
+		f.Subfamily = firstNonEmpty(names[17], names[2])
+		f.Version = strings.TrimSpace(strings.TrimPrefix(names[5], "Version"))
+		f.License = firstNonEmpty(names[13], names[14])
+	}
+	if os2, ok := tables["OS/2"]; ok && len(os2) >= 64 {
+		f.Weight = int(binary.BigEndian.Uint16(os2[4:]))
+
+		fsSelection := binary.BigEndian.Uint16(os2[62:])
+		f.Italic = fsSelection&(1|1<<9) != 0 // ITALIC or OBLIQUE
+	}
+	if cmap, ok := tables["cmap"]; ok {
+		f.UnicodeRanges = formatUnicodeRanges(parseFontCmap(cmap))
+	}
+	return true, f, nil
+}
+
+// readFontTables reads the requested tables from a TrueType,
+// OpenType, WOFF or WOFF2 font. For font collections only the first
+// font is read.
+func readFontTables(b []byte, tags ...string) (string, map[string][]byte, error) {
+	if len(b) < 12 {
+		return "", nil, errFontMalformed
+	}
+	wanted := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		wanted[t] = true
+	}
+
+	switch string(b[0:4]) {
+	case "wOFF":
+		tables, err := readWOFFTables(b, wanted)
+		return "woff", tables, err
+	case "wOF2":
+		tables, err := readWOFF2Tables(b, wanted)
+		return "woff2", tables, err
+	case "ttcf":
+		// The header is followed by the offsets of the fonts.
+		if len(b) < 16 {
+			return "", nil, errFontMalformed
+		}
+		offset := binary.BigEndian.Uint32(b[12:])
+		if int64(offset) >= int64(len(b)) {
+			return "", nil, errFontMalformed
+		}
+		return readSFNTTables(b, int(offset), wanted)
+	default:
+		return readSFNTTables(b, 0, wanted)
+	}
+}
+
+func readSFNTTables(b []byte, start int, wanted map[string]bool) (string, map[string][]byte, error) {
+	if len(b) < start+12 {
+		return "", nil, errFontMalformed
+	}
+	format := "truetype"
+	if string(b[start:start+4]) == "OTTO" {
+		format = "opentype"
+	}
+
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(b[start+4:]))
+
+	for i := 0; i < numTables; i++ {
+		r := start + 12 + i*16
+		if len(b) < r+16 {
+			return format, tables, errFontMalformed
+		}
+		tag := string(b[r : r+4])
+		offset := int(binary.BigEndian.Uint32(b[r+8:]))
+		length := int(binary.BigEndian.Uint32(b[r+12:]))
+
+		if !wanted[tag] {
+			continue
+		}
+		if offset < 0 || length < 0 || offset > len(b) || length > len(b)-offset {
+			return format, tables, errFontMalformed
+		}
+		tables[tag] = b[offset : offset+length]
+	}
+	return format, tables, nil
+}
+
+func readWOFFTables(b []byte, wanted map[string]bool) (map[string][]byte, error) {
+	if len(b) < 44 {
+		return nil, errFontMalformed
+	}
+	tables := make(map[string][]byte)
+	numTables := int(binary.BigEndian.Uint16(b[12:]))
+
+	for i := 0; i < numTables; i++ {
+		r := 44 + i*20
+		if len(b) < r+20 {
+			return tables, errFontMalformed
+		}
+		tag := string(b[r : r+4])
+		offset := int(binary.BigEndian.Uint32(b[r+4:]))
+		compLength := int(binary.BigEndian.Uint32(b[r+8:]))
+		origLength := int(binary.BigEndian.Uint32(b[r+12:]))
+
+		if !wanted[tag] {
+			continue
+		}
+		if offset < 0 || compLength < 0 || offset > len(b) || compLength > len(b)-offset {
+			return tables, errFontMalformed
+		}
+		data := b[offset : offset+compLength]
+
+		if compLength < origLength {
+			if origLength > fontMaxDecompressedSize {
+				return tables, errFontMalformed
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return tables, err
+			}
+			data, err = ioutil.ReadAll(io.LimitReader(zr, int64(origLength)+1))
+			zr.Close()
+			if err != nil {
+				return tables, err
+			}
+			if len(data) > origLength {
+				return tables, errFontMalformed
+			}
+		}
+		tables[tag] = data
+	}
+	return tables, nil
+}
+
+// readWOFF2Tables decompresses the font data. The tables we are
+// interested in are never transformed, so we can read them as is.
+func readWOFF2Tables(b []byte, wanted map[string]bool) (map[string][]byte, error) {
+	if len(b) < 48 {
+		return nil, errFontMalformed
+	}
+	if string(b[4:8]) == "ttcf" {
+		return nil, errors.New("WOFF2 font collections are not supported")
+	}
+	numTables := int(binary.BigEndian.Uint16(b[12:]))
+	totalCompressedSize := int(binary.BigEndian.Uint32(b[20:]))
+
+	type entry struct {
+		tag    string
+		length int
+	}
+	entries := make([]entry, 0, numTables)
+
+	r := 48
+	for i := 0; i < numTables; i++ {
+		if r >= len(b) {
+			return nil, errFontMalformed
+		}
+		flags := b[r]
+		r++
+
+		var tag string
+		if flags&0x3f == 0x3f {
+			if r+4 > len(b) {
+				return nil, errFontMalformed
+			}
+			tag = string(b[r : r+4])
+			r += 4
+		} else {
+			tag = woff2KnownTags[flags&0x3f]
+		}
+		version := flags >> 6
+
+		length, n, err := readUIntBase128(b[r:])
+		if err != nil {
+			return nil, err
+		}
+		r += n
+
+		// Only glyf, loca and hmtx have transforms, their null
+		// transform versions differ.
+		isTransformed := version != 0
+		if tag == "glyf" || tag == "loca" {
+			isTransformed = version != 3
+		}
+		if isTransformed {
+			length, n, err = readUIntBase128(b[r:])
+			if err != nil {
+				return nil, err
+			}
+			r += n
+		}
+		entries = append(entries, entry{tag, length})
+	}
+	if totalCompressedSize < 0 || totalCompressedSize > len(b)-r {
+		return nil, errFontMalformed
+	}
+
+	br := brotli.NewReader(bytes.NewReader(b[r : r+totalCompressedSize]))
+	data, err := ioutil.ReadAll(io.LimitReader(br, fontMaxDecompressedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > fontMaxDecompressedSize {
+		return nil, errFontMalformed
+	}
+
+	tables := make(map[string][]byte)
+	offset := 0
+	for _, e := range entries {
+		if e.length > len(data)-offset {
+			return tables, errFontMalformed
+		}
+		if wanted[e.tag] {
+			tables[e.tag] = data[offset : offset+e.length]
+		}
+		offset += e.length
+	}
+	return tables, nil
+}
+
+func readUIntBase128(b []byte) (int, int, error) {
+	var v uint32
+
+	for i := 0; i < 5 && i < len(b); i++ {
+		if i == 0 && b[i] == 0x80 {
+			return 0, 0, errFontMalformed // No leading zeros.
+		}
+		if v&0xfe000000 != 0 {
+			return 0, 0, errFontMalformed // Would overflow.
+		}
+		v = v<<7 | uint32(b[i]&0x7f)
+
+		if b[i]&0x80 == 0 {
+			return int(v), i + 1, nil
+		}
+	}
+	return 0, 0, errFontMalformed
+}
+
+// parseFontNames returns the entries of the name table, keyed by
+// name ID. English Windows entries are preferred over Unicode and
+// Macintosh ones.
+func parseFontNames(b []byte) map[int]string {
+	names := make(map[int]string)
+	priorities := make(map[int]int)
+
+	if len(b) < 6 {
+		return names
+	}
+	count := int(binary.BigEndian.Uint16(b[2:]))
+	storage := int(binary.BigEndian.Uint16(b[4:]))
+
+	for i := 0; i < count; i++ {
+		r := 6 + i*12
+		if len(b) < r+12 {
+			break
+		}
+		platformID := binary.BigEndian.Uint16(b[r:])
+		encodingID := binary.BigEndian.Uint16(b[r+2:])
+		languageID := binary.BigEndian.Uint16(b[r+4:])
+		nameID := int(binary.BigEndian.Uint16(b[r+6:]))
+		length := int(binary.BigEndian.Uint16(b[r+8:]))
+		offset := int(binary.BigEndian.Uint16(b[r+10:]))
+
+		start := storage + offset
+		if start+length > len(b) {
+			continue
+		}
+		raw := b[start : start+length]
+
+		var priority int
+		var value string
+
+		switch {
+		case platformID == 3 && (encodingID == 1 || encodingID == 10):
+			priority = 2
+			if languageID == 0x0409 {
+				priority = 3
+			}
+			value = decodeUTF16BE(raw)
+		case platformID == 0:
+			priority = 1
+			value = decodeUTF16BE(raw)
+		case platformID == 1 && encodingID == 0:
+			priority = 0
+			value = string(raw) // Mac Roman, good enough for ASCII.
+		default:
+			continue
+		}
+		if p, ok := priorities[nameID]; ok && p >= priority {
+			continue
+		}
+		names[nameID] = strings.TrimSpace(value)
+		priorities[nameID] = priority
+	}
+	return names
+}
+
+func decodeUTF16BE(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, binary.BigEndian.Uint16(b[i:]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// parseFontCmap returns the sorted, merged ranges of code points
+// mapped to glyphs. Supports the segment mapping (4) and segmented
+// coverage (12) subtable formats, which cover virtually all
+// Unicode fonts.
+func parseFontCmap(b []byte) [][2]rune {
+	ranges := make([][2]rune, 0)
+
+	if len(b) < 4 {
+		return ranges
+	}
+	numTables := int(binary.BigEndian.Uint16(b[2:]))
+
+	// Prefer the full repertoire subtable (format 12) over the BMP
+	// only one (format 4).
+	var best []byte
+	var bestFormat uint16
+
+	for i := 0; i < numTables; i++ {
+		r := 4 + i*8
+		if len(b) < r+8 {
+			break
+		}
+		platformID := binary.BigEndian.Uint16(b[r:])
+		offset := int(binary.BigEndian.Uint32(b[r+4:]))
+
+		if platformID != 0 && platformID != 3 {
+			continue
+		}
+		if offset+2 > len(b) {
+			continue
+		}
+		format := binary.BigEndian.Uint16(b[offset:])
+		if (format == 4 || format == 12) && format > bestFormat {
+			best = b[offset:]
+			bestFormat = format
+		}
+	}
+
+	switch bestFormat {
+	case 4:
+		if len(best) < 14 {
+			return ranges
+		}
+		segCount := int(binary.BigEndian.Uint16(best[6:])) / 2
+		if len(best) < 16+segCount*8 {
+			return ranges
+		}
+		for i := 0; i < segCount; i++ {
+			end := rune(binary.BigEndian.Uint16(best[14+i*2:]))
+			start := rune(binary.BigEndian.Uint16(best[16+segCount*2+i*2:]))
+			if start == 0xffff {
+				continue // The required last segment.
+			}
+			ranges = append(ranges, [2]rune{start, end})
+		}
+	case 12:
+		if len(best) < 16 {
+			return ranges
+		}
+		numGroups := int(binary.BigEndian.Uint32(best[12:]))
+		for i := 0; i < numGroups; i++ {
+			r := 16 + i*12
+			if len(best) < r+12 {
+				break
+			}
+			start := rune(binary.BigEndian.Uint32(best[r:]))
+			end := rune(binary.BigEndian.Uint32(best[r+4:]))
+			ranges = append(ranges, [2]rune{start, end})
+		}
+	}
+	return mergeRanges(ranges)
+}
+
+func mergeRanges(ranges [][2]rune) [][2]rune {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+
+	merged := [][2]rune{ranges[0]}
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+
+		if r[0] <= last[1]+1 {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+func formatUnicodeRanges(ranges [][2]rune) []string {
+	formatted := make([]string, 0, len(ranges))
+
+	for _, r := range ranges {
+		if r[0] == r[1] {
+			formatted = append(formatted, fmt.Sprintf("U+%04X", r[0]))
+			continue
+		}
+		formatted = append(formatted, fmt.Sprintf("U+%04X-%04X", r[0], r[1]))
+	}
+	return formatted
+}
+
+func firstNonEmpty(vs ...string) string {
+	for _, v := range vs {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
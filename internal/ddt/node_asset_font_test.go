@@ -0,0 +1,231 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/andybalholm/brotli"
+)
+
+// newTestFontTables returns the name, OS/2 and cmap tables of a
+// minimal font.
+func newTestFontTables() map[string][]byte {
+	be := binary.BigEndian
+
+	utf16be := func(s string) []byte {
+		var b bytes.Buffer
+		for _, u := range utf16.Encode([]rune(s)) {
+			binary.Write(&b, be, u)
+		}
+		return b.Bytes()
+	}
+	names := []struct {
+		id    uint16
+		value string
+	}{
+		{1, "Test Sans Bold"},
+		{2, "Italic"},
+		{5, "Version 1.002"},
+		{13, "SIL Open Font License"},
+		{16, "Test Sans"},
+		{17, "Bold Italic"},
+	}
+	var name, storage bytes.Buffer
+	binary.Write(&name, be, []uint16{0, uint16(len(names)), uint16(6 + len(names)*12)})
+	for _, n := range names {
+		v := utf16be(n.value)
+		binary.Write(&name, be, []uint16{3, 1, 0x0409, n.id, uint16(len(v)), uint16(storage.Len())})
+		storage.Write(v)
+	}
+	name.Write(storage.Bytes())
+
+	os2 := make([]byte, 96)
+	be.PutUint16(os2[4:], 700)
+	be.PutUint16(os2[62:], 1) // ITALIC
+
+	var cmap bytes.Buffer
+	binary.Write(&cmap, be, []uint16{0, 1, 3, 10})
+	binary.Write(&cmap, be, uint32(12))
+	groups := [][2]uint32{{0x20, 0x7e}, {0xa0, 0xff}, {0x100, 0x17f}, {0x1f600, 0x1f64f}}
+	binary.Write(&cmap, be, []uint16{12, 0})
+	binary.Write(&cmap, be, []uint32{uint32(16 + len(groups)*12), 0, uint32(len(groups))})
+	for i, g := range groups {
+		binary.Write(&cmap, be, []uint32{g[0], g[1], uint32(i + 1)})
+	}
+
+	return map[string][]byte{
+		"OS/2": os2,
+		"cmap": cmap.Bytes(),
+		"name": name.Bytes(),
+	}
+}
+
+func newTestSFNT(tables map[string][]byte) []byte {
+	be := binary.BigEndian
+	tags := []string{"OS/2", "cmap", "name"}
+
+	var b bytes.Buffer
+	binary.Write(&b, be, uint32(0x00010000))
+	binary.Write(&b, be, []uint16{uint16(len(tags)), 0, 0, 0})
+
+	offset := 12 + len(tags)*16
+	for _, tag := range tags {
+		b.WriteString(tag)
+		binary.Write(&b, be, []uint32{0, uint32(offset), uint32(len(tables[tag]))})
+		offset += len(tables[tag])
+	}
+	for _, tag := range tags {
+		b.Write(tables[tag])
+	}
+	return b.Bytes()
+}
+
+func newTestWOFF2(tables map[string][]byte) []byte {
+	be := binary.BigEndian
+	// Flag values of the known tags, see woff2KnownTags.
+	tags := []struct {
+		tag  string
+		flag byte
+	}{{"cmap", 0}, {"name", 5}, {"OS/2", 6}}
+
+	var data bytes.Buffer
+	bw := brotli.NewWriter(&data)
+	for _, t := range tags {
+		bw.Write(tables[t.tag])
+	}
+	bw.Close()
+
+	var dir bytes.Buffer
+	for _, t := range tags {
+		dir.WriteByte(t.flag)
+		// UIntBase128 with at most two bytes, enough for our tables.
+		l := len(tables[t.tag])
+		if l >= 128 {
+			dir.WriteByte(byte(0x80 | l>>7))
+		}
+		dir.WriteByte(byte(l & 0x7f))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("wOF2")
+	binary.Write(&b, be, uint32(0x00010000))
+	binary.Write(&b, be, uint32(0)) // length
+	binary.Write(&b, be, []uint16{uint16(len(tags)), 0})
+	binary.Write(&b, be, []uint32{0, uint32(data.Len())})
+	b.Write(make([]byte, 24))
+	b.Write(dir.Bytes())
+	b.Write(data.Bytes())
+	return b.Bytes()
+}
+
+func TestAssetFont(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	tables := newTestFontTables()
+	files := map[string][]byte{
+		"TestSans-BoldItalic.ttf":   newTestSFNT(tables),
+		"TestSans-BoldItalic.woff2": newTestWOFF2(tables),
+	}
+	expected := &Font{
+		Family:    "Test Sans",
+		Subfamily: "Bold Italic",
+		Weight:    700,
+		Italic:    true,
+		Version:   "1.002",
+		License:   "SIL Open Font License",
+		UnicodeRanges: []string{
+			"U+0020-007E",
+			"U+00A0-017F",
+			"U+1F600-1F64F",
+		},
+	}
+
+	for name, contents := range files {
+		path := filepath.Join(tmp, name)
+		ioutil.WriteFile(path, contents, 0644)
+
+		ok, f, err := NewNodeAsset(path, name, nil).Font()
+		if !ok || err != nil {
+			t.Fatalf("failed to read font %s: %v", name, err)
+		}
+		format := f.Format
+		f.Format = ""
+
+		if !reflect.DeepEqual(f, expected) {
+			t.Errorf("failed to read font %s, got: %+v", name, f)
+		}
+		if filepath.Ext(name) == ".woff2" && format != "woff2" {
+			t.Errorf("failed to detect format of %s, got: %v", name, format)
+		}
+		if filepath.Ext(name) == ".ttf" && format != "truetype" {
+			t.Errorf("failed to detect format of %s, got: %v", name, format)
+		}
+	}
+}
+
+func TestAssetFontIgnoresOtherFiles(t *testing.T) {
+	ok, _, err := NewNodeAsset("/foo/bar.png", "foo/bar.png", nil).Font()
+	if ok || err != nil {
+		t.Errorf("expected non-font asset to be ignored, got: %v, %v", ok, err)
+	}
+}
+
+func TestReadFontTablesMalformed(t *testing.T) {
+	be := binary.BigEndian
+
+	// An SFNT header with a single table directory entry.
+	sfnt := func(offset, length uint32) []byte {
+		var b bytes.Buffer
+		b.Write([]byte{0, 1, 0, 0})
+		binary.Write(&b, be, uint16(1))
+		b.Write(make([]byte, 6))
+		b.WriteString("name")
+		binary.Write(&b, be, uint32(0))
+		binary.Write(&b, be, offset)
+		binary.Write(&b, be, length)
+		return b.Bytes()
+	}
+
+	// A WOFF, whose name table inflates to more than it claims.
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	var woff bytes.Buffer
+	woff.WriteString("wOFF")
+	woff.Write(make([]byte, 8))
+	binary.Write(&woff, be, uint16(1))
+	woff.Write(make([]byte, 30))
+	woff.WriteString("name")
+	binary.Write(&woff, be, uint32(64))
+	binary.Write(&woff, be, uint32(compressed.Len()))
+	binary.Write(&woff, be, uint32(compressed.Len()+1))
+	binary.Write(&woff, be, uint32(0))
+	woff.Write(compressed.Bytes())
+
+	for name, b := range map[string][]byte{
+		"truncated collection": []byte("ttcf00000000"),
+		"collection offset":    append([]byte("ttcf00000000"), 0xff, 0xff, 0xff, 0xff),
+		"table offset":         sfnt(0xffffffff, 4),
+		"table length":         sfnt(12, 0xffffffff),
+		"oversized woff table": woff.Bytes(),
+	} {
+		if _, _, err := readFontTables(b, "name"); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+const (
+	// Path to the embedded preview image inside a Sketch file.
+	sketchPreviewPath = "previews/preview.png"
+
+	// Previews are small images, anything larger is refused.
+	sketchMaxPreviewSize = 16 << 20
+
+	// Path to the metadata of a Sketch file.
+	sketchMetaPath = "meta.json"
+)
+
+// SketchPage is a page inside a Sketch document.
+type SketchPage struct {
+	Name string
+
+	// Names of the artboards on the page, in the order listed by
+	// the file's metadata.
+	Artboards []string
+}
+
+// Subset of the meta.json structure inside a Sketch file, that
+// lists the names of the pages and their artboards. Reading these is
+// much cheaper than reading the page documents.
+type sketchMeta struct {
+	PagesAndArtboards sketchPages `json:"pagesAndArtboards"`
+}
+
+// sketchPages are keyed by their IDs, we keep them in the order they
+// are listed in.
+type sketchPages []*SketchPage
+
+func (ps *sketchPages) UnmarshalJSON(b []byte) error {
+	return decodeObjectInOrder(b, func(v json.RawMessage) error {
+		var p struct {
+			Name      string          `json:"name"`
+			Artboards sketchArtboards `json:"artboards"`
+		}
+		if err := json.Unmarshal(v, &p); err != nil {
+			return err
+		}
+		page := &SketchPage{Name: p.Name, Artboards: make([]string, 0, len(p.Artboards))}
+		page.Artboards = append(page.Artboards, p.Artboards...)
+
+		*ps = append(*ps, page)
+		return nil
+	})
+}
+
+// sketchArtboards are keyed by their IDs, we keep their names in the
+// order they are listed in.
+type sketchArtboards []string
+
+func (as *sketchArtboards) UnmarshalJSON(b []byte) error {
+	return decodeObjectInOrder(b, func(v json.RawMessage) error {
+		var a struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(v, &a); err != nil {
+			return err
+		}
+		*as = append(*as, a.Name)
+		return nil
+	})
+}
+
+func (a NodeAsset) isSketch() bool {
+	return strings.ToLower(path.Ext(a.Path)) == ".sketch"
+}
+
+// SketchPages returns the pages and their artboards, when the asset
+// is a Sketch file. "ok" indicates if the format was supported.
+//
+// Names are read from the file's metadata, which lists symbol masters
+// as artboards, too.
+func (a NodeAsset) SketchPages() (bool, []*SketchPage, error) {
+	pages := make([]*SketchPage, 0)
+
+	if !a.isSketch() {
+		return false, pages, nil
+	}
+	z, err := zip.OpenReader(a.Path)
+	if err != nil {
+		return true, pages, err
+	}
+	defer z.Close()
+
+	for _, f := range z.File {
+		if f.Name != sketchMetaPath {
+			continue
+		}
+		var m sketchMeta
+		if err := readZipJSON(f, &m); err != nil {
+			return true, pages, err
+		}
+		return true, append(pages, m.PagesAndArtboards...), nil
+	}
+	return true, pages, nil
+}
+
+// HasPreview checks whether the asset's format embeds a preview, see
+// Preview(). It only looks at the file's directory and is cheap
+// enough to be used for every asset.
+func (a NodeAsset) HasPreview() (bool, error) {
+	if !a.isSketch() {
+		return false, nil
+	}
+	z, err := zip.OpenReader(a.Path)
+	if err != nil {
+		return false, err
+	}
+	defer z.Close()
+
+	for _, f := range z.File {
+		if f.Name == sketchPreviewPath {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Preview returns an image representing the asset's contents, when
+// the asset's format embeds one. For Sketch files this is a PNG
+// image. "ok" indicates if a preview is available.
+func (a NodeAsset) Preview() (bool, io.ReadSeeker, error) {
+	if !a.isSketch() {
+		return false, nil, nil
+	}
+	z, err := zip.OpenReader(a.Path)
+	if err != nil {
+		return true, nil, err
+	}
+	defer z.Close()
+
+	for _, f := range z.File {
+		if f.Name != sketchPreviewPath {
+			continue
+		}
+		if f.UncompressedSize64 > sketchMaxPreviewSize {
+			return true, nil, fmt.Errorf("preview in %s exceeds %d bytes", a.Path, sketchMaxPreviewSize)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return true, nil, err
+		}
+		defer r.Close()
+
+		// The size in the zip's directory may lie.
+		contents, err := ioutil.ReadAll(io.LimitReader(r, sketchMaxPreviewSize+1))
+		if err != nil {
+			return true, nil, err
+		}
+		if len(contents) > sketchMaxPreviewSize {
+			return true, nil, fmt.Errorf("preview in %s exceeds %d bytes", a.Path, sketchMaxPreviewSize)
+		}
+		return true, bytes.NewReader(contents), nil
+	}
+	return false, nil, nil
+}
+
+func readZipJSON(f *zip.File, v interface{}) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return json.NewDecoder(r).Decode(v)
+}
+
+// decodeObjectInOrder calls fn with the value of each of the JSON
+// object's members, in the order they are listed in.
+func decodeObjectInOrder(b []byte, fn func(v json.RawMessage) error) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+
+	t, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected an object, got: %v", t)
+	}
+	for d.More() {
+		// Skip the key.
+		if _, err := d.Token(); err != nil {
+			return err
+		}
+		var v json.RawMessage
+		if err := d.Decode(&v); err != nil {
+			return err
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
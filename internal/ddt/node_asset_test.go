@@ -7,6 +7,12 @@
 package ddt
 
 import (
+	"archive/zip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -16,3 +22,159 @@ func TestAssetTitlesWithDecomposedFilename(t *testing.T) {
 		t.Errorf("failed to decode name, got %v", a.Title())
 	}
 }
+
+func TestAssetConvertsCSVToJSON(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "palette.csv")
+	ioutil.WriteFile(path, []byte("name,hex\nprimary,#ff0000\nsecondary,#00ff00\n"), 0666)
+
+	a := NewNodeAsset(path, "palette.csv", nil)
+
+	ok, r, err := a.As(".json")
+	if !ok || err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	b, _ := ioutil.ReadAll(r)
+
+	expected := `[{"hex":"#ff0000","name":"primary"},{"hex":"#00ff00","name":"secondary"}]`
+	if string(b) != expected {
+		t.Errorf("unexpected conversion result, got: %s", b)
+	}
+}
+
+func TestAssetConvertsTOMLToYAMLAndBack(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "config.toml")
+	ioutil.WriteFile(path, []byte("title = \"Button\"\n\n[colors]\nprimary = \"#ff0000\"\n"), 0666)
+
+	a := NewNodeAsset(path, "config.toml", nil)
+
+	ok, r, err := a.As(".yaml")
+	if !ok || err != nil {
+		t.Fatalf("failed to convert: %v", err)
+	}
+	b, _ := ioutil.ReadAll(r)
+
+	expected := "colors:\n  primary: '#ff0000'\ntitle: Button\n"
+	if string(b) != expected {
+		t.Errorf("unexpected conversion result, got: %s", b)
+	}
+}
+
+func TestAssetConversionErrors(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "list.json")
+	ioutil.WriteFile(path, []byte(`[1, 2, 3]`), 0666)
+
+	a := NewNodeAsset(path, "list.json", nil)
+
+	// Top-level arrays cannot be represented in TOML.
+	ok, _, err := a.As(".toml")
+	if !ok {
+		t.Fatalf("expected conversion to be supported")
+	}
+	var cerr *AssetConversionError
+	if !errors.As(err, &cerr) {
+		t.Errorf("expected conversion error, got: %v", err)
+	}
+
+	ok, _, _ = a.As(".png")
+	if ok {
+		t.Errorf("expected conversion to PNG to be unsupported")
+	}
+}
+
+func TestAlternateNames(t *testing.T) {
+	names := AlternateNames("palette.json")
+
+	expected := map[string]bool{
+		"palette.yaml":   true,
+		"palette.yml":    true,
+		"palette.toml":   true,
+		"palette.csv":    true,
+		"palette.tsv":    true,
+		"palette.ndjson": true,
+	}
+	if len(names) != len(expected) {
+		t.Errorf("unexpected number of alternate names, got: %v", names)
+	}
+	for _, name := range names {
+		if !expected[name] {
+			t.Errorf("unexpected alternate name: %s", name)
+		}
+	}
+
+	if len(AlternateNames("cat.jpg")) != 0 {
+		t.Errorf("expected no alternate names for images")
+	}
+}
+
+func TestAssetSketchPagesAndPreview(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	path := filepath.Join(tmp, "exploration.sketch")
+	f, _ := os.Create(path)
+	z := zip.NewWriter(f)
+
+	files := map[string]string{
+		"meta.json":            `{"appVersion": "64", "pagesAndArtboards": {"B": {"name": "Page 1", "artboards": {"Z": {"name": "Mobile"}, "Y": {"name": "Desktop"}}}, "A": {"name": "Symbols", "artboards": {}}}}`,
+		"pages/B.json":         `{"name": "Page 1", "layers": "not read"}`,
+		"previews/preview.png": "\x89PNG",
+	}
+	for name, contents := range files {
+		w, _ := z.Create(name)
+		w.Write([]byte(contents))
+	}
+	z.Close()
+	f.Close()
+
+	a := NewNodeAsset(path, "exploration.sketch", nil)
+
+	ok, pages, err := a.SketchPages()
+	if !ok || err != nil {
+		t.Fatalf("failed to read pages: %v", err)
+	}
+	if len(pages) != 2 || pages[0].Name != "Page 1" || pages[1].Name != "Symbols" {
+		t.Fatalf("unexpected pages, got: %#v", pages)
+	}
+	if !reflect.DeepEqual(pages[0].Artboards, []string{"Mobile", "Desktop"}) {
+		t.Errorf("unexpected artboards, got: %v", pages[0].Artboards)
+	}
+
+	ok, r, err := a.Preview()
+	if !ok || err != nil {
+		t.Fatalf("failed to extract preview: %v", err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	if string(b) != "\x89PNG" {
+		t.Errorf("unexpected preview contents, got: %q", b)
+	}
+
+	if ok, err := a.HasPreview(); !ok || err != nil {
+		t.Errorf("expected asset to have a preview: %v", err)
+	}
+	// Previews larger than announced are refused, too.
+	f, _ = os.Create(path)
+	z = zip.NewWriter(f)
+	w, _ := z.CreateRaw(&zip.FileHeader{Name: sketchPreviewPath, Method: zip.Store, CompressedSize64: sketchMaxPreviewSize + 1, UncompressedSize64: 4})
+	w.Write(make([]byte, sketchMaxPreviewSize+1))
+	z.Close()
+	f.Close()
+
+	if _, _, err := a.Preview(); err == nil {
+		t.Errorf("expected oversized preview to fail")
+	}
+
+	ioutil.WriteFile(path, []byte("corrupt"), 0644)
+
+	if ok, err := a.HasPreview(); ok || err == nil {
+		t.Errorf("expected no preview and an error for a corrupt file")
+	}
+}
@@ -11,11 +11,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/microcosm-cc/bluemonday"
-	"github.com/russross/blackfriday/v2"
+	"github.com/rundsk/dsk/internal/config"
 	"golang.org/x/net/html"
 	"golang.org/x/text/unicode/norm"
 )
@@ -24,6 +25,21 @@ import (
 type NodeDoc struct {
 	// Absolute path to the document file.
 	path string
+
+	// Used to look up the Markdown and highlighting configuration,
+	// may be nil.
+	configDB config.DB
+
+	// Component usage is validated against the registry, may be nil.
+	components *ComponentRegistry
+
+	// The node the document belongs to, its meta data is available
+	// to template expressions, may be nil.
+	node *Node
+
+	// Absolute path to the repository root, code snippets may be
+	// embedded from, optional.
+	repoPath string
 }
 
 // Order is a hint for outside sorting mechanisms.
@@ -46,19 +62,110 @@ func (d NodeDoc) Title() string {
 	return removeOrderNumber(strings.TrimSuffix(base, filepath.Ext(base)))
 }
 
+// RenderedNodeDoc is a document, that has been rendered to HTML.
+type RenderedNodeDoc struct {
+	HTML []byte
+
+	// Problems found while rendering, i.e. template expressions
+	// referencing undefined variables.
+	Warnings []*NodeDocWarning
+
+	// Table of Contents, built from the headings of the rendered
+	// HTML, so that its IDs match the ones in the HTML.
+	Toc []*TocEntry
+}
+
 // HTML as parsed from the underlying file. The provided tree prefix
 // and node URL will be used to resolve relative source and node URLs
 // inside the documents, to i.e. make them absolute.
 func (d NodeDoc) HTML(treePrefix string, nodeURL string, nodeGet NodeGetter, nodeSource string) ([]byte, error) {
-	contents, err := ioutil.ReadFile(d.path)
+	r, err := d.Render(treePrefix, nodeURL, nodeGet, nodeSource)
 	if err != nil {
 		return nil, err
 	}
-	dt, err := NewNodeDocTransformer(treePrefix, nodeURL, nodeGet, nodeSource)
+	return r.HTML, nil
+}
+
+// Render renders the document like HTML() does, additionally
+// reporting the problems found while rendering it.
+func (d NodeDoc) Render(treePrefix string, nodeURL string, nodeGet NodeGetter, nodeSource string) (*RenderedNodeDoc, error) {
+	contents, warnings, err := d.html(treePrefix, nodeURL, nodeGet, nodeSource, nil, false)
 	if err != nil {
 		return nil, err
 	}
+	toc, err := tocFromHTML(contents)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderedNodeDoc{HTML: contents, Warnings: warnings, Toc: toc}, nil
+}
+
+// html renders the document, including is the list of documents,
+// that are currently being included, outermost first.
+//
+// When rendering an outline, we only need the headings: code is
+// neither highlighted nor embedded from snippets, and the document
+// isn't sanitized. Fragments of links to other nodes aren't validated
+// either, as that requires rendering the linked documents, which may
+// link back to this one.
+func (d NodeDoc) html(treePrefix string, nodeURL string, nodeGet NodeGetter, nodeSource string, including []string, outline bool) ([]byte, []*NodeDocWarning, error) {
+	warnings := make([]*NodeDocWarning, 0)
+
+	contents, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return nil, warnings, err
+	}
+	dt, err := NewNodeDocTransformer(treePrefix, nodeURL, nodeGet, nodeSource)
+	if err != nil {
+		return nil, warnings, err
+	}
+	dt.skipFragments = outline
+
+	if d.configDB != nil && !outline {
+		if c := d.configDB.Data().Highlight; c != nil && c.Enabled {
+			dt.highlighter = NewHighlighter(c.Style)
+		}
+	}
 
+	switch strings.ToLower(filepath.Ext(d.path)) {
+	case ".md", ".markdown", ".html", ".htm":
+		contents, warnings = d.expandTemplate(contents, nodeURL, nodeGet, nodeSource)
+
+		parsed, err := d.parse(contents)
+		if err != nil {
+			return parsed, warnings, err
+		}
+		if !outline {
+			parsed = d.embedSnippets(parsed, nodeURL, nodeGet)
+		}
+
+		parsed, included := d.transclude(parsed, treePrefix, nodeURL, nodeGet, nodeSource, including, outline)
+
+		processed, err := dt.ProcessHTML(parsed)
+		if err != nil {
+			return processed, warnings, err
+		}
+		processed = insertIncludes(processed, included)
+
+		// Included documents are sanitized again, as part of the
+		// including document, they may be trusted in their own node
+		// but not in this one.
+		if outline {
+			return processed, warnings, nil
+		}
+		if s := d.sanitizer(); s != nil && !s.IsTrusted(nodeURL) {
+			processed, err = s.Sanitize(processed)
+		}
+		return processed, warnings, err
+	case ".txt":
+		html := fmt.Sprintf("<pre>%s</pre>", html.EscapeString(string(contents)))
+		return []byte(html), warnings, nil
+	}
+	return nil, warnings, fmt.Errorf("unsupported format: %s", d.path)
+}
+
+// parse returns the unprocessed HTML of Markdown and HTML documents.
+func (d NodeDoc) parse(contents []byte) ([]byte, error) {
 	switch strings.ToLower(filepath.Ext(d.path)) {
 	case ".md", ".markdown":
 		components := findComponentsInMarkdown(contents)
@@ -68,18 +175,30 @@ func (d NodeDoc) HTML(treePrefix string, nodeURL string, nodeGet NodeGetter, nod
 		if err != nil {
 			return parsed, err
 		}
-
-		parsed = insertComponents(parsed, components)
-		return dt.ProcessHTML(parsed)
+		return insertComponents(parsed, components), nil
 	case ".html", ".htm":
-		return dt.ProcessHTML(contents)
-	case ".txt":
-		html := fmt.Sprintf("<pre>%s</pre>", html.EscapeString(string(contents)))
-		return []byte(html), nil
+		return contents, nil
 	}
 	return nil, fmt.Errorf("unsupported format: %s", d.path)
 }
 
+// sanitizer returns the Sanitizer for the document, nil when
+// sanitization hasn't been enabled.
+func (d NodeDoc) sanitizer() *Sanitizer {
+	if d.configDB == nil {
+		return nil
+	}
+	c := d.configDB.Data().Sanitize
+	if c == nil || !c.Enabled {
+		return nil
+	}
+	var components map[string]*config.ComponentConfig
+	if d.components != nil {
+		components = d.components.All()
+	}
+	return NewSanitizer(c, components)
+}
+
 // Text converted from original file format.
 func (d NodeDoc) CleanText() ([]byte, error) {
 	contents, err := ioutil.ReadFile(d.path)
@@ -123,33 +242,44 @@ func (d NodeDoc) Components() ([]*NodeDocComponent, error) {
 	return components, nil
 }
 
+// ComponentErrors validates the components used in the document
+// against the component registry.
+func (d NodeDoc) ComponentErrors() ([]*ComponentError, error) {
+	if d.components == nil {
+		return make([]*ComponentError, 0), nil
+	}
+	components, err := d.Components()
+	if err != nil {
+		return nil, err
+	}
+	return d.components.Validate(components), nil
+}
+
 // A headline used in the Table of Contents (ToC)
 type TocEntry struct {
+	// ID of the heading element, usable as a URL fragment.
+	ID       string
 	Title    string
 	Children []*TocEntry
 	Level    int
 }
 
-// Generate Table of Contents
-func (d NodeDoc) Toc() ([]*TocEntry, error) {
-	toc := make([]*TocEntry, 0)
-
-	contents, err := ioutil.ReadFile(d.path)
+// Toc generates the Table of Contents of the document, from its
+// outline only. Render() provides it alongside the HTML.
+func (d NodeDoc) Toc(nodeURL string, nodeGet NodeGetter, nodeSource string) ([]*TocEntry, error) {
+	contents, _, err := d.html("", nodeURL, nodeGet, nodeSource, nil, true)
 	if err != nil {
 		return nil, err
 	}
+	return tocFromHTML(contents)
+}
 
-	document := make([]byte, 0)
-	switch strings.ToLower(filepath.Ext(d.path)) {
-	case ".md", ".markdown":
-		document, _ = d.parseMarkdown(contents)
-	case ".html", ".htm":
-		document = contents
-	}
-
-	r := bytes.NewReader(document)
+// tocFromHTML builds the Table of Contents from the headings of the
+// rendered HTML, that have an ID.
+func tocFromHTML(contents []byte) ([]*TocEntry, error) {
+	toc := make([]*TocEntry, 0)
 
-	doc, _ := html.Parse(r)
+	doc, err := html.Parse(bytes.NewReader(contents))
 	if err != nil {
 		return toc, err
 	}
@@ -172,7 +302,20 @@ func (d NodeDoc) Toc() ([]*TocEntry, error) {
 			}
 			title := getTextContent(n)
 
+			var id string
+			for _, a := range n.Attr {
+				if a.Key == "id" {
+					id = a.Val
+				}
+			}
+			// Headings without ID are part of preformatted text,
+			// see addHeadingIDs().
+			if id == "" {
+				return
+			}
+
 			newEntry := &TocEntry{
+				ID:       id,
 				Title:    title,
 				Level:    level,
 				Children: make([]*TocEntry, 0),
@@ -205,20 +348,38 @@ func (d NodeDoc) Toc() ([]*TocEntry, error) {
 	return toc, nil
 }
 
-// Parses Markdown into HTML.
-func (d NodeDoc) parseMarkdown(contents []byte) ([]byte, error) {
-	renderer := blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
-		Flags: blackfriday.CommonHTMLFlags &^ blackfriday.UseXHTML,
-	})
-	extensions := blackfriday.CommonExtensions |
-		blackfriday.Strikethrough | blackfriday.NoEmptyLineBeforeBlock&^
-		blackfriday.HeadingIDs&^blackfriday.DefinitionLists
+// Anchors returns the IDs of all headings in the document, in order.
+func (d NodeDoc) Anchors(nodeURL string, nodeGet NodeGetter, nodeSource string) ([]string, error) {
+	anchors := make([]string, 0)
+
+	toc, err := d.Toc(nodeURL, nodeGet, nodeSource)
+	if err != nil {
+		return anchors, err
+	}
 
-	return blackfriday.Run(
-		contents,
-		blackfriday.WithRenderer(renderer),
-		blackfriday.WithExtensions(extensions),
-	), nil
+	var walk func([]*TocEntry)
+	walk = func(entries []*TocEntry) {
+		for _, e := range entries {
+			anchors = append(anchors, e.ID)
+			walk(e.Children)
+		}
+	}
+	walk(toc)
+
+	return anchors, nil
+}
+
+// Parses Markdown into HTML, using the configured engine.
+func (d NodeDoc) parseMarkdown(contents []byte) ([]byte, error) {
+	var c *config.MarkdownConfig
+	if d.configDB != nil {
+		c = d.configDB.Data().Markdown
+	}
+	r, err := NewMarkdownRenderer(c)
+	if err != nil {
+		return nil, err
+	}
+	return r.Render(contents)
 }
 
 // Extracts components and adds a placeholder instead of it.
@@ -246,9 +407,17 @@ func extractComponents(contents []byte, components []*NodeDocComponent) []byte {
 	return []byte(c)
 }
 
-// Replaces placeholders with components.
+// Replaces placeholders with components. Placeholders with higher IDs
+// are replaced first, so that i.e. "dsk+component+1" doesn't match
+// the beginning of "dsk+component+10".
 func insertComponents(contents []byte, components []*NodeDocComponent) []byte {
-	for _, component := range components {
+	sorted := make([]*NodeDocComponent, len(components))
+	copy(sorted, components)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Id > sorted[j].Id
+	})
+	for _, component := range sorted {
 		contents = bytes.ReplaceAll(contents, []byte(component.Placeholder()), []byte(component.Raw))
 	}
 	return contents
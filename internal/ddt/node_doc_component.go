@@ -8,62 +8,185 @@ package ddt
 
 import (
 	"fmt"
-	"math/rand"
-	"regexp"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
 )
 
-const (
-	maxComponentsPerNodeDoc = 10000
+var (
+	// Elements that cannot have any contents and don't need to be
+	// closed.
+	voidElements = map[string]bool{
+		"area": true, "base": true, "br": true, "col": true, "embed": true,
+		"hr": true, "img": true, "input": true, "link": true, "meta": true,
+		"param": true, "source": true, "track": true, "wbr": true,
+	}
+
+	// Elements whose contents are not parsed, i.e. the <script> we
+	// use to protect the contents of a <CodeBlock>.
+	rawTextElements = map[string]bool{
+		"script": true, "style": true, "textarea": true,
+	}
 )
 
+// NodeDocComponent is a documentation component - or any other HTML
+// element - found in a document. Components form a tree: each
+// component has its nested components as children.
 type NodeDocComponent struct {
-	Id       int // Unique ID
+	// Id is the index of a top-level component in the document, used
+	// to derive a deterministic placeholder.
+	Id int
+
+	// Name is the tag name in its original casing, i.e. "Banner".
+	Name string
+
+	// Props are the component's attributes, with their values
+	// unescaped. Boolean attributes have an empty value.
+	Props map[string]string
+
+	Children []*NodeDocComponent
+
 	Raw      string
 	Level    int // Nesting level
 	Position int // Start position inside document.
 	Length   int // Length of the component code.
-}
 
-func NewNodeDocComponent(raw string, level int, position int) *NodeDocComponent {
-	return &NodeDocComponent{
-		Id:       rand.Intn(maxComponentsPerNodeDoc),
-		Raw:      raw,
-		Level:    level,
-		Position: position,
-		Length:   len(raw),
-	}
+	// Line and Column of the start position, both 1-based. Columns
+	// are counted in characters.
+	Line   int
+	Column int
 }
 
 func (c *NodeDocComponent) Placeholder() string {
 	return fmt.Sprintf("dsk+component+%d", c.Id)
 }
 
-// TODO: Implement
+// isComponentName checks whether the tag name is the one of a
+// documentation component, i.e. <Banner>, or a custom element,
+// i.e. <dsk-code-block>, as opposed to a plain HTML element.
+func isComponentName(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r) || strings.Contains(name, "-")
+}
+
+// Finds documentation components in HTML documents. Plain HTML
+// elements are not considered components, but may contain
+// components.
 func findComponentsInHTML(contents []byte) []*NodeDocComponent {
-	return make([]*NodeDocComponent, 0)
+	found := make([]*NodeDocComponent, 0)
+
+	var walk func(cs []*NodeDocComponent)
+	walk = func(cs []*NodeDocComponent) {
+		for _, c := range cs {
+			if !isComponentName(c.Name) {
+				walk(c.Children)
+				continue
+			}
+			c.Id = len(found)
+			setComponentLevel(c, 0)
+			found = append(found, c)
+		}
+	}
+	walk(newComponentParser(contents).parse(false))
+	return found
 }
 
 // Will find consider anything that looks like HTML a component. We
 // can use this simple approach, as Markdown is the main language in
-// HTML can be embedded but will than be ignored.
+// HTML can be embedded but will than be ignored. Only top-level
+// components are returned, nested components are found in their
+// children.
 func findComponentsInMarkdown(contents []byte) []*NodeDocComponent {
-	c := string(contents)
+	found := newComponentParser(contents).parse(true)
 
-	found := make([]*NodeDocComponent, 0)
+	for i, c := range found {
+		c.Id = i
+		setComponentLevel(c, 0)
+	}
+	return found
+}
 
-	var isConsuming bool
-	var isLookingForTag bool
-	var isCode bool
+func setComponentLevel(c *NodeDocComponent, level int) {
+	c.Level = level
+	for _, child := range c.Children {
+		setComponentLevel(child, level+1)
+	}
+}
 
-	var current strings.Builder
-	var openingTag string
-	var closingTag string
+func newComponentParser(contents []byte) *componentParser {
+	p := &componentParser{
+		c:               string(contents),
+		lineStarts:      []int{0},
+		unclosedRawText: make(map[string]int),
+	}
+	for i := 0; i < len(p.c); i++ {
+		if p.c[i] == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+	return p
+}
 
-	var openingTagPosition int
+// componentParser parses HTML-like component markup. It is lenient:
+// elements that are not closed are treated as if they had no
+// contents and stray closing tags are ignored.
+type componentParser struct {
+	c string
+
+	// Offsets of the first character of each line.
+	lineStarts []int
+
+	// Raw text elements, that have no end tag after the given
+	// position. Prevents us from searching for it over and over
+	// again.
+	unclosedRawText map[string]int
+
+	// The last position we calculated line and column for.
+	last struct {
+		line, pos, column int
+	}
+}
+
+// parse makes a single pass over the contents and returns the
+// top-level elements. Open elements are kept on a stack, an end tag
+// closes the nearest open element with the same name. Any elements
+// opened after it, that haven't been closed, are treated as if they
+// had no contents: their children move up to their parent.
+//
+// In Markdown, code spans and fenced code blocks outside of elements
+// are skipped.
+func (p *componentParser) parse(isMarkdown bool) []*NodeDocComponent {
+	c := p.c
+
+	// All elements in document order, the index of their parent
+	// element at the time they were found and whether they have been
+	// closed. The tree is only assembled at the end, once we know
+	// which elements were never closed.
+	elements := make([]*NodeDocComponent, 0)
+	parents := make([]int, 0)
+	closed := make([]bool, 0)
+
+	// The stack of open elements, by index.
+	open := make([]int, 0)
+
+	add := func(e *NodeDocComponent, isClosed bool) int {
+		parent := -1
+		if len(open) > 0 {
+			parent = open[len(open)-1]
+		}
+		elements = append(elements, e)
+		parents = append(parents, parent)
+		closed = append(closed, isClosed)
+		return len(elements) - 1
+	}
+
+	var isCode bool
 
 	for i := 0; i < len(c); i++ {
-		if c[i] == '`' && (i-1 < 0 || c[i-1] != '\\') {
+		if isMarkdown && len(open) == 0 && c[i] == '`' && (i-1 < 0 || c[i-1] != '\\') {
 			if i+2 < len(c) && c[i+1] == '`' && c[i+2] == '`' {
 				i += 2
 			}
@@ -73,53 +196,249 @@ func findComponentsInMarkdown(contents []byte) []*NodeDocComponent {
 		if isCode {
 			continue
 		}
-		if isConsuming {
-			current.WriteByte(c[i])
-
-			// Decide whether we are ending consumption all together,
-			// or just found the initial tag, which we'll later
-			// need to check if we need to end consumption.
-			if c[i] == '>' {
-				if isLookingForTag {
-					re := regexp.MustCompile(`^<[a-zA-Z0-9]+`)
-
-					openingTag = current.String()
-					closingTag = fmt.Sprintf("%s>", strings.Replace(re.FindString(openingTag), "<", "</", 1))
+		if c[i] != '<' {
+			continue
+		}
+		if strings.HasPrefix(c[i:], "<!--") {
+			i = p.skipComment(i) - 1
+			continue
+		}
 
-					isLookingForTag = false
+		if strings.HasPrefix(c[i:], "</") {
+			name, end, ok := p.parseEndTag(i)
+			if !ok {
+				continue
+			}
+			for k := len(open) - 1; k >= 0; k-- {
+				if !strings.EqualFold(elements[open[k]].Name, name) {
 					continue
 				}
+				p.finish(elements[open[k]], end)
+				closed[open[k]] = true
+				open = open[:k]
 
-				if strings.Contains(current.String(), closingTag) {
-					found = append(found, NewNodeDocComponent(
-						current.String(),
-						0, // Currently finding only top level components.
-						openingTagPosition,
-					))
+				i = end - 1
+				break
+			}
+			continue
+		}
 
-					current.Reset()
-					openingTag = ""
-					closingTag = ""
+		name, props, tagEnd, isSelfClosing, ok := p.parseStartTag(i)
+		if !ok {
+			continue
+		}
+		line, column := p.lineColumn(i)
 
-					isConsuming = false
-					continue
+		e := &NodeDocComponent{
+			Name:     name,
+			Props:    props,
+			Children: make([]*NodeDocComponent, 0),
+			Position: i,
+			Line:     line,
+			Column:   column,
+		}
+		lname := strings.ToLower(name)
+
+		// Assume the element has no contents, until we find its end
+		// tag.
+		p.finish(e, tagEnd)
+
+		switch {
+		case isSelfClosing || voidElements[lname]:
+			add(e, true)
+			i = tagEnd - 1
+		case rawTextElements[lname]:
+			end := p.rawTextEnd(tagEnd, lname)
+			p.finish(e, end)
+			add(e, true)
+			i = end - 1
+		default:
+			open = append(open, add(e, false))
+			i = tagEnd - 1
+		}
+	}
+
+	roots := make([]*NodeDocComponent, 0)
+
+	for k, e := range elements {
+		// Skip over parents that have never been closed, and remember
+		// the result, so later siblings don't have to.
+		parent := parents[k]
+		for parent >= 0 && !closed[parent] {
+			parent = parents[parent]
+		}
+		parents[k] = parent
+
+		if parent < 0 {
+			roots = append(roots, e)
+		} else {
+			elements[parent].Children = append(elements[parent].Children, e)
+		}
+	}
+	return roots
+}
+
+// finish sets the element's code, which ends right before end.
+func (p *componentParser) finish(e *NodeDocComponent, end int) {
+	e.Raw = p.c[e.Position:end]
+	e.Length = end - e.Position
+}
+
+// rawTextEnd returns the position right after the end tag of the raw
+// text element, whose start tag ends at i. When the element isn't
+// closed, it is treated as if it had no contents.
+func (p *componentParser) rawTextEnd(i int, lname string) int {
+	if from, ok := p.unclosedRawText[lname]; ok && from <= i {
+		return i
+	}
+	for k := i; k < len(p.c); k++ {
+		next := strings.Index(p.c[k:], "</")
+		if next < 0 {
+			break
+		}
+		k += next
+
+		name, end, ok := p.parseEndTag(k)
+		if ok && strings.EqualFold(name, lname) {
+			return end
+		}
+	}
+	p.unclosedRawText[lname] = i
+	return i
+}
+
+// parseStartTag parses a start tag, i.e. <Banner title="Hi" open>,
+// and returns the position right after it.
+func (p *componentParser) parseStartTag(i int) (string, map[string]string, int, bool, bool) {
+	c := p.c
+	props := make(map[string]string)
+
+	if i+1 >= len(c) || c[i] != '<' || !isASCIILetter(c[i+1]) {
+		return "", props, i, false, false
+	}
+	j := i + 1
+	for j < len(c) && isNameChar(c[j]) {
+		j++
+	}
+	name := c[i+1 : j]
+
+	// Rules out i.e. autolinks like <https://example.org> and
+	// <hello@example.org>.
+	if j < len(c) && !isSpace(c[j]) && c[j] != '>' && c[j] != '/' {
+		return "", props, i, false, false
+	}
+
+	for j < len(c) {
+		switch {
+		case isSpace(c[j]):
+			j++
+		case c[j] == '>':
+			return name, props, j + 1, false, true
+		case strings.HasPrefix(c[j:], "/>"):
+			return name, props, j + 2, true, true
+		default:
+			start := j
+			for j < len(c) && !isSpace(c[j]) && c[j] != '=' && c[j] != '>' && !strings.HasPrefix(c[j:], "/>") {
+				j++
+			}
+			if start == j {
+				// A lone slash or similar.
+				j++
+				continue
+			}
+			key := c[start:j]
+
+			for j < len(c) && isSpace(c[j]) {
+				j++
+			}
+			if j >= len(c) || c[j] != '=' {
+				props[key] = ""
+				continue
+			}
+			j++
+			for j < len(c) && isSpace(c[j]) {
+				j++
+			}
+			if j >= len(c) {
+				return "", props, i, false, false
+			}
+
+			var value string
+			switch c[j] {
+			case '"', '\'':
+				end := strings.IndexByte(c[j+1:], c[j])
+				if end < 0 {
+					return "", props, i, false, false
+				}
+				value = c[j+1 : j+1+end]
+				j += end + 2
+			default:
+				vstart := j
+				for j < len(c) && !isSpace(c[j]) && c[j] != '>' {
+					j++
 				}
+				value = c[vstart:j]
 			}
-			continue
+			props[key] = html.UnescapeString(value)
 		}
+	}
+	return "", props, i, false, false
+}
 
-		// Start consumption on anything that remotely doesn't look
-		// like Markdown.
-		if c[i] == '<' && c[i+1] != '!' {
-			current.WriteByte(c[i])
+// parseEndTag parses an end tag, i.e. </Banner>, and returns the
+// position right after it.
+func (p *componentParser) parseEndTag(i int) (string, int, bool) {
+	c := p.c
 
-			isConsuming = true
-			isLookingForTag = true
+	j := i + 2
+	for j < len(c) && isNameChar(c[j]) {
+		j++
+	}
+	name := c[i+2 : j]
 
-			openingTagPosition = i
-			continue
-		}
+	for j < len(c) && isSpace(c[j]) {
+		j++
+	}
+	if name == "" || j >= len(c) || c[j] != '>' {
+		return "", i, false
 	}
+	return name, j + 1, true
+}
 
-	return found
+// skipComment returns the position right after the comment at i.
+func (p *componentParser) skipComment(i int) int {
+	end := strings.Index(p.c[i+4:], "-->")
+	if end < 0 {
+		return len(p.c)
+	}
+	return i + 4 + end + 3
+}
+
+func (p *componentParser) lineColumn(i int) (int, int) {
+	line := sort.Search(len(p.lineStarts), func(n int) bool {
+		return p.lineStarts[n] > i
+	})
+	start, column := p.lineStarts[line-1], 1
+
+	// Positions are mostly asked for in ascending order, continue
+	// counting from the last one, if it is on the same line.
+	if p.last.line == line && p.last.pos <= i {
+		start, column = p.last.pos, p.last.column
+	}
+	column += utf8.RuneCountInString(p.c[start:i])
+
+	p.last.line, p.last.pos, p.last.column = line, i, column
+	return line, column
+}
+
+func isASCIILetter(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
+
+func isNameChar(b byte) bool {
+	return isASCIILetter(b) || (b >= '0' && b <= '9') || b == '-' || b == '_' || b == '.'
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
 }
@@ -7,6 +7,9 @@
 package ddt
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -118,3 +121,109 @@ func TestFindInMarkdownLiteralFencedCodeFragment(t *testing.T) {
 		}
 	}
 }
+
+func TestFindInMarkdownNested(t *testing.T) {
+	raw0 := "# Colors\n\n<ColorGroup>\n  <Color color=\"#ff0000\" contrast='AA'>Red</Color>\n  <Color color=\"#00ff00\" isLight />\n  <div><Color color=\"blue\">Blue</Color></div>\n</ColorGroup>\n"
+	result0 := findComponentsInMarkdown([]byte(raw0))
+
+	if len(result0) != 1 {
+		t.Fatalf("Failed number of components mismatch, got: %d", len(result0))
+	}
+	group := result0[0]
+	if group.Name != "ColorGroup" || group.Line != 3 || group.Column != 1 || group.Position != 10 {
+		t.Errorf("Failed to parse group, got: %+v", group)
+	}
+	if group.Raw != raw0[10:len(raw0)-1] {
+		t.Errorf("Failed to find end of group, got: %s", group.Raw)
+	}
+	if len(group.Children) != 3 {
+		t.Fatalf("Failed number of children mismatch, got: %d", len(group.Children))
+	}
+
+	red := group.Children[0]
+	if red.Name != "Color" || red.Level != 1 || red.Line != 4 || red.Column != 3 {
+		t.Errorf("Failed to parse child, got: %+v", red)
+	}
+	if !reflect.DeepEqual(red.Props, map[string]string{"color": "#ff0000", "contrast": "AA"}) {
+		t.Errorf("Failed to parse props, got: %v", red.Props)
+	}
+	green := group.Children[1]
+	if !reflect.DeepEqual(green.Props, map[string]string{"color": "#00ff00", "isLight": ""}) {
+		t.Errorf("Failed to parse self-closing component, got: %v", green.Props)
+	}
+	div := group.Children[2]
+	if len(div.Children) != 1 || div.Children[0].Level != 2 || div.Children[0].Name != "Color" {
+		t.Errorf("Failed to parse deeply nested component, got: %+v", div.Children)
+	}
+}
+
+func TestFindInMarkdownSameNameNested(t *testing.T) {
+	raw0 := "<Banner>outer <Banner>inner</Banner> outer</Banner>"
+	result0 := findComponentsInMarkdown([]byte(raw0))
+
+	if len(result0) != 1 || result0[0].Raw != raw0 {
+		t.Fatalf("Failed to match closing tag of nested same-named component, got: %#v", result0)
+	}
+	if len(result0[0].Children) != 1 || result0[0].Children[0].Raw != "<Banner>inner</Banner>" {
+		t.Errorf("Failed to parse nested child, got: %#v", result0[0].Children)
+	}
+}
+
+func TestFindInMarkdownLoneLessThan(t *testing.T) {
+	raw := []string{
+		"a < b and c > d",
+		"ends with <",
+		"<",
+		"<https://example.org> and <hello@example.org>",
+	}
+	for _, r := range raw {
+		if result := findComponentsInMarkdown([]byte(r)); len(result) != 0 {
+			t.Errorf("Failed to ignore %q, got: %#v", r, result)
+		}
+	}
+}
+
+func TestFindInMarkdownDeterministicIds(t *testing.T) {
+	var raw strings.Builder
+	for i := 0; i < 12; i++ {
+		fmt.Fprintf(&raw, "<Color>%d</Color>\n\n", i)
+	}
+	result := findComponentsInMarkdown([]byte(raw.String()))
+
+	for i, c := range result {
+		if c.Id != i {
+			t.Errorf("Failed to assign sequential ID, got: %d, expected: %d", c.Id, i)
+		}
+	}
+
+	// Placeholder 1 is a prefix of placeholder 10 and 11.
+	extracted := extractComponents([]byte(raw.String()), result)
+	if inserted := insertComponents(extracted, result); string(inserted) != raw.String() {
+		t.Errorf("Failed to restore components, got: %s", inserted)
+	}
+}
+
+func TestFindInHTML(t *testing.T) {
+	raw0 := `<!-- <Banner>commented</Banner> -->
+<div class="intro">
+  <p>Intro</p>
+  <Banner type="warning">Hi <dsk-badge>new</dsk-badge></Banner>
+</div>
+<script>var x = "<Banner>";</script>
+<dsk-code-block>echo</dsk-code-block>`
+
+	result0 := findComponentsInHTML([]byte(raw0))
+
+	if len(result0) != 2 {
+		t.Fatalf("Failed number of components mismatch, got: %#v", result0)
+	}
+	if result0[0].Name != "Banner" || result0[0].Props["type"] != "warning" || result0[0].Line != 4 {
+		t.Errorf("Failed to parse component, got: %+v", result0[0])
+	}
+	if len(result0[0].Children) != 1 || result0[0].Children[0].Name != "dsk-badge" {
+		t.Errorf("Failed to parse nested custom element, got: %+v", result0[0].Children)
+	}
+	if result0[1].Name != "dsk-code-block" || result0[1].Id != 1 {
+		t.Errorf("Failed to parse custom element, got: %+v", result0[1])
+	}
+}
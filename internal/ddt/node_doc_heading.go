@@ -0,0 +1,300 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// Explicit heading IDs, given at the end of the heading text,
+	// i.e. "## Usage {#usage}". Usually these are already handled
+	// by the Markdown engine, but not when the engine has the
+	// extension disabled or in HTML documents.
+	headingCustomIDRegexp = regexp.MustCompile(`\s*\{#([^\s{}]+)\}\s*$`)
+)
+
+// isHeading checks whether the tag name is one of the headings we
+// generate IDs for and include in the ToC.
+func isHeading(name string) bool {
+	switch name {
+	case "h1", "h2", "h3", "h4", "h5":
+		return true
+	}
+	return false
+}
+
+// isPreformatted checks whether the - lower cased - tag name is one
+// of the elements, that contain code, i.e. <CodeBlock>.
+func isPreformatted(name string) bool {
+	switch name {
+	case "pre", "code", "codeblock":
+		return true
+	}
+	return false
+}
+
+// slugify turns heading text into a fragment identifier, i.e. "Do's
+// and Don'ts" into "dos-and-donts". Letters of all scripts are
+// retained, so that non-latin headings result in readable IDs.
+func slugify(text string) string {
+	var b strings.Builder
+	var isDash bool
+
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			isDash = false
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			if !isDash && b.Len() > 0 {
+				b.WriteRune('-')
+				isDash = true
+			}
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+	if slug == "" {
+		return "section"
+	}
+	return slug
+}
+
+// headingIDs ensures IDs are unique inside a single document, by
+// appending a counter to already seen IDs.
+type headingIDs map[string]bool
+
+func (ids headingIDs) unique(id string) string {
+	candidate := id
+	for i := 1; ids[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", id, i)
+	}
+	ids[candidate] = true
+	return candidate
+}
+
+// addHeadingIDs adds an "id" attribute to all headings outside of
+// preformatted text, that don't have one already. IDs are derived from the heading text and are
+// stable as long as the text and the order of same-titled headings
+// don't change.
+//
+// Explicit IDs are kept as given. Derived IDs must not collide with
+// any of them, even with those of headings further down, so these are
+// collected first.
+func addHeadingIDs(contents []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	ids := make(headingIDs)
+	collectHeadingIDs(contents, ids)
+
+	// While inside a heading, we collect the raw tokens, as we
+	// can only write the start tag, once we know the text.
+	var heading *html.Token
+	var inner [][]byte
+	var text strings.Builder
+
+	// Headings inside preformatted text are code examples.
+	var preDepth int
+
+	z := html.NewTokenizer(bytes.NewReader(contents))
+	for {
+		tt := z.Next()
+
+		if tt == html.ErrorToken {
+			err := z.Err()
+
+			if heading != nil {
+				// Unclosed heading, write out as is.
+				buf.WriteString(heading.String())
+				buf.Write(bytes.Join(inner, nil))
+			}
+			if err == io.EOF {
+				return buf.Bytes(), nil
+			}
+			return buf.Bytes(), err
+		}
+
+		// Keep the casing of component tag names intact, see
+		// NodeDocTransformer.ProcessHTML().
+		raw := append([]byte(nil), z.Raw()...)
+		t := z.Token()
+
+		if isPreformatted(t.Data) {
+			if tt == html.StartTagToken {
+				preDepth++
+			} else if tt == html.EndTagToken && preDepth > 0 {
+				preDepth--
+			}
+		}
+
+		if heading != nil {
+			if tt == html.EndTagToken && t.Data == heading.Data {
+				var id string
+
+				// Strip explicit ID from the heading text, it is
+				// always found in the last non-empty token.
+				for i := len(inner) - 1; i >= 0; i-- {
+					if len(bytes.TrimSpace(inner[i])) == 0 {
+						continue
+					}
+					if m := headingCustomIDRegexp.FindSubmatchIndex(inner[i]); m != nil {
+						id = string(inner[i][m[2]:m[3]])
+						inner[i] = inner[i][:m[0]]
+					}
+					break
+				}
+				if id == "" {
+					id = ids.unique(slugify(text.String()))
+				}
+				heading.Attr = append(heading.Attr, html.Attribute{Key: "id", Val: id})
+
+				buf.WriteString(heading.String())
+				buf.Write(bytes.Join(inner, nil))
+				buf.Write(raw)
+
+				heading = nil
+				inner = nil
+				text.Reset()
+				continue
+			}
+			if tt == html.TextToken {
+				text.WriteString(t.Data)
+			}
+			inner = append(inner, raw)
+			continue
+		}
+
+		if tt == html.StartTagToken && isHeading(t.Data) && preDepth == 0 {
+			var hasID bool
+			for _, a := range t.Attr {
+				if a.Key == "id" && a.Val != "" {
+					ids[a.Val] = true
+					hasID = true
+				}
+			}
+			if !hasID {
+				heading = &t
+				continue
+			}
+		}
+		buf.Write(raw)
+	}
+}
+
+// collectHeadingIDs adds the IDs of all headings outside of
+// preformatted text to ids, including the explicit IDs given at the
+// end of the heading text.
+func collectHeadingIDs(contents []byte, ids headingIDs) {
+	var preDepth int
+
+	// The heading we are inside of, and its last non-empty token,
+	// see addHeadingIDs().
+	var heading string
+	var last []byte
+
+	z := html.NewTokenizer(bytes.NewReader(contents))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return
+		}
+		raw := append([]byte(nil), z.Raw()...)
+		t := z.Token()
+
+		if heading != "" {
+			if tt == html.EndTagToken && t.Data == heading {
+				if m := headingCustomIDRegexp.FindSubmatch(last); m != nil {
+					ids[string(m[1])] = true
+				}
+				heading = ""
+				last = nil
+			} else if len(bytes.TrimSpace(raw)) > 0 {
+				last = raw
+			}
+			continue
+		}
+
+		if isPreformatted(t.Data) {
+			if tt == html.StartTagToken {
+				preDepth++
+			} else if tt == html.EndTagToken && preDepth > 0 {
+				preDepth--
+			}
+		}
+		if tt == html.StartTagToken && isHeading(t.Data) && preDepth == 0 {
+			var hasID bool
+			for _, a := range t.Attr {
+				if a.Key == "id" && a.Val != "" {
+					ids[a.Val] = true
+					hasID = true
+				}
+			}
+			if !hasID {
+				heading = t.Data
+			}
+		}
+	}
+}
+
+// uniqueHeadingIDs renames the IDs of headings outside of
+// preformatted text, that are already in ids, by appending a
+// counter. All IDs are added to ids.
+func uniqueHeadingIDs(contents []byte, ids headingIDs) ([]byte, error) {
+	var buf bytes.Buffer
+	var preDepth int
+
+	z := html.NewTokenizer(bytes.NewReader(contents))
+	for {
+		tt := z.Next()
+
+		if tt == html.ErrorToken {
+			err := z.Err()
+			if err == io.EOF {
+				return buf.Bytes(), nil
+			}
+			return buf.Bytes(), err
+		}
+
+		// Keep the casing of component tag names intact, see
+		// NodeDocTransformer.ProcessHTML().
+		raw := append([]byte(nil), z.Raw()...)
+		t := z.Token()
+
+		if isPreformatted(t.Data) {
+			if tt == html.StartTagToken {
+				preDepth++
+			} else if tt == html.EndTagToken && preDepth > 0 {
+				preDepth--
+			}
+		}
+
+		if tt == html.StartTagToken && isHeading(t.Data) && preDepth == 0 {
+			var renamed bool
+
+			for i, a := range t.Attr {
+				if a.Key != "id" || a.Val == "" {
+					continue
+				}
+				if id := ids.unique(a.Val); id != a.Val {
+					t.Attr[i].Val = id
+					renamed = true
+				}
+			}
+			if renamed {
+				buf.WriteString(t.String())
+				continue
+			}
+		}
+		buf.Write(raw)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	expected := map[string]string{
+		"Usage":                 "usage",
+		"  Do's and Don'ts  ":   "dos-and-donts",
+		"Colors & Typography":   "colors-typography",
+		"Größe":                 "größe",
+		"snake_case-and  space": "snake-case-and-space",
+		"!!!":                   "section",
+	}
+	for text, e := range expected {
+		if r := slugify(text); r != e {
+			t.Errorf("failed to slugify %q, expected: %s, got: %s", text, e, r)
+		}
+	}
+}
+
+func TestAddHeadingIDs(t *testing.T) {
+	expected := map[string]string{
+		"<h2>Usage</h2><h3>Usage</h3>":                          `<h2 id="usage">Usage</h2><h3 id="usage-1">Usage</h3>`,
+		"<h2>Usage {#how-to}</h2>":                              `<h2 id="how-to">Usage</h2>`,
+		"<h2 id=\"usage\">Usage</h2><h2>Usage</h2>":             `<h2 id="usage">Usage</h2><h2 id="usage-1">Usage</h2>`,
+		"<h2>Using <em>Buttons</em></h2>":                       `<h2 id="using-buttons">Using <em>Buttons</em></h2>`,
+		"<h6>Too deep</h6>":                                     `<h6>Too deep</h6>`,
+		"<CodeBlock><h1>Example</h1></CodeBlock><h1>A</h1>":     `<CodeBlock><h1>Example</h1></CodeBlock><h1 id="a">A</h1>`,
+		"<h2>Usage</h2><h2 id=\"usage\">Usage</h2>":             `<h2 id="usage-1">Usage</h2><h2 id="usage">Usage</h2>`,
+		"<h2>Usage</h2><h2>Usage</h2><h2>Usage {#usage-1}</h2>": `<h2 id="usage">Usage</h2><h2 id="usage-2">Usage</h2><h2 id="usage-1">Usage</h2>`,
+	}
+	for h, e := range expected {
+		r, err := addHeadingIDs([]byte(h))
+		if err != nil {
+			t.Fatalf("failed to add heading IDs: %s", err)
+		}
+		if string(r) != e {
+			t.Errorf("\nexpected input : %s\nto parse to    : %s\nbut got instead: %s", h, e, r)
+		}
+	}
+}
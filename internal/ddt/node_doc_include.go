@@ -0,0 +1,364 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Documents including documents, that include documents, ... must
+// stop somewhere.
+const maxIncludeDepth = 8
+
+// NodeDocInclude is an <Include> found in a document, together with
+// the document it references.
+type NodeDocInclude struct {
+	Component *NodeDocComponent
+
+	// The node and the document the "src" prop resolved to.
+	Node *Node
+	Doc  *NodeDoc
+
+	// The ID of the heading whose section should be included, when
+	// empty the whole document is included.
+	Fragment string
+}
+
+// Includes returns all <Include>s found in the document, resolving
+// the referenced documents relative to the node with the given URL.
+// Includes that cannot be resolved are skipped.
+func (d NodeDoc) Includes(nodeURL string, nodeGet NodeGetter) ([]*NodeDocInclude, error) {
+	includes := make([]*NodeDocInclude, 0)
+
+	components, err := d.Components()
+	if err != nil {
+		return includes, err
+	}
+	for _, c := range findIncludes(components) {
+		i, err := resolveInclude(c, nodeURL, nodeGet)
+		if err != nil {
+			continue
+		}
+		includes = append(includes, i)
+	}
+	return includes, nil
+}
+
+// transclude replaces the <Include>s inside the parsed HTML with
+// placeholders and renders the referenced documents. Once the HTML
+// has been processed, the rendered documents are inserted using
+// insertIncludes(). Each included document is processed on its own,
+// so that its relative links are resolved from its own node.
+func (d NodeDoc) transclude(parsed []byte, treePrefix string, nodeURL string, nodeGet NodeGetter, nodeSource string, including []string, outline bool) ([]byte, map[string][]byte) {
+	rendered := make(map[string][]byte)
+
+	includes := findIncludes(findComponentsInHTML(parsed))
+	if len(includes) == 0 {
+		return parsed, rendered
+	}
+	including = append(including, d.path)
+
+	// Replace from the back, so that positions stay valid.
+	sort.Slice(includes, func(i, j int) bool {
+		return includes[i].Position > includes[j].Position
+	})
+	for k, c := range includes {
+		placeholder := fmt.Sprintf("<!--dsk+include+%d-->", k)
+
+		contents, err := d.renderInclude(c, treePrefix, nodeURL, nodeGet, nodeSource, including, outline)
+		if err != nil {
+			log.Printf("Failed to include %s in %s: %s", c.Props["src"], prettyDocPath(d.path), err)
+			contents = []byte(fmt.Sprintf("<!-- Failed to include %s: %s -->", html.EscapeString(c.Props["src"]), html.EscapeString(err.Error())))
+		}
+		rendered[placeholder] = contents
+
+		start, end := c.Position, c.Position+c.Length
+
+		// Markdown wraps an <Include> on a line of its own into a
+		// paragraph, which must not contain the included blocks.
+		if bytes.HasSuffix(parsed[:start], []byte("<p>")) && bytes.HasPrefix(parsed[end:], []byte("</p>")) {
+			start -= len("<p>")
+			end += len("</p>")
+		}
+
+		var b bytes.Buffer
+		b.Write(parsed[:start])
+		b.WriteString(placeholder)
+		b.Write(parsed[end:])
+		parsed = b.Bytes()
+	}
+	return parsed, rendered
+}
+
+func (d NodeDoc) renderInclude(c *NodeDocComponent, treePrefix string, nodeURL string, nodeGet NodeGetter, nodeSource string, including []string, outline bool) ([]byte, error) {
+	i, err := resolveInclude(c, nodeURL, nodeGet)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range including {
+		if p == i.Doc.path {
+			return nil, fmt.Errorf("cycle detected, %s is already being included", prettyDocPath(p))
+		}
+	}
+	if len(including) >= maxIncludeDepth {
+		return nil, fmt.Errorf("includes are nested more than %d levels deep", maxIncludeDepth)
+	}
+
+	// Warnings are reported for the included document itself.
+	contents, _, err := i.Doc.html(treePrefix, i.Node.URL(), nodeGet, nodeSource, including, outline)
+	if err != nil {
+		return nil, err
+	}
+	if i.Fragment == "" {
+		return contents, nil
+	}
+	return extractSection(contents, i.Fragment)
+}
+
+// insertIncludes replaces the placeholders, that have been added by
+// transclude(), with the rendered documents. Heading IDs of included
+// documents, that are already used by the including document or by
+// a preceding included document, are made unique.
+func insertIncludes(contents []byte, rendered map[string][]byte) []byte {
+	if len(rendered) == 0 {
+		return contents
+	}
+	ids := make(headingIDs)
+	collectHeadingIDs(contents, ids)
+
+	// In order of appearance, so that the same headings receive the
+	// same IDs on each rendering.
+	placeholders := make([]string, 0, len(rendered))
+	for placeholder := range rendered {
+		placeholders = append(placeholders, placeholder)
+	}
+	sort.Slice(placeholders, func(i, j int) bool {
+		return bytes.Index(contents, []byte(placeholders[i])) < bytes.Index(contents, []byte(placeholders[j]))
+	})
+
+	for _, placeholder := range placeholders {
+		r, err := uniqueHeadingIDs(rendered[placeholder], ids)
+		if err != nil {
+			r = rendered[placeholder]
+		}
+		contents = bytes.Replace(contents, []byte(placeholder), r, 1)
+	}
+	return contents
+}
+
+// findIncludes finds all <Include> components, they may be nested
+// inside other components, but not inside preformatted text, where
+// they are an example.
+func findIncludes(components []*NodeDocComponent) []*NodeDocComponent {
+	found := make([]*NodeDocComponent, 0)
+
+	for _, c := range components {
+		if c.Name == "Include" {
+			found = append(found, c)
+			continue
+		}
+		if isPreformatted(strings.ToLower(c.Name)) {
+			continue
+		}
+		found = append(found, findIncludes(c.Children)...)
+	}
+	return found
+}
+
+// resolveInclude resolves the "src" prop of an <Include>. It
+// references a document relative to the node with the given URL,
+// i.e. "../Shared/a11y.md", or relative to the tree root, when it
+// starts with a slash. An optional fragment selects a section of the
+// document.
+func resolveInclude(c *NodeDocComponent, nodeURL string, nodeGet NodeGetter) (*NodeDocInclude, error) {
+	src, ok := c.Props["src"]
+	if !ok || src == "" {
+		return nil, fmt.Errorf("<Include> on line %d is missing the src prop", c.Line)
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if u.IsAbs() || u.Host != "" {
+		return nil, fmt.Errorf("only documents of the tree can be included, not: %s", src)
+	}
+
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(nodeURL, p)
+	}
+	dir, file := path.Split(strings.TrimPrefix(path.Clean(p), "/"))
+
+	ok, n, err := nodeGet(strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no node %s", dir)
+	}
+	docs, err := n.Docs()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		base := norm.NFC.String(filepath.Base(d.path))
+
+		if strings.EqualFold(base, file) || strings.EqualFold(d.Name(), file) {
+			return &NodeDocInclude{
+				Component: c,
+				Node:      n,
+				Doc:       d,
+				Fragment:  u.Fragment,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("no document %s in node %s", file, n.URL())
+}
+
+// extractSection returns the section of the document starting with
+// the heading identified by id, up to the next heading of the same
+// or a higher level. The heading itself is part of the section.
+func extractSection(contents []byte, id string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// The level of the section's heading, 0 while we haven't
+	// found the heading yet.
+	var level int
+
+	// Try the exact ID first, then its slug form, see
+	// NodeDocTransformer.resolveFragment().
+	for _, candidate := range []string{id, slugify(id)} {
+		z := html.NewTokenizer(bytes.NewReader(contents))
+
+		for {
+			tt := z.Next()
+
+			if tt == html.ErrorToken {
+				if z.Err() != io.EOF {
+					return nil, z.Err()
+				}
+				break
+			}
+			// Keep the casing of component tag names intact, see
+			// NodeDocTransformer.ProcessHTML().
+			raw := append([]byte(nil), z.Raw()...)
+			name, hasAttr := z.TagName()
+
+			if tt == html.StartTagToken && isHeading(string(name)) {
+				l, _ := strconv.Atoi(string(name[1:]))
+
+				if level == 0 && hasAttr && hasID(z, candidate) {
+					level = l
+				} else if level > 0 && l <= level {
+					return buf.Bytes(), nil
+				}
+			}
+			if level > 0 {
+				buf.Write(raw)
+			}
+		}
+		if level > 0 {
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("no section #%s", id)
+}
+
+// hasID checks whether the tag the tokenizer is positioned at has
+// the given ID.
+func hasID(z *html.Tokenizer, id string) bool {
+	for {
+		key, val, more := z.TagAttr()
+		if string(key) == "id" && string(val) == id {
+			return true
+		}
+		if !more {
+			return false
+		}
+	}
+}
+
+// findDependencies finds the nodes whose documents are - directly or
+// indirectly - included by the node's documents, as well as the nodes
+// whose data assets are referenced by template expressions inside
+// these documents.
+func (n *Node) findDependencies(nodeGet NodeGetter) ([]*Node, error) {
+	deps := make([]*Node, 0)
+
+	docs, err := n.Docs()
+	if err != nil {
+		return deps, err
+	}
+
+	type item struct {
+		node *Node
+		doc  *NodeDoc
+	}
+	queue := make([]item, 0, len(docs))
+	for _, d := range docs {
+		queue = append(queue, item{n, d})
+	}
+	seenDocs := make(map[string]bool)
+	seenNodes := map[string]bool{n.Path: true}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		if seenDocs[current.doc.path] {
+			continue
+		}
+		seenDocs[current.doc.path] = true
+
+		assetNodes, err := current.doc.templateAssetNodes(current.node.URL(), nodeGet)
+		if err != nil {
+			return deps, err
+		}
+		for _, an := range assetNodes {
+			if !seenNodes[an.Path] {
+				seenNodes[an.Path] = true
+				deps = append(deps, an)
+			}
+		}
+
+		includes, err := current.doc.Includes(current.node.URL(), nodeGet)
+		if err != nil {
+			return deps, err
+		}
+		for _, i := range includes {
+			if !seenNodes[i.Node.Path] {
+				seenNodes[i.Node.Path] = true
+				deps = append(deps, i.Node)
+			}
+			queue = append(queue, item{i.Node, i.Doc})
+		}
+	}
+	return deps, nil
+}
+
+// Dependencies returns the nodes whose documents are included by
+// the node's documents, or whose data assets the documents reference.
+// Whenever one of them changes, the node's rendered documents change,
+// too.
+func (n *Node) Dependencies() []*Node {
+	return n.dependencies
+}
+
+func prettyDocPath(p string) string {
+	return filepath.Join(filepath.Base(filepath.Dir(p)), filepath.Base(p))
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestIncludeTree(files map[string]string) (string, NodeGetter) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	for f, contents := range files {
+		path := filepath.Join(tmp, f)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		ioutil.WriteFile(path, []byte(contents), 0644)
+	}
+	get := func(url string) (bool, *Node, error) {
+		path := filepath.Join(tmp, url)
+		if _, err := os.Stat(path); err != nil {
+			return false, &Node{}, nil
+		}
+		return true, &Node{root: tmp, Path: path}, nil
+	}
+	return tmp, get
+}
+
+func TestIncludeDocument(t *testing.T) {
+	tmp, get := newTestIncludeTree(map[string]string{
+		"Button/readme.md": "# Button\n\n<Include src=\"../Shared/Notes/02_a11y.md#keyboard\"></Include>\n\nThe end.\n",
+		"Shared/Notes/02_a11y.md": `# Accessibility
+
+## Keyboard
+
+See [focus](../Focus).
+
+### Tab order
+
+Logical.
+
+## Screen readers
+
+Not included.
+`,
+	})
+	defer os.RemoveAll(tmp)
+
+	d := &NodeDoc{path: filepath.Join(tmp, "Button", "readme.md")}
+	r, err := d.HTML("/tree", "Button", get, "test")
+	if err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+	html := string(r)
+
+	if !strings.Contains(html, `<h2 id="keyboard">Keyboard</h2>`) {
+		t.Errorf("expected section heading to be included, got: %s", html)
+	}
+	if !strings.Contains(html, `<h3 id="tab-order">Tab order</h3>`) {
+		t.Errorf("expected sub-sections to be included, got: %s", html)
+	}
+	if strings.Contains(html, "Screen readers") || strings.Contains(html, "Accessibility") {
+		t.Errorf("expected only the section to be included, got: %s", html)
+	}
+	if !strings.Contains(html, `href="/tree/Shared/Focus"`) {
+		t.Errorf("expected links to be resolved from the included document's node, got: %s", html)
+	}
+	if strings.Contains(html, "<p><h2") {
+		t.Errorf("expected include not to be wrapped into a paragraph, got: %s", html)
+	}
+	if !strings.Contains(html, "The end.") {
+		t.Errorf("expected contents after the include to be kept, got: %s", html)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	tmp, get := newTestIncludeTree(map[string]string{
+		"A/readme.md": "A\n\n<Include src=\"../B/readme.md\"></Include>\n",
+		"B/readme.md": "B\n\n<Include src=\"/A/readme.md\"></Include>\n",
+	})
+	defer os.RemoveAll(tmp)
+
+	d := &NodeDoc{path: filepath.Join(tmp, "A", "readme.md")}
+	r, err := d.HTML("/tree", "A", get, "test")
+	if err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+	html := string(r)
+
+	if !strings.Contains(html, "<p>B</p>") {
+		t.Errorf("expected B to be included, got: %s", html)
+	}
+	if !strings.Contains(html, "cycle detected") {
+		t.Errorf("expected cycle to be detected, got: %s", html)
+	}
+}
+
+func TestIncludeDependencies(t *testing.T) {
+	tmp, get := newTestIncludeTree(map[string]string{
+		"A/readme.md":  "<Include src=\"../B/readme.md\"></Include>\n",
+		"B/readme.md":  "<Include src=\"../C/readme.md\"></Include>\n",
+		"C/readme.md":  "<Include src=\"../A/readme.md\"></Include>\n",
+		"D/readme.md":  "```\n<Include src=\"../A/readme.md\"></Include>\n```\n",
+		"E/readme.md":  "<Include src=\"../Unknown/readme.md\"></Include>\n",
+		"E/example.md": "Example",
+		"F/readme.md":  "{{ asset \"../Colors/palette.yml\" \"primary\" }} \\{{ asset \"../G/palette.yml\" }}\n",
+		"Colors/a.yml": "primary: blue\n",
+		"G/b.yml":      "primary: red\n",
+	})
+	defer os.RemoveAll(tmp)
+
+	expected := map[string][]string{
+		"A": {"B", "C"},
+		"D": {},
+		"E": {},
+		"F": {"Colors"},
+	}
+	for url, e := range expected {
+		_, n, _ := get(url)
+
+		deps, err := n.findDependencies(get)
+		if err != nil {
+			t.Fatalf("failed to find dependencies of %s: %s", url, err)
+		}
+		urls := make([]string, 0, len(deps))
+		for _, dep := range deps {
+			urls = append(urls, dep.URL())
+		}
+		if strings.Join(urls, ",") != strings.Join(e, ",") {
+			t.Errorf("unexpected dependencies for %s, got: %v", url, urls)
+		}
+	}
+}
+
+func TestIncludeHeadingIDs(t *testing.T) {
+	tmp, get := newTestIncludeTree(map[string]string{
+		"Button/readme.md": "# Button\n\n## Usage\n\n<Include src=\"../Shared/notes.md\"></Include>\n\n## Details\n",
+		"Shared/notes.md":  "## Usage\n\nShared.\n\n## Details\n",
+		"Select/readme.md": "See [shared details](../Button#Details-1).\n",
+	})
+	defer os.RemoveAll(tmp)
+
+	d := &NodeDoc{path: filepath.Join(tmp, "Button", "readme.md")}
+	r, err := d.Render("/tree", "Button", get, "test")
+	if err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+	html := string(r.HTML)
+
+	expected := []string{"button", "usage", "usage-1", "details-1", "details"}
+	var ids []string
+	var walk func([]*TocEntry)
+	walk = func(entries []*TocEntry) {
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+			if !strings.Contains(html, `id="`+e.ID+`"`) {
+				t.Errorf("expected ToC entry %s to match a heading, got: %s", e.ID, html)
+			}
+			walk(e.Children)
+		}
+	}
+	walk(r.Toc)
+
+	if strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected ToC IDs %v, got: %v", expected, ids)
+	}
+
+	anchors, err := d.Anchors("Button", get, "test")
+	if err != nil {
+		t.Fatalf("failed to get anchors: %s", err)
+	}
+	if strings.Join(anchors, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected anchors %v, got: %v", expected, anchors)
+	}
+
+	// Included headings can be linked to, fragments are resolved
+	// against their unique IDs.
+	l := &NodeDoc{path: filepath.Join(tmp, "Select", "readme.md")}
+	lr, err := l.HTML("/tree", "Select", get, "test")
+	if err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+	if !strings.Contains(string(lr), "#details-1") {
+		t.Errorf("expected fragment to be resolved, got: %s", lr)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/rundsk/dsk/internal/config"
+	"golang.org/x/net/html"
+)
+
+// DefaultURLSchemes are allowed in links and sources, when no schemes
+// have been configured.
+var DefaultURLSchemes = []string{"http", "https", "mailto"}
+
+// Start and end tags, as written by the sanitizer, which always
+// lower cases tag names.
+var sanitizedTagRegexp = regexp.MustCompile(`<(/?)([a-z][a-z0-9-]*)`)
+
+// Documentation components, that are provided by the frontend, and
+// the props they accept. Props are lower case, as that's how they
+// arrive in the frontend.
+var frontendComponents = map[string][]string{
+	"Asciinema":          {"id"},
+	"Banner":             {"title", "type"},
+	"CodeBlock":          {"language", "title", "src"},
+	"CodeSandbox":        {"file", "id", "view"},
+	"Color":              {"color", "id"},
+	"ColorCard":          {"color", "comment", "compact", "id"},
+	"ColorGroup":         {"compact", "src"},
+	"Do":                 {"background", "backgroundcolor", "caption", "strikethrough"},
+	"DoDontGroup":        {"background", "backgroundcolor", "caption", "strikethrough"},
+	"Dont":               {"background", "backgroundcolor", "caption", "strikethrough"},
+	"FigmaEmbed":         {"document", "frame"},
+	"Glitch":             {"file", "id"},
+	"Image":              {"alt", "caption", "height", "src", "width"},
+	"ImageGrid":          {"columns"},
+	"Playground":         {"annotate", "background", "backgroundcolor", "caption", "src"},
+	"TableOfContents":    {"cutofflevel", "level", "src", "title"},
+	"TypographySpecimen": {"sentence", "src"},
+	"Warning":            {"title"},
+}
+
+// NewSanitizer builds a sanitization policy from the configuration,
+// allowing - in addition to safe HTML - the components known to the
+// frontend and the ones declared in the component registry.
+func NewSanitizer(c *config.SanitizeConfig, components map[string]*config.ComponentConfig) *Sanitizer {
+	s := &Sanitizer{
+		policy:  bluemonday.UGCPolicy(),
+		names:   make(map[string]string),
+		trusted: make([]string, 0),
+	}
+	p := s.policy
+
+	// Keep links as they are, documents are not user generated
+	// content in the sense of a comment.
+	p.RequireNoFollowOnLinks(false)
+
+	schemes := DefaultURLSchemes
+	if len(c.URLSchemes) > 0 {
+		schemes = c.URLSchemes
+	}
+	p.AllowURLSchemes(schemes...)
+
+	quoted := make([]string, 0, len(schemes))
+	for _, scheme := range schemes {
+		quoted = append(quoted, regexp.QuoteMeta(scheme))
+	}
+	// Either relative, that is without a scheme, or using an
+	// allowed scheme. The sanitizer only validates URLs of
+	// attributes on HTML elements, but not on components.
+	urls := regexp.MustCompile(fmt.Sprintf(`(?i)^(?:(?:%s):|[^:/?#]*(?:[/?#]|$))`, strings.Join(quoted, "|")))
+
+	// See NodeDocTransformer.maybeAddDataNode() and
+	// NodeDocTransformer.ProcessHTML().
+	p.AllowAttrs("data-node", "data-node-asset").Globally()
+	p.AllowAttrs("class").Matching(bluemonday.SpaceSeparatedTokens).Globally()
+	p.AllowAttrs("data-highlighted").OnElements("codeblock")
+
+	// Heading IDs may contain letters of all scripts, see
+	// addHeadingIDs(), they must survive for the ToC to match.
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^\S+$`)).OnElements("h1", "h2", "h3", "h4", "h5")
+
+	// Media, that may be processed by NodeDocTransformer.maybeSize().
+	p.AllowAttrs("src", "poster").Matching(urls).OnElements("video", "audio", "source")
+	p.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("video")
+	p.AllowAttrs("controls", "autoplay", "loop", "muted", "playsinline").OnElements("video", "audio")
+	p.AllowAttrs("type").OnElements("source")
+
+	// Task lists.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	allow := func(name string, props []string) {
+		lname := strings.ToLower(name)
+		if lname != name {
+			s.names[lname] = name
+		}
+		p.AllowElements(lname)
+		p.AllowNoAttrs().OnElements(lname)
+
+		for _, prop := range props {
+			lprop := strings.ToLower(prop)
+
+			if lprop == "src" || lprop == "href" {
+				p.AllowAttrs(lprop).Matching(urls).OnElements(lname)
+			} else if !strings.HasPrefix(lprop, "on") {
+				p.AllowAttrs(lprop).OnElements(lname)
+			}
+		}
+	}
+	for name, props := range frontendComponents {
+		allow(name, props)
+	}
+	for name, spec := range components {
+		allow(name, spec.Props)
+	}
+	for name, attrs := range c.Elements {
+		allow(name, attrs)
+	}
+
+	for _, t := range c.Trusted {
+		s.trusted = append(s.trusted, normalizeNodeURL(strings.Trim(t, "/")))
+	}
+	return s
+}
+
+// Sanitizer removes unsafe HTML - i.e. <script>s and event handler
+// attributes - from rendered documents.
+type Sanitizer struct {
+	policy *bluemonday.Policy
+
+	// Maps lower cased component names to their original casing,
+	// i.e. "codeblock" to "CodeBlock".
+	names map[string]string
+
+	// Normalized URLs of the nodes, whose documents are trusted.
+	trusted []string
+}
+
+// IsTrusted checks whether the node with the given URL, or one of
+// its ancestors, has been marked as trusted.
+func (s *Sanitizer) IsTrusted(nodeURL string) bool {
+	for _, t := range s.trusted {
+		if t == "" || strings.EqualFold(nodeURL, t) || strings.HasPrefix(strings.ToLower(nodeURL), strings.ToLower(t)+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Sanitize the rendered document.
+//
+// The contents of <CodeBlock>s, that are protected from being
+// interpreted by wrapping them into a <script>, are turned into
+// escaped text: the frontend displays them as text anyway, but a
+// <script> must never survive sanitization.
+func (s *Sanitizer) Sanitize(contents []byte) ([]byte, error) {
+	blocks := findCodeBlocks(findComponentsInHTML(contents))
+
+	// Replace from the back, so that positions stay valid.
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Position > blocks[j].Position
+	})
+	for _, c := range blocks {
+		start, code, ok := splitCodeBlock(c)
+		if !ok {
+			continue
+		}
+		var b bytes.Buffer
+		b.Write(contents[:c.Position])
+		b.WriteString(start)
+		b.WriteString(html.EscapeString(unwrapCodeBlock(code)))
+		b.WriteString("</" + c.Name + ">")
+		b.Write(contents[c.Position+c.Length:])
+		contents = b.Bytes()
+	}
+
+	sanitized := s.policy.SanitizeBytes(contents)
+
+	sanitized = sanitizedTagRegexp.ReplaceAllFunc(sanitized, func(m []byte) []byte {
+		sm := sanitizedTagRegexp.FindSubmatch(m)
+
+		if name, ok := s.names[string(sm[2])]; ok {
+			return []byte("<" + string(sm[1]) + name)
+		}
+		return m
+	})
+	return sanitized, nil
+}
+
+// findCodeBlocks finds the outermost <CodeBlock>s.
+func findCodeBlocks(components []*NodeDocComponent) []*NodeDocComponent {
+	found := make([]*NodeDocComponent, 0)
+
+	for _, c := range components {
+		if c.Name == "CodeBlock" {
+			found = append(found, c)
+			continue
+		}
+		found = append(found, findCodeBlocks(c.Children)...)
+	}
+	return found
+}
+
+// splitCodeBlock splits a <CodeBlock>, whose contents are wrapped
+// into a <script>, into its start tag and contents. Attributes that
+// would make the frontend interpret the contents as HTML are removed
+// from the start tag. ok is false for any other <CodeBlock>.
+func splitCodeBlock(c *NodeDocComponent) (string, string, bool) {
+	z := html.NewTokenizer(strings.NewReader(c.Raw))
+	if z.Next() != html.StartTagToken {
+		return "", "", false
+	}
+	startLength := len(z.Raw())
+	t := z.Token()
+
+	end := "</" + c.Name + ">"
+	if len(c.Raw) < startLength+len(end) || !strings.EqualFold(c.Raw[len(c.Raw)-len(end):], end) {
+		return "", "", false
+	}
+	code := c.Raw[startLength : len(c.Raw)-len(end)]
+
+	if !codeBlockScriptStartRegexp.MatchString(code) || !codeBlockScriptEndRegexp.MatchString(code) {
+		return "", "", false
+	}
+	// There must be a single <script> only, with nothing around it.
+	inner := codeBlockScriptEndRegexp.ReplaceAllString(codeBlockScriptStartRegexp.ReplaceAllString(code, ""), "")
+	if strings.Contains(strings.ToLower(inner), "</script") {
+		return "", "", false
+	}
+
+	attrs := make([]html.Attribute, 0, len(t.Attr))
+	for _, a := range t.Attr {
+		if a.Key != "data-highlighted" && a.Key != "escaped" {
+			attrs = append(attrs, a)
+		}
+	}
+	t.Attr = attrs
+
+	return t.String(), code, true
+}
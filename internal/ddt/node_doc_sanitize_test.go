@@ -0,0 +1,131 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+	"golang.org/x/net/html"
+)
+
+func TestSanitize(t *testing.T) {
+	s := NewSanitizer(&config.SanitizeConfig{
+		Elements: map[string][]string{"iframe": {"src"}},
+	}, map[string]*config.ComponentConfig{
+		"StatusBadge": {Props: []string{"status", "onClick"}},
+	})
+
+	expected := map[string]string{
+		`<p onclick="alert(1)">Hello</p><script>alert(1)</script>`:                                             `<p>Hello</p>`,
+		`<a href="javascript:alert(1)" data-node="Button">Button</a>`:                                          `<a data-node="Button">Button</a>`,
+		`<a href="/tree/Button" data-node="Button">Button</a>`:                                                 `<a href="/tree/Button" data-node="Button">Button</a>`,
+		`<Banner title="Note" onmouseover="alert(1)">Hi</Banner>`:                                              `<Banner title="Note">Hi</Banner>`,
+		`<Image src="javascript:alert(1)" alt="A"></Image>`:                                                    `<Image alt="A"></Image>`,
+		`<StatusBadge status="beta" onclick="alert(1)"></StatusBadge>`:                                         `<StatusBadge status="beta"></StatusBadge>`,
+		`<Unknown>Kept</Unknown>`:                                                                              `Kept`,
+		`<iframe src="https://example.org"></iframe>`:                                                          `<iframe src="https://example.org"></iframe>`,
+		`<CodeBlock title="x"><script>\n<b onclick="x">&</b>\n</script></CodeBlock>`:                           `<CodeBlock title="x">&lt;b onclick=&#34;x&#34;&gt;&amp;&lt;/b&gt;\n</CodeBlock>`,
+		`<CodeBlock data-highlighted="true" escaped><script><img src=x onerror=alert(1)></script></CodeBlock>`: `<CodeBlock>&lt;img src=x onerror=alert(1)&gt;</CodeBlock>`,
+		`<CodeBlock data-highlighted="true"><span class="chroma" onclick="x">a</span></CodeBlock>`:             `<CodeBlock data-highlighted="true"><span class="chroma">a</span></CodeBlock>`,
+		`<CodeBlock><script>a</script><img src=x onerror=alert(1)><script>b</script></CodeBlock>`:              `<CodeBlock><img src="x"></CodeBlock>`,
+	}
+	for html, e := range expected {
+		html = strings.ReplaceAll(html, `\n`, "\n")
+		e = strings.ReplaceAll(e, `\n`, "\n")
+
+		r, err := s.Sanitize([]byte(html))
+		if err != nil {
+			t.Fatalf("failed to sanitize %s: %s", html, err)
+		}
+		if string(r) != e {
+			t.Errorf("\nexpected: %s\nto become: %s\nbut got  : %s", html, e, r)
+		}
+	}
+}
+
+func TestSanitizeCodeBlock(t *testing.T) {
+	s := NewSanitizer(&config.SanitizeConfig{}, nil)
+
+	for _, code := range []string{
+		`<CodeBlock><script>alert(1)</script></CodeBlock>`,
+		`<CodeBlock><script><img src=x onerror=alert(1)></script></CodeBlock>`,
+		`<CodeBlock><script><script>alert(1)</script></script></CodeBlock>`,
+	} {
+		r, err := s.Sanitize([]byte(code))
+		if err != nil {
+			t.Fatalf("failed to sanitize %s: %s", code, err)
+		}
+		// Parse the result, escaped text may still mention both.
+		z := html.NewTokenizer(bytes.NewReader(r))
+		for tt := z.Next(); tt != html.ErrorToken; tt = z.Next() {
+			token := z.Token()
+
+			if token.Type == html.StartTagToken && token.Data == "script" {
+				t.Errorf("expected no <script> to survive in %s, got: %s", code, r)
+			}
+			for _, a := range token.Attr {
+				if a.Key == "onerror" {
+					t.Errorf("expected no event handler to survive in %s, got: %s", code, r)
+				}
+			}
+		}
+	}
+}
+
+func TestSanitizeTrusted(t *testing.T) {
+	s := NewSanitizer(&config.SanitizeConfig{Trusted: []string{"/02_Playground"}}, nil)
+
+	expected := map[string]bool{
+		"Playground":          true,
+		"Playground/Examples": true,
+		"Playgrounds":         false,
+		"Button":              false,
+	}
+	for url, e := range expected {
+		if r := s.IsTrusted(url); r != e {
+			t.Errorf("expected %s to be trusted: %v, got: %v", url, e, r)
+		}
+	}
+}
+
+func TestSanitizeDocument(t *testing.T) {
+	tmp, get := newTestIncludeTree(map[string]string{
+		"Button/readme.md": "# Button\n\n<script>alert(1)</script>\n\n```js\nlet a = '<b>';\n```\n\n<Banner type=\"info\" onclick=\"alert(1)\">Hi</Banner>\n\n<Include src=\"../Shared/notes.md\"></Include>\n",
+		"Shared/notes.md":  "Notes <img src=\"x.png\" onerror=\"alert(1)\">\n\n<CodeBlock><script><script>alert(1)</script></script></CodeBlock>\n",
+	})
+	defer os.RemoveAll(tmp)
+
+	cdb := config.NewStaticDB("Example")
+	cdb.Data().Sanitize.Enabled = true
+
+	d := &NodeDoc{path: filepath.Join(tmp, "Button", "readme.md"), configDB: cdb}
+	r, err := d.HTML("/tree", "Button", get, "test")
+	if err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+	html := string(r)
+
+	if strings.Contains(html, "alert") {
+		t.Errorf("expected scripts and event handlers to be removed, got: %s", html)
+	}
+	if !strings.Contains(html, `<h1 id="button">Button</h1>`) {
+		t.Errorf("expected heading to be kept, got: %s", html)
+	}
+	if !strings.Contains(html, `&lt;b&gt;`) {
+		t.Errorf("expected code to be kept, got: %s", html)
+	}
+	if !strings.Contains(html, `<Banner type="info">Hi</Banner>`) {
+		t.Errorf("expected component to be kept, got: %s", html)
+	}
+	if !strings.Contains(html, `Notes <img src="/tree/Shared/x.png">`) {
+		t.Errorf("expected included document to be kept, got: %s", html)
+	}
+}
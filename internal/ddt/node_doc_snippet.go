@@ -0,0 +1,403 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rundsk/dsk/internal/config"
+	"golang.org/x/net/html"
+)
+
+// Files larger than this are not embedded, they are unlikely to
+// be source code.
+const maxSnippetFileSize = 1 << 20
+
+var (
+	// Region markers, i.e. "// #region props" and "// #endregion",
+	// as used by many editors for code folding.
+	snippetRegionStartRegexp = regexp.MustCompile(`#region\s+([\w-]+)`)
+	snippetRegionEndRegexp   = regexp.MustCompile(`#endregion\b`)
+)
+
+// embedSnippets resolves <CodeBlock>s with a "src" prop on the
+// server side: the code is read from the referenced file and
+// embedded into the code block. Files are looked up as node assets
+// first, then inside the repository root and the paths configured
+// for snippets.
+//
+// The "lines" prop selects lines, i.e. "10-42" or "1-3,7", the
+// "region" prop selects the lines between region markers.
+//
+// Code blocks referencing a node asset without selecting lines are
+// left to the frontend, which fetches the asset on its own.
+func (d NodeDoc) embedSnippets(parsed []byte, nodeURL string, nodeGet NodeGetter) []byte {
+	blocks := findSnippets(findComponentsInHTML(parsed))
+	if len(blocks) == 0 {
+		return parsed
+	}
+
+	// Replace from the back, so that positions stay valid.
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Position > blocks[j].Position
+	})
+	for _, c := range blocks {
+		src := c.Props["src"]
+		lines, hasLines := c.Props["lines"]
+		region, hasRegion := c.Props["region"]
+
+		file, isAsset, err := d.resolveSnippet(src, nodeURL, nodeGet)
+		if err != nil {
+			log.Printf("Failed to embed %s in %s: %s", src, prettyDocPath(d.path), err)
+			continue
+		}
+		if isAsset && !hasLines && !hasRegion {
+			continue
+		}
+
+		code, err := readSnippet(file, lines, region)
+		if err != nil {
+			log.Printf("Failed to embed %s in %s: %s", src, prettyDocPath(d.path), err)
+			continue
+		}
+
+		var b bytes.Buffer
+		b.Write(parsed[:c.Position])
+		writeSnippet(&b, c, file, code)
+		b.Write(parsed[c.Position+c.Length:])
+		parsed = b.Bytes()
+	}
+	return parsed
+}
+
+// snippetFiles returns the files outside of the tree, the document
+// embeds code from.
+func (d NodeDoc) snippetFiles() ([]string, error) {
+	files := make([]string, 0)
+
+	components, err := d.Components()
+	if err != nil {
+		return files, err
+	}
+	for _, c := range findSnippets(components) {
+		if file, err := d.resolveRepoSnippet(c.Props["src"]); err == nil {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// findSnippetFiles finds the files outside of the tree, the node's
+// documents embed code from. These are found once, when the tree is
+// synced, and are part of the node's hash.
+func (n *Node) findSnippetFiles() ([]string, error) {
+	files := make([]string, 0)
+
+	if n.repoPath == "" && !hasSnippetPaths(n.configDB) {
+		return files, nil
+	}
+	docs, err := n.Docs()
+	if err != nil {
+		return files, err
+	}
+	for _, d := range docs {
+		dfiles, err := d.snippetFiles()
+		if err != nil {
+			return files, err
+		}
+		files = append(files, dfiles...)
+	}
+	return files, nil
+}
+
+// findSnippets finds all <CodeBlock>s with a "src" prop.
+func findSnippets(components []*NodeDocComponent) []*NodeDocComponent {
+	found := make([]*NodeDocComponent, 0)
+
+	for _, c := range components {
+		if c.Name == "CodeBlock" {
+			if _, ok := c.Props["src"]; ok {
+				found = append(found, c)
+			}
+			continue
+		}
+		found = append(found, findSnippets(c.Children)...)
+	}
+	return found
+}
+
+// resolveSnippet returns the absolute path to the file referenced by
+// src and whether it is a node asset.
+func (d NodeDoc) resolveSnippet(src string, nodeURL string, nodeGet NodeGetter) (string, bool, error) {
+	if src == "" || strings.Contains(src, "://") {
+		return "", false, fmt.Errorf("not a file")
+	}
+
+	p := src
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(nodeURL, p)
+	}
+	dir, file := path.Split(strings.TrimPrefix(path.Clean(p), "/"))
+
+	ok, n, err := nodeGet(strings.TrimSuffix(dir, "/"))
+	if err != nil {
+		return "", false, err
+	}
+	if ok {
+		ok, a, err := n.Asset(file)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			return a.Path, true, nil
+		}
+	}
+
+	file, err = d.resolveRepoSnippet(src)
+	return file, false, err
+}
+
+// resolveRepoSnippet looks up the file inside the repository root
+// and the configured snippet paths, src is relative to any of them.
+// Hidden files, i.e. inside ".git", cannot be embedded.
+func (d NodeDoc) resolveRepoSnippet(src string) (string, error) {
+	// Rooting the path, before cleaning it, prevents it from
+	// escaping the root directory.
+	p := path.Clean("/" + src)
+
+	for _, segment := range strings.Split(p, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", fmt.Errorf("hidden files cannot be embedded")
+		}
+	}
+
+	for _, root := range d.snippetRoots() {
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		file, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(p)))
+		if err != nil {
+			continue
+		}
+		// Symlinks might point outside the root.
+		if rel, err := filepath.Rel(root, file); err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if info.Size() > maxSnippetFileSize {
+			return "", fmt.Errorf("file is too large")
+		}
+		return file, nil
+	}
+	return "", fmt.Errorf("no such file in repository or snippet paths")
+}
+
+// snippetRoots returns the directories code may be embedded from.
+// As each version of the tree is stored in its own checkout, we
+// always embed the code of the version being viewed.
+func (d NodeDoc) snippetRoots() []string {
+	roots := make([]string, 0)
+
+	if d.repoPath != "" {
+		roots = append(roots, d.repoPath)
+	}
+	if d.configDB == nil {
+		return roots
+	}
+	c := d.configDB.Data().Snippets
+	if c == nil {
+		return roots
+	}
+	for _, p := range c.Paths {
+		if !filepath.IsAbs(p) {
+			if d.node == nil {
+				continue
+			}
+			p = filepath.Join(d.node.root, p)
+		}
+		roots = append(roots, filepath.Clean(p))
+	}
+	return roots
+}
+
+// hasSnippetPaths checks whether additional paths, code may be
+// embedded from, have been configured.
+func hasSnippetPaths(cdb config.DB) bool {
+	if cdb == nil {
+		return false
+	}
+	c := cdb.Data().Snippets
+	return c != nil && len(c.Paths) > 0
+}
+
+// readSnippet reads the file and selects the given lines or region,
+// common indentation is removed.
+func readSnippet(file string, lines string, region string) (string, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	all := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+
+	selected := all
+	if region != "" {
+		if selected, err = selectSnippetRegion(all, region); err != nil {
+			return "", err
+		}
+	}
+	if lines != "" {
+		if selected, err = selectSnippetLines(selected, lines); err != nil {
+			return "", err
+		}
+	}
+	return dedent(selected), nil
+}
+
+// selectSnippetLines selects lines by their 1-based numbers, given as
+// a comma separated list of numbers and ranges. Ranges may be open,
+// i.e. "10-".
+func selectSnippetLines(lines []string, spec string) ([]string, error) {
+	selected := make([]string, 0)
+
+	for _, r := range strings.Split(spec, ",") {
+		r = strings.TrimSpace(r)
+		bounds := strings.SplitN(r, "-", 2)
+
+		start, end := 1, len(lines)
+		var err error
+
+		if bounds[0] != "" {
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid lines: %s", spec)
+			}
+		}
+		if len(bounds) == 1 {
+			end = start
+		} else if bounds[1] != "" {
+			if end, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid lines: %s", spec)
+			}
+		}
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if start < 1 || start > end {
+			return nil, fmt.Errorf("lines %s out of range, file has %d lines", r, len(lines))
+		}
+		selected = append(selected, lines[start-1:end]...)
+	}
+	return selected, nil
+}
+
+// selectSnippetRegion selects the lines between the start and end
+// marker of the named region. Markers of nested regions are removed.
+func selectSnippetRegion(lines []string, name string) ([]string, error) {
+	selected := make([]string, 0)
+
+	// 0 while outside the region, counts nested regions otherwise.
+	var depth int
+
+	for _, l := range lines {
+		if m := snippetRegionStartRegexp.FindStringSubmatch(l); m != nil {
+			if depth > 0 {
+				depth++
+			} else if m[1] == name {
+				depth = 1
+			}
+			continue
+		}
+		if snippetRegionEndRegexp.MatchString(l) {
+			if depth == 1 {
+				return selected, nil
+			}
+			if depth > 0 {
+				depth--
+			}
+			continue
+		}
+		if depth > 0 {
+			selected = append(selected, l)
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("region %s is not closed", name)
+	}
+	return nil, fmt.Errorf("no region %s", name)
+}
+
+// dedent removes the indentation all non-empty lines have in common.
+func dedent(lines []string) string {
+	var indent string
+	var found bool
+
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		current := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+
+		if !found {
+			indent, found = current, true
+			continue
+		}
+		for !strings.HasPrefix(current, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+
+	dedented := make([]string, 0, len(lines))
+	for _, l := range lines {
+		dedented = append(dedented, strings.TrimPrefix(l, indent))
+	}
+	return strings.Join(dedented, "\n")
+}
+
+// writeSnippet writes a <CodeBlock> with the embedded code, the props
+// used for embedding are removed. The code is wrapped in a <script>
+// to protect it from being interpreted as HTML, see
+// unwrapCodeBlock().
+func writeSnippet(w *bytes.Buffer, c *NodeDocComponent, file string, code string) {
+	props := make(map[string]string, len(c.Props))
+	for k, v := range c.Props {
+		props[k] = v
+	}
+	if _, ok := props["title"]; !ok {
+		props["title"] = c.Props["src"]
+	}
+	if _, ok := props["language"]; !ok {
+		if ext := strings.TrimPrefix(filepath.Ext(file), "."); ext != "" {
+			props["language"] = ext
+		}
+	}
+	delete(props, "src")
+	delete(props, "lines")
+	delete(props, "region")
+
+	w.WriteString("<" + c.Name)
+	for _, k := range sortedProps(props) {
+		fmt.Fprintf(w, ` %s="%s"`, k, html.EscapeString(props[k]))
+	}
+	w.WriteString(">")
+
+	// A closing script tag would end our protection early.
+	code = strings.ReplaceAll(code, "</script", `<\/script`)
+
+	fmt.Fprintf(w, "<script>\n%s\n</script></%s>", code, c.Name)
+}
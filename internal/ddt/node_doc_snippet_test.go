@@ -0,0 +1,126 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmbedSnippets(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "repo")
+	defer os.RemoveAll(tmp)
+
+	os.MkdirAll(filepath.Join(tmp, "src"), 0755)
+	os.MkdirAll(filepath.Join(tmp, ".git"), 0755)
+	os.MkdirAll(filepath.Join(tmp, "docs", "Button"), 0755)
+
+	ioutil.WriteFile(filepath.Join(tmp, "src", "button.js"), []byte(`import React from 'react';
+
+function Button(props) {
+    // #region render
+    return (
+        // #region inner
+        <button>{props.children}</button>
+        // #endregion
+    );
+    // #endregion
+}
+`), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, ".git", "config"), []byte("secret"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "docs", "Button", "example.js"), []byte("a\nb\nc\n"), 0644)
+
+	d := &NodeDoc{path: filepath.Join(tmp, "docs", "Button", "readme.md"), repoPath: tmp}
+	get := func(url string) (bool, *Node, error) {
+		if url == "Button" {
+			return true, &Node{root: filepath.Join(tmp, "docs"), Path: filepath.Join(tmp, "docs", "Button")}, nil
+		}
+		return false, &Node{}, nil
+	}
+
+	expected := map[string]string{
+		`<CodeBlock src="src/button.js" lines="3"></CodeBlock>`:                       "<CodeBlock language=\"js\" title=\"src/button.js\"><script>\nfunction Button(props) {\n</script></CodeBlock>",
+		`<CodeBlock src="/src/button.js" region="render" title="Render"></CodeBlock>`: "<CodeBlock language=\"js\" title=\"Render\"><script>\nreturn (\n    <button>{props.children}</button>\n);\n</script></CodeBlock>",
+		`<CodeBlock src="example.js" lines="2-"></CodeBlock>`:                         "<CodeBlock language=\"js\" title=\"example.js\"><script>\nb\nc\n</script></CodeBlock>",
+		`<CodeBlock src="example.js"></CodeBlock>`:                                    `<CodeBlock src="example.js"></CodeBlock>`,
+		`<CodeBlock src="../../.git/config"></CodeBlock>`:                             `<CodeBlock src="../../.git/config"></CodeBlock>`,
+		`<CodeBlock src="../../../etc/passwd" lines="1"></CodeBlock>`:                 `<CodeBlock src="../../../etc/passwd" lines="1"></CodeBlock>`,
+		`<CodeBlock src="src/button.js" lines="20-30"></CodeBlock>`:                   `<CodeBlock src="src/button.js" lines="20-30"></CodeBlock>`,
+	}
+	for html, e := range expected {
+		r := string(d.embedSnippets([]byte(html), "Button", get))
+
+		if r != e {
+			t.Errorf("\nexpected: %s\nto embed: %s\nbut got : %s", html, e, r)
+		}
+	}
+}
+
+func TestSnippetFilesHash(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "repo")
+	defer os.RemoveAll(tmp)
+
+	os.MkdirAll(filepath.Join(tmp, "src"), 0755)
+	os.MkdirAll(filepath.Join(tmp, "docs", "Button"), 0755)
+
+	ioutil.WriteFile(filepath.Join(tmp, "src", "button.js"), []byte("a\nb\n"), 0644)
+	ioutil.WriteFile(filepath.Join(tmp, "docs", "Button", "readme.md"), []byte(`<CodeBlock src="/src/button.js"></CodeBlock>`), 0644)
+
+	n := NewNode(filepath.Join(tmp, "docs", "Button"), filepath.Join(tmp, "docs"), nil, nil, nil)
+	n.repoPath = tmp
+	n.snippetFiles, _ = n.findSnippetFiles()
+
+	if len(n.snippetFiles) != 1 {
+		t.Fatalf("expected 1 snippet file, got: %v", n.snippetFiles)
+	}
+	h, err := n.CalculateHash()
+	if err != nil {
+		t.Fatalf("failed to calculate hash: %s", err)
+	}
+
+	os.Remove(filepath.Join(tmp, "src", "button.js"))
+
+	// Removed after the tree was synced.
+	n = &Node{Path: n.Path, root: n.root, snippetFiles: n.snippetFiles}
+	mh, err := n.CalculateHash()
+	if err != nil {
+		t.Fatalf("expected missing snippet file not to fail hashing: %s", err)
+	}
+	if mh == h {
+		t.Errorf("expected hash to change, when snippet file is missing")
+	}
+}
+
+func TestSelectSnippetLines(t *testing.T) {
+	lines := []string{"1", "2", "3", "4", "5"}
+
+	expected := map[string]string{
+		"2":     "2",
+		"2-3":   "2,3",
+		"4-":    "4,5",
+		"-2":    "1,2",
+		"1,4-5": "1,4,5",
+		"3-99":  "3,4,5",
+	}
+	for spec, e := range expected {
+		r, err := selectSnippetLines(lines, spec)
+		if err != nil {
+			t.Errorf("failed to select %s: %s", spec, err)
+			continue
+		}
+		if strings.Join(r, ",") != e {
+			t.Errorf("expected %s to select %s, got: %v", spec, e, r)
+		}
+	}
+	for _, spec := range []string{"0", "6", "a-b", "3-2"} {
+		if _, err := selectSnippetLines(lines, spec); err == nil {
+			t.Errorf("expected %s to fail", spec)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// Template expressions, i.e. "{{ meta.version }}". Prefixing an
+	// expression with a backslash prevents it from being evaluated.
+	templateExprRegexp = regexp.MustCompile(`(\\)?\{\{\s*(.*?)\s*\}\}`)
+
+	// Variables reference a value by its path, starting with one of
+	// the known roots, i.e. "config.project" or "meta.custom.color".
+	templateVarRegexp = regexp.MustCompile(`^(config|meta|source|version)((?:\.[\w-]+)*)$`)
+
+	// Values from data assets, i.e. asset "palette.yml" "primary".
+	templateAssetRegexp = regexp.MustCompile(`^asset\s+"([^"]+)"(?:\s+"([^"]*)")?$`)
+)
+
+// NodeDocWarning is a problem found while rendering a document, that
+// doesn't prevent the document from being rendered.
+type NodeDocWarning struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (w *NodeDocWarning) Error() string {
+	return fmt.Sprintf("%d:%d: %s", w.Line, w.Column, w.Message)
+}
+
+// expandTemplate evaluates the template expressions inside the
+// document. The syntax is intentionally limited: expressions can
+// only reference values, there are no conditionals or loops.
+//
+// Only expressions starting with a known root are evaluated, any
+// other double curly braces - i.e. inside JSX code examples - are
+// kept as is. Expressions referencing undefined values are replaced
+// with an empty string and reported as warnings.
+func (d NodeDoc) expandTemplate(contents []byte, nodeURL string, nodeGet NodeGetter, nodeSource string) ([]byte, []*NodeDocWarning) {
+	warnings := make([]*NodeDocWarning, 0)
+
+	if !bytes.Contains(contents, []byte("{{")) {
+		return contents, warnings
+	}
+	p := newComponentParser(contents)
+
+	var buf bytes.Buffer
+	var last int
+
+	for _, m := range templateExprRegexp.FindAllSubmatchIndex(contents, -1) {
+		buf.Write(contents[last:m[0]])
+		last = m[1]
+
+		expr := string(contents[m[4]:m[5]])
+
+		if !templateVarRegexp.MatchString(expr) && !templateAssetRegexp.MatchString(expr) {
+			buf.Write(contents[m[0]:m[1]])
+			continue
+		}
+		if m[2] >= 0 {
+			// Escaped, drop the backslash.
+			buf.Write(contents[m[3]:m[1]])
+			continue
+		}
+
+		v, err := d.evalTemplateExpr(expr, nodeURL, nodeGet, nodeSource)
+		if err != nil {
+			line, column := p.lineColumn(m[0])
+			warnings = append(warnings, &NodeDocWarning{
+				Line:    line,
+				Column:  column,
+				Message: fmt.Sprintf("{{ %s }}: %s", expr, err),
+			})
+			continue
+		}
+		buf.WriteString(html.EscapeString(v))
+	}
+	buf.Write(contents[last:])
+
+	return buf.Bytes(), warnings
+}
+
+func (d NodeDoc) evalTemplateExpr(expr string, nodeURL string, nodeGet NodeGetter, nodeSource string) (string, error) {
+	if m := templateAssetRegexp.FindStringSubmatch(expr); m != nil {
+		data, err := d.templateAssetData(m[1], nodeURL, nodeGet)
+		if err != nil {
+			return "", err
+		}
+		return templateValue(data, m[2])
+	}
+
+	m := templateVarRegexp.FindStringSubmatch(expr)
+	key := strings.TrimPrefix(m[2], ".")
+
+	switch m[1] {
+	case "source", "version":
+		if key != "" {
+			return "", fmt.Errorf("undefined variable")
+		}
+		return nodeSource, nil
+	case "config":
+		if d.configDB == nil {
+			return "", fmt.Errorf("undefined variable")
+		}
+		data, err := genericData(d.configDB.Data())
+		if err != nil {
+			return "", err
+		}
+		return templateValue(data, key)
+	case "meta":
+		if d.node == nil {
+			return "", fmt.Errorf("undefined variable")
+		}
+		data, err := genericData(d.node.meta)
+		if err != nil {
+			return "", err
+		}
+		return templateValue(data, key)
+	}
+	return "", fmt.Errorf("undefined variable")
+}
+
+// templateAssetData decodes the data asset, it is looked up relative
+// to the node with the given URL, i.e. "palette.yml" or
+// "../Colors/palette.yml".
+func (d NodeDoc) templateAssetData(name string, nodeURL string, nodeGet NodeGetter) (interface{}, error) {
+	dir, file := path.Split(path.Join(nodeURL, name))
+
+	var n *Node
+	if path.Clean(dir) == path.Clean(nodeURL) && d.node != nil {
+		n = d.node
+	} else {
+		ok, dn, err := nodeGet(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("no node %s", dir)
+		}
+		n = dn
+	}
+
+	ok, a, err := n.Asset(file)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("no asset %s", name)
+	}
+	ext := strings.ToLower(filepath.Ext(a.Path))
+	if !isDataAssetExt(ext) {
+		return nil, fmt.Errorf("asset %s is not a data asset", name)
+	}
+	contents, err := ioutil.ReadFile(a.Path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeData(ext, contents)
+}
+
+// templateAssetNodes finds the nodes, whose data assets are
+// referenced by template expressions in the document, relative to
+// the node with the given URL. References that cannot be resolved
+// are skipped.
+func (d NodeDoc) templateAssetNodes(nodeURL string, nodeGet NodeGetter) ([]*Node, error) {
+	nodes := make([]*Node, 0)
+
+	contents, err := ioutil.ReadFile(d.path)
+	if err != nil {
+		return nodes, err
+	}
+	for _, m := range templateExprRegexp.FindAllSubmatch(contents, -1) {
+		if len(m[1]) > 0 {
+			continue // Escaped.
+		}
+		am := templateAssetRegexp.FindSubmatch(m[2])
+		if am == nil {
+			continue
+		}
+		dir, _ := path.Split(path.Join(nodeURL, string(am[1])))
+
+		ok, n, err := nodeGet(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return nodes, err
+		}
+		if ok {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes, nil
+}
+
+// genericData converts v into a structure of maps, slices and
+// scalars, using the JSON field names.
+func genericData(v interface{}) (interface{}, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var data interface{}
+	return data, json.Unmarshal(j, &data)
+}
+
+// templateValue looks up the dot separated key inside data and
+// formats the value. Elements of lists are referenced by their index.
+func templateValue(data interface{}, key string) (string, error) {
+	v := data
+
+	if key != "" {
+		for _, k := range strings.Split(key, ".") {
+			switch typed := v.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if v, ok = typed[k]; !ok {
+					return "", fmt.Errorf("undefined variable")
+				}
+			case []interface{}:
+				i, err := strconv.Atoi(k)
+				if err != nil || i < 0 || i >= len(typed) {
+					return "", fmt.Errorf("undefined variable")
+				}
+				v = typed[i]
+			default:
+				return "", fmt.Errorf("undefined variable")
+			}
+		}
+	}
+
+	switch typed := v.(type) {
+	case nil:
+		return "", fmt.Errorf("undefined variable")
+	case string:
+		return typed, nil
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), nil
+	case bool, int, int64:
+		return fmt.Sprint(typed), nil
+	}
+	return "", fmt.Errorf("not a scalar value")
+}
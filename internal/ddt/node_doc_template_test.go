@@ -0,0 +1,115 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	os.MkdirAll(filepath.Join(tmp, "Colors"), 0755)
+	ioutil.WriteFile(filepath.Join(tmp, "Colors", "palette.yml"), []byte("primary: \"#0af\"\nshades: [light, dark]\n"), 0644)
+
+	cdb := config.NewStaticDB("Example")
+	n := &Node{
+		root: tmp,
+		Path: filepath.Join(tmp, "Colors"),
+		meta: &NodeMeta{
+			Version: "1.2.0",
+			Custom:  map[string]interface{}{"owner": map[string]interface{}{"team": "Core"}},
+		},
+	}
+	d := &NodeDoc{path: filepath.Join(tmp, "Colors", "readme.md"), configDB: cdb, node: n}
+
+	get := func(url string) (bool, *Node, error) {
+		if url == "Colors" {
+			return true, n, nil
+		}
+		return false, &Node{}, nil
+	}
+
+	expected := map[string]string{
+		"{{ config.project }} {{version}}":                           "Example live",
+		"Version {{ meta.version }} by {{ meta.custom.owner.team }}": "Version 1.2.0 by Core",
+		`{{ asset "palette.yml" "primary" }}`:                        "#0af",
+		`{{ asset "../Colors/palette.yml" "shades.1" }}`:             "dark",
+		"<div style={{color: 'red'}}>{{ message }}</div>":            "<div style={{color: 'red'}}>{{ message }}</div>",
+		`\{{ meta.version }}`:                                        "{{ meta.version }}",
+		"{{ meta.custom.unknown }}!":                                 "!",
+	}
+	for tmpl, e := range expected {
+		r, _ := d.expandTemplate([]byte(tmpl), "Colors", get, "live")
+
+		if string(r) != e {
+			t.Errorf("\nexpected template: %s\nto expand to     : %s\nbut got instead  : %s", tmpl, e, r)
+		}
+	}
+}
+
+func TestExpandTemplateWarnings(t *testing.T) {
+	d := &NodeDoc{path: "/tmp/readme.md", configDB: config.NewStaticDB("Example")}
+	get := func(url string) (bool, *Node, error) {
+		return false, &Node{}, nil
+	}
+
+	_, warnings := d.expandTemplate([]byte("# Title\n\nSee {{ config.unknown }} and {{ config.versions }}."), "", get, "live")
+
+	if len(warnings) != 2 {
+		t.Fatalf("expected 2 warnings, got: %v", warnings)
+	}
+	if warnings[0].Error() != "3:5: {{ config.unknown }}: undefined variable" {
+		t.Errorf("unexpected warning: %s", warnings[0])
+	}
+	if warnings[1].Error() != "3:30: {{ config.versions }}: not a scalar value" {
+		t.Errorf("unexpected warning: %s", warnings[1])
+	}
+}
+
+func TestRenderWarnings(t *testing.T) {
+	tmp, get := newTestIncludeTree(map[string]string{
+		"Button/readme.md": "# Button\n\nSee {{ config.unknown }}.\n",
+	})
+	defer os.RemoveAll(tmp)
+
+	d := &NodeDoc{path: filepath.Join(tmp, "Button", "readme.md"), configDB: config.NewStaticDB("Example")}
+
+	r, err := d.Render("/tree", "Button", get, "live")
+	if err != nil {
+		t.Fatalf("failed to render: %s", err)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0].Error() != "3:5: {{ config.unknown }}: undefined variable" {
+		t.Errorf("unexpected warnings: %v", r.Warnings)
+	}
+	if !strings.Contains(string(r.HTML), "<p>See .</p>") {
+		t.Errorf("unexpected HTML: %s", r.HTML)
+	}
+}
+
+func TestTemplateConfigHash(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	cdb := config.NewStaticDB("Example")
+
+	h, err := NewNode(tmp, tmp, cdb, nil, nil).CalculateHash()
+	if err != nil {
+		t.Fatalf("failed to calculate hash: %s", err)
+	}
+	cdb.Data().Project = "Changed"
+
+	if ch, _ := NewNode(tmp, tmp, cdb, nil, nil).CalculateHash(); ch == h {
+		t.Errorf("expected hash to change with the configuration")
+	}
+}
@@ -208,7 +208,7 @@ hello
 	<h1>Hello Headline</h1>
 </CodeBlock>
 `
-	expected0 := `<h1>Visual Design</h1>
+	expected0 := `<h1 id="visual-design">Visual Design</h1>
 
 <p>The following visual design has been agreed upon by our team:</p>
 
@@ -302,41 +302,50 @@ func TestGenerateToCForMarkdownDocument(t *testing.T) {
 	node := &Node{root: tmp, Path: filepath.Join(tmp, "foo")}
 	docs, _ := node.Docs()
 
-	toc0, _ := docs[0].Toc()
+	toc0, _ := docs[0].Toc(node.URL(), nil, "live")
 
 	expected0 := []*TocEntry{&TocEntry{
+		ID:    "heading-1",
 		Title: "Heading 1",
 		Level: 1,
 		Children: []*TocEntry{&TocEntry{
+			ID:    "heading-2",
 			Title: "Heading 2",
 			Level: 2,
 			Children: []*TocEntry{&TocEntry{
+				ID:       "heading-3",
 				Title:    "Heading 3",
 				Level:    3,
 				Children: make([]*TocEntry, 0),
 			}},
 		}, &TocEntry{
+			ID:       "heading-2-1",
 			Title:    "Heading 2",
 			Level:    2,
 			Children: make([]*TocEntry, 0),
 		}},
 	}, &TocEntry{
+		ID:    "heading-1-1",
 		Title: "Heading 1",
 		Level: 1,
 		Children: []*TocEntry{&TocEntry{
+			ID:       "heading-4",
 			Title:    "Heading 4",
 			Level:    4,
 			Children: make([]*TocEntry, 0),
 		}, &TocEntry{
+			ID:    "heading-2-2",
 			Title: "Heading 2",
 			Level: 2,
 			Children: []*TocEntry{&TocEntry{
+				ID:       "heading-4-1",
 				Title:    "Heading 4",
 				Level:    4,
 				Children: make([]*TocEntry, 0),
 			}},
 		}},
 	}, &TocEntry{
+		ID:       "heading-1-2",
 		Title:    "Heading 1",
 		Level:    1,
 		Children: make([]*TocEntry, 0),
@@ -9,6 +9,7 @@ package ddt
 import (
 	"bytes"
 	"io"
+	"log"
 	"net/url"
 	"path"
 	"strconv"
@@ -30,6 +31,7 @@ func NewNodeDocTransformer(treePrefix string, nodeURL string, nodeGet NodeGetter
 		nodeSource: nodeSource,
 		nodeURL:    nodeURL,
 		nodeGet:    nodeGet,
+		anchors:    make(map[string][]string),
 	}
 	// Append slash to ensure last path element isn't recognized as a file.
 	treeBase, err := url.Parse(path.Join(treePrefix, nodeURL) + "/")
@@ -67,7 +69,14 @@ func NewNodeDocTransformer(treePrefix string, nodeURL string, nodeGet NodeGetter
 //
 // Dimension attributes are added to images of nodes.
 //
+// Headings receive stable IDs, when they don't have one already. Links
+// with fragments referencing a node are validated against the IDs of
+// the headings in the node's documents.
+//
 // HTML inside <code> tags is escaped while preventing double escaping.
+// When a highlighter is configured, code with a language is highlighted
+// instead. Highlighted <CodeBlock>s receive a "data-highlighted"
+// attribute.
 type NodeDocTransformer struct {
 	// i.e. /tree
 	treePrefix string
@@ -86,24 +95,69 @@ type NodeDocTransformer struct {
 
 	// nodeSource is the name of a plex.Source
 	nodeSource string
+
+	// Disables validating fragments of links to nodes, see
+	// NodeDoc.html().
+	skipFragments bool
+
+	// Heading IDs of the documents of linked nodes, by node URL,
+	// so that each node's documents are only rendered once.
+	anchors map[string][]string
+
+	// Optionally highlights fenced code blocks and <CodeBlock>
+	// contents, may be nil.
+	highlighter *Highlighter
 }
 
 // ProcessHTML is the main entry point.
 func (dt NodeDocTransformer) ProcessHTML(contents []byte) ([]byte, error) {
 	var buf bytes.Buffer
 
+	contents, err := addHeadingIDs(contents)
+	if err != nil {
+		return contents, err
+	}
+
 	z := html.NewTokenizer(bytes.NewReader(contents))
 	var isEscaping bool
+
+	// Code collected for highlighting, either inside <code> or
+	// <CodeBlock>.
+	var isHighlighting bool
+	var isHighlightingBlock bool
+	var hlLang string
+	var hlCode strings.Builder
+
+	// Where the start tag of the <CodeBlock> being highlighted begins
+	// in buf, and the tag as found in the document.
+	var hlStart int
+	var hlStartRaw []byte
+
+	highlight := func(code string) error {
+		_, err := dt.highlighter.Highlight(&buf, hlLang, code)
+		hlCode.Reset()
+		return err
+	}
+
 	for {
 		tt := z.Next()
 
 		if tt == html.ErrorToken {
 			err := z.Err()
 
-			if err == io.EOF {
-				return buf.Bytes(), nil
+			if err != io.EOF {
+				return buf.Bytes(), err
+			}
+			// Without an end tag, there is nothing to highlight,
+			// but the code must not get lost.
+			if isHighlightingBlock {
+				buf.Truncate(hlStart)
+				buf.Write(hlStartRaw)
+				buf.WriteString(hlCode.String())
+			} else if isHighlighting {
+				buf.WriteString(html.EscapeString(hlCode.String()))
 			}
-			return buf.Bytes(), err
+			return buf.Bytes(), nil
 		}
 
 		if tt == html.CommentToken || tt == html.DoctypeToken {
@@ -123,9 +177,33 @@ func (dt NodeDocTransformer) ProcessHTML(contents []byte) ([]byte, error) {
 		raw := append([]byte(nil), z.Raw()...)
 		t := z.Token()
 
+		if isHighlightingBlock {
+			if t.Data == "codeblock" && tt == html.EndTagToken {
+				isHighlightingBlock = false
+
+				if err := highlight(unwrapCodeBlock(hlCode.String())); err != nil {
+					return buf.Bytes(), err
+				}
+			} else {
+				hlCode.Write(raw)
+				continue
+			}
+		}
+
 		if isEscaping {
 			if t.Data == "code" && tt == html.EndTagToken {
 				isEscaping = false
+
+				if isHighlighting {
+					isHighlighting = false
+
+					if err := highlight(hlCode.String()); err != nil {
+						return buf.Bytes(), err
+					}
+				}
+			} else if isHighlighting {
+				hlCode.WriteString(html.UnescapeString(string(raw)))
+				continue
 			} else {
 				// Markdown already escapes HTML entities when they
 				// are inside a code block, but doesn't if code was
@@ -195,8 +273,29 @@ func (dt NodeDocTransformer) ProcessHTML(contents []byte) ([]byte, error) {
 				}
 				buf.WriteString(html.UnescapeString(t.String()))
 			}
+		case t.Data == "codeblock" && tt == html.StartTagToken && dt.highlighter != nil:
+			ok, _, lang := dt.attr(t, "language")
+			if !ok || lang == "" {
+				buf.Write(raw)
+				break
+			}
+			isHighlightingBlock = true
+			hlLang = lang
+			hlStart = buf.Len()
+			hlStartRaw = raw
+
+			buf.Write(raw[:len(raw)-1])
+			buf.WriteString(` data-highlighted="true">`)
 		case t.Data == "code" && tt == html.StartTagToken:
 			isEscaping = true
+
+			if dt.highlighter != nil {
+				_, _, class := dt.attr(t, "class")
+				if lang := codeLanguage(class); lang != "" {
+					isHighlighting = true
+					hlLang = lang
+				}
+			}
 			buf.WriteString(t.String())
 		case tt == html.TextToken:
 			buf.Write(raw)
@@ -314,6 +413,11 @@ func (dt NodeDocTransformer) maybeMakeAbsolute(t html.Token, attrName string) (h
 		ok, _, dna := dt.attr(t, "data-node-asset")
 		if ok {
 			dnu.Path = path.Join(dnu.Path, dna)
+		} else if u.Fragment != "" && !dt.skipFragments {
+			dnu.Fragment, err = dt.resolveFragment(dn, u.Fragment)
+			if err != nil {
+				return t, err
+			}
 		}
 
 		t.Attr[key].Val = dnu.String()
@@ -328,6 +432,53 @@ func (dt NodeDocTransformer) maybeMakeAbsolute(t html.Token, attrName string) (h
 	return t, nil
 }
 
+// Validates that the fragment references a heading inside one of
+// the node's documents. Fragments not matching exactly are matched
+// against the heading IDs in their slug form, so that i.e. "#Usage"
+// is rewritten to "#usage". Fragments that cannot be resolved are
+// kept as is.
+func (dt NodeDocTransformer) resolveFragment(dn string, fragment string) (string, error) {
+	anchors, ok := dt.anchors[dn]
+	if !ok {
+		ok, n, err := dt.nodeGet(dn)
+		if !ok || err != nil {
+			return fragment, err
+		}
+		docs, err := n.Docs()
+		if err != nil {
+			// The node might not have a directory of its own, we
+			// cannot validate the fragment, but that's no reason to
+			// fail.
+			return fragment, nil
+		}
+
+		anchors = make([]string, 0)
+		for _, d := range docs {
+			as, err := d.Anchors(n.URL(), dt.nodeGet, dt.nodeSource)
+			if err != nil {
+				return fragment, err
+			}
+			anchors = append(anchors, as...)
+		}
+		if dt.anchors != nil {
+			dt.anchors[dn] = anchors
+		}
+	}
+	for _, a := range anchors {
+		if a == fragment {
+			return fragment, nil
+		}
+	}
+	slug := slugify(fragment)
+	for _, a := range anchors {
+		if a == slug {
+			return a, nil
+		}
+	}
+	log.Printf("Link to node %s references unknown heading: #%s", dn, fragment)
+	return fragment, nil
+}
+
 // Works only for node assets that are images.
 func (dt NodeDocTransformer) maybeSize(t html.Token, attrName string) (html.Token, error) {
 	ok, _, dn := dt.attr(t, "data-node")
@@ -170,3 +170,32 @@ func TestNodeLinksKeepFragmentAndQueryFromOriginal(t *testing.T) {
 		}
 	}
 }
+
+func TestNodeLinksFragmentsAreResolved(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	os.MkdirAll(filepath.Join(tmp, "foo", "bar"), 0777)
+	ioutil.WriteFile(filepath.Join(tmp, "foo", "bar", "readme.md"), []byte("# Button\n\n## Usage\n"), 0666)
+
+	get := func(url string) (bool, *Node, error) {
+		if url == "foo/bar" {
+			return true, &Node{root: tmp, Path: filepath.Join(tmp, url)}, nil
+		}
+		return false, &Node{}, nil
+	}
+	dt, _ := NewNodeDocTransformer("/tree", "foo/baz", get, "test")
+
+	expected := map[string]string{
+		"<a href=\"../bar#usage\"></a>":   "<a href=\"/tree/foo/bar?v=test#usage\" data-node=\"foo/bar\"></a>",
+		"<a href=\"../bar#Usage\"></a>":   "<a href=\"/tree/foo/bar?v=test#usage\" data-node=\"foo/bar\"></a>",
+		"<a href=\"../bar#unknown\"></a>": "<a href=\"/tree/foo/bar?v=test#unknown\" data-node=\"foo/bar\"></a>",
+	}
+	for h, e := range expected {
+		r, _ := dt.ProcessHTML([]byte(h))
+
+		if !reflect.DeepEqual(r, []byte(e)) {
+			t.Errorf("\nexpected input : %s\nto parse to    : %s\nbut got instead: %s", h, e, r)
+		}
+	}
+}
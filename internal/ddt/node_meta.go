@@ -30,10 +30,23 @@ type NodeMeta struct {
 	// Freeform version string.
 	Version string `json:"version,omitempty" yaml:"version,omitempty"`
 
+	// Configures how the node is found by search.
+	Search *NodeSearchMeta `json:"search,omitempty" yaml:"search,omitempty"`
+
 	// Deprecated, will be removed once APIv1 search support is removed.
 	Keywords []string `json:"keywords,omitempty" yaml:"keywords,omitempty"`
 }
 
+// NodeSearchMeta configures how a node is found by search.
+type NodeSearchMeta struct {
+	// Factor the relevance of the node is multiplied by, i.e. 2 to rank the node higher
+	// in search results, defaults to 1.
+	Boost float64 `json:"boost,omitempty" yaml:"boost,omitempty"`
+
+	// Excludes the node from search results, its children are still found.
+	Exclude bool `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+}
+
 func (m *NodeMeta) Create() error {
 	var b []byte
 	var err error
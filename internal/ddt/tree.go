@@ -21,6 +21,7 @@ import (
 	"github.com/rundsk/dsk/internal/bus"
 	"github.com/rundsk/dsk/internal/config"
 	"github.com/rundsk/dsk/internal/meta"
+	"github.com/rundsk/dsk/internal/vcs"
 )
 
 var (
@@ -44,6 +45,19 @@ func NewTree(
 		authorDB: adb,
 		broker:   b,
 	}
+
+	// Code snippets may be embedded from anywhere inside the
+	// repository, the tree is stored in.
+	ok, rroot, rsub, err := vcs.FindRepo(path)
+	if err != nil {
+		log.Print(err)
+	}
+	if ok {
+		t.repoPath = rroot
+		if rsub != "" {
+			t.repoPath = rsub
+		}
+	}
 	return t, t.Sync()
 }
 
@@ -64,12 +78,19 @@ type Tree struct {
 	// The root node and entry point to the acutal tree.
 	Root *Node `json:"root"`
 
+	// Components declared for use in documents.
+	Components *ComponentRegistry
+
 	configDB config.DB
 
 	metaDB meta.DB
 
 	authorDB author.DB
 
+	// Absolute path to the root of the repository containing the
+	// tree, empty if the tree isn't stored in a repository.
+	repoPath string
+
 	// A place where we can send filtered messages to.
 	broker *bus.Broker
 }
@@ -91,6 +112,45 @@ func (t *Tree) CalculateHash() (string, error) {
 	return t.Root.CalculateHash()
 }
 
+// TreeChanges lists the nodes, that changed with a sync. It is
+// provided as the payload of the "tree.synced" message.
+type TreeChanges struct {
+	// URLs of the nodes, that have been added or changed.
+	Changed []string
+
+	// URLs of the nodes, that have been removed.
+	Removed []string
+}
+
+// diffLookups compares the nodes of the previous and the current
+// sync. Previous nodes, whose hash has not been calculated before the
+// sync, are considered changed: calculating it now would already see
+// the changes.
+func diffLookups(prev map[string]*Node, current map[string]*Node) (*TreeChanges, error) {
+	c := &TreeChanges{
+		Changed: make([]string, 0),
+		Removed: make([]string, 0),
+	}
+	for url, n := range current {
+		h, err := n.CalculateHash()
+		if err != nil {
+			return c, err
+		}
+		if pn, ok := prev[url]; ok && pn.cachedHash() == h {
+			continue
+		}
+		c.Changed = append(c.Changed, n.URL())
+	}
+	for url, pn := range prev {
+		if _, ok := current[url]; !ok {
+			c.Removed = append(c.Removed, pn.URL())
+		}
+	}
+	sort.Strings(c.Changed)
+	sort.Strings(c.Removed)
+	return c, nil
+}
+
 // Sync recursively crawls the given root directory, constructing a
 // tree of nodes. Will rebuild the entire tree on every sync. This
 // makes the algorithm really simple - as we don't need to do branch
@@ -114,7 +174,14 @@ func (t *Tree) Sync() error {
 
 	var nodes []*Node
 
-	err := filepath.Walk(t.Path, func(path string, f os.FileInfo, err error) error {
+	// A broken registry must not prevent the tree from syncing, we'll
+	// continue with the components declared in the configuration.
+	components, err := NewComponentRegistry(t.Path, t.configDB)
+	if err != nil {
+		log.Print(err)
+	}
+
+	err = filepath.Walk(t.Path, func(path string, f os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -131,6 +198,8 @@ func (t *Tree) Sync() error {
 				t.metaDB,
 				t.authorDB,
 			)
+			n.components = components
+			n.repoPath = t.repoPath
 
 			if err := n.Load(); err != nil {
 				log.Print(err)
@@ -166,15 +235,50 @@ func (t *Tree) Sync() error {
 	}
 	sort.Strings(ordered)
 
+	// Once all nodes are known, we can resolve the documents our
+	// documents include, and find the files they embed code from. We
+	// cannot use Get(), as we're holding the lock.
+	get := func(url string) (bool, *Node, error) {
+		if n, ok := lookup[lookupNodeURL(url)]; ok {
+			return true, n, nil
+		}
+		return false, &Node{}, nil
+	}
+	for _, n := range nodes {
+		deps, err := n.findDependencies(get)
+		if err != nil {
+			log.Print(err)
+		}
+		n.dependencies = deps
+
+		files, err := n.findSnippetFiles()
+		if err != nil {
+			log.Print(err)
+		}
+		n.snippetFiles = files
+	}
+
+	// Subscribers may update only what changed, i.e. the search
+	// re-indexes only the changed nodes. Without knowing the
+	// changes, they'll have to find them on their own.
+	changes, err := diffLookups(t.lookup, lookup)
+	if err != nil {
+		log.Printf("Failed to find changes of %s: %s", t, err)
+		changes = nil
+	}
+
 	// Swap late, in event of error we keep the previous state.
 	t.lookup = lookup
 	t.ordered = ordered
 	t.Root = lookup[""]
+	t.Components = components
 
 	total := len(lookup)
 	took := time.Since(start)
 
-	defer t.broker.Accept("tree.synced", fmt.Sprintf("%d node/s in %s", total, took))
+	m := bus.NewMessage("tree.synced", fmt.Sprintf("%d node/s in %s", total, took))
+	m.Payload = changes
+	defer t.broker.AcceptMessage(m)
 
 	log.Printf("Synced %s with %d total node/s in %s", t, total, took)
 	return nil
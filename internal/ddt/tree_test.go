@@ -0,0 +1,96 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ddt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rundsk/dsk/internal/author"
+	"github.com/rundsk/dsk/internal/bus"
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/meta"
+)
+
+func TestSyncChanges(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{"Alpha", "Beta", "Gamma"} {
+		os.MkdirAll(filepath.Join(tmp, name), 0755)
+		ioutil.WriteFile(filepath.Join(tmp, name, "readme.md"), []byte("# "+name), 0644)
+	}
+
+	b, _ := bus.NewBroker()
+	defer b.Close()
+	_, messages := b.Subscribe("tree.synced")
+
+	tree, err := NewTree(tmp, config.NewStaticDB("example"), author.NewNoopDB(), meta.NewNoopDB(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Everything changed with the initial sync.
+	<-messages
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(tmp, "Alpha", "readme.md"), later, later)
+	os.RemoveAll(filepath.Join(tmp, "Beta"))
+	os.MkdirAll(filepath.Join(tmp, "Delta"), 0755)
+
+	if err := tree.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-messages:
+		c, ok := m.Payload.(*TreeChanges)
+		if !ok {
+			t.Fatalf("expected changes as payload, got: %v", m.Payload)
+		}
+		if !reflect.DeepEqual(c.Removed, []string{"Beta"}) {
+			t.Errorf("expected Beta to be removed, got: %v", c.Removed)
+		}
+		for _, url := range []string{"Alpha", "Delta"} {
+			if !containsString(c.Changed, url) {
+				t.Errorf("expected %s to be changed, got: %v", url, c.Changed)
+			}
+		}
+		if containsString(c.Changed, "Gamma") {
+			t.Errorf("expected Gamma to be unchanged, got: %v", c.Changed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected tree.synced message")
+	}
+}
+
+func TestCalculateHashCoversDescendants(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	os.MkdirAll(filepath.Join(tmp, "Alpha", "Beta"), 0755)
+
+	b, _ := bus.NewBroker()
+	defer b.Close()
+
+	tree, err := NewTree(tmp, config.NewStaticDB("example"), author.NewNoopDB(), meta.NewNoopDB(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := tree.CalculateHash()
+
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(tmp, "Alpha", "Beta"), later, later)
+	tree.Sync()
+
+	after, _ := tree.CalculateHash()
+	if before == after {
+		t.Errorf("expected a change deep inside the tree to change its hash, got: %s", after)
+	}
+}
@@ -6,14 +6,21 @@
 
 package httputil
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+)
 
 var (
-	Err            = &Error{http.StatusInternalServerError, "Techniker ist informiert"}
-	ErrUnsafePath  = &Error{http.StatusBadRequest, "Directory traversal attempt detected!"}
-	ErrNotFound    = &Error{http.StatusNotFound, "Not found"}
-	ErrNoSuchNode  = &Error{http.StatusNotFound, "No such node"}
-	ErrNoSuchAsset = &Error{http.StatusNotFound, "No such asset"}
+	Err              = &Error{http.StatusInternalServerError, "Techniker ist informiert"}
+	ErrUnsafePath    = &Error{http.StatusBadRequest, "Directory traversal attempt detected!"}
+	ErrNotFound      = &Error{http.StatusNotFound, "Not found"}
+	ErrNoSuchNode    = &Error{http.StatusNotFound, "No such node"}
+	ErrNoSuchAsset   = &Error{http.StatusNotFound, "No such asset"}
+	ErrNoSuchVersion = &Error{http.StatusNotFound, "No such version"}
+
+	ErrUnconvertibleAsset = &Error{http.StatusUnprocessableEntity, "Asset cannot be converted"}
+	ErrInvalidQuery       = &Error{http.StatusBadRequest, "Invalid query"}
 )
 
 type Error struct {
@@ -24,3 +31,10 @@ type Error struct {
 func (e *Error) Error() string {
 	return e.Message
 }
+
+// With returns a copy of the error, with the message of the given
+// error appended. Use this only for errors whose message is safe to
+// show to the user.
+func (e *Error) With(err error) *Error {
+	return &Error{e.Code, fmt.Sprintf("%s: %s", e.Message, err)}
+}
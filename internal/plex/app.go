@@ -20,7 +20,7 @@ import (
 	git "gopkg.in/src-d/go-git.v4"
 )
 
-func NewApp(version string, livePath string, frontendPath string) *App {
+func NewApp(version string, livePath string, frontendPath string, dataDir string) *App {
 	log.Print("Initializing application...")
 
 	return &App{
@@ -28,6 +28,7 @@ func NewApp(version string, livePath string, frontendPath string) *App {
 		Version:      version,
 		livePath:     livePath,
 		frontendPath: frontendPath,
+		dataDir:      dataDir,
 	}
 }
 
@@ -44,6 +45,11 @@ type App struct {
 	// livePath is the absolute path to the live DDT.
 	livePath string
 
+	// dataDir is an absolute path to a directory, where data is
+	// persisted across restarts. When empty data is kept in memory
+	// only.
+	dataDir string
+
 	LiveConfigDB config.DB
 
 	Broker *bus.Broker
@@ -105,7 +111,7 @@ func (app *App) Open() error {
 		app.Frontend = frontend
 	}
 
-	ss, err := NewSources(app.LiveConfigDB)
+	ss, err := NewSources(app.LiveConfigDB, app.dataDir)
 	if err != nil {
 		return err
 	}
@@ -10,7 +10,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/rundsk/dsk/internal/author"
@@ -20,6 +22,7 @@ import (
 	"github.com/rundsk/dsk/internal/meta"
 	"github.com/rundsk/dsk/internal/notify"
 	"github.com/rundsk/dsk/internal/search"
+	"github.com/rundsk/dsk/internal/tokens"
 	"github.com/rundsk/dsk/internal/vcs"
 	"gopkg.in/src-d/go-billy.v4/osfs"
 	git "gopkg.in/src-d/go-git.v4"
@@ -31,23 +34,25 @@ import (
 type sourceCompleteFunc func(*Source) (string, *git.Repository, error)
 
 // NewSource initializes a new source and Open()s it to ready it.
-func NewSource(name string, path string, c config.DB) (*Source, error) {
+func NewSource(name string, path string, c config.DB, dataDir string) (*Source, error) {
 	s := &Source{
 		Name:     name,
 		Path:     path,
 		ConfigDB: c,
+		DataDir:  dataDir,
 	}
 	s.Teardown = &Teardown{Scope: s.String()}
 
 	return s, s.Open(nil)
 }
 
-func NewLazySource(name string, completeFn sourceCompleteFunc, c config.DB) (*Source, error) {
+func NewLazySource(name string, completeFn sourceCompleteFunc, c config.DB, dataDir string) (*Source, error) {
 	s := &Source{
 		Teardown:   &Teardown{Scope: fmt.Sprintf("%s source", name)},
 		Name:       name,
 		completeFn: completeFn,
 		ConfigDB:   c,
+		DataDir:    dataDir,
 	}
 
 	b, err := bus.NewBroker()
@@ -82,10 +87,16 @@ type Source struct {
 	// ConfigDB is the central configuration and managed from the outside.
 	ConfigDB config.DB
 
+	// DataDir is the absolute path to a directory, where data - i.e.
+	// search indexes - is persisted, optional.
+	DataDir string
+
 	Tree *ddt.Tree
 
 	Search *search.Search
 
+	Tokens *tokens.DB
+
 	MetaDB meta.DB
 
 	AuthorDB author.DB
@@ -205,9 +216,6 @@ func (s *Source) Open(gr *git.Repository) error {
 		}
 		s.AuthorDB = adb
 		s.Teardown.AddFunc(s.AuthorDB.Close)
-
-		done := s.Broker.SubscribeFunc("fs.changed", s.AuthorDB.Refresh)
-		s.Teardown.AddChan(done)
 	} else {
 		s.AuthorDB = author.NewNoopDB()
 	}
@@ -224,22 +232,65 @@ func (s *Source) Open(gr *git.Repository) error {
 	}
 	s.Tree = t
 
-	done := s.Broker.SubscribeFunc("fs.changed", s.Tree.Sync)
+	// Nodes look up their authors, which must have been refreshed,
+	// before the tree is synced and the search re-indexes them.
+	done := s.Broker.SubscribeFunc("fs.changed", func() error {
+		if err := s.AuthorDB.Refresh(); err != nil {
+			log.Printf("Failed to refresh authors of %s: %s", s, err)
+		}
+		return s.Tree.Sync()
+	})
 	s.Teardown.AddChan(done)
 
-	se, err := search.NewSearch("", t, s.ConfigDB.Data().Lang, false)
+	tdb, err := tokens.NewDB(t)
+	if err != nil {
+		return err
+	}
+	s.Tokens = tdb
+	s.Teardown.AddFunc(tdb.Close)
+
+	// Sources cloned from a repository are checked out anew each
+	// time, their persisted search indexes are reused by revision.
+	var revision string
+	if gr != nil {
+		head, err := gr.Head()
+		if err != nil {
+			return err
+		}
+		revision = head.Hash().String()
+	}
+
+	se, err := search.NewSearch(s.searchPath(), revision, t, tdb, s.ConfigDB.Data().Lang, s.ConfigDB.Data().Search, s.DataDir != "")
 	if err != nil {
 		return err
 	}
 	s.Search = se
 	s.Teardown.AddFunc(se.Close)
 
-	done = s.Broker.SubscribeFunc("tree.synced", se.Refresh)
+	// Search indexes the tokens as resolved by the tokens database,
+	// which must have been refreshed first.
+	done = s.Broker.SubscribeFuncWithMessage("tree.synced", func(m *bus.Message) error {
+		if err := tdb.Refresh(); err != nil {
+			return err
+		}
+		c, _ := m.Payload.(*ddt.TreeChanges)
+		return se.Refresh(c)
+	})
 	s.Teardown.AddChan(done)
 
 	return nil
 }
 
+// searchPath returns the path to the directory holding the source's
+// search indexes, when they are persisted.
+func (s *Source) searchPath() string {
+	if s.DataDir == "" {
+		return ""
+	}
+	// Version names may contain slashes, i.e. "feature/button".
+	return filepath.Join(s.DataDir, "search", url.PathEscape(s.Name))
+}
+
 func (s *Source) Close() error {
 	return s.Teardown.Close()
 }
@@ -14,13 +14,14 @@ import (
 	"github.com/rundsk/dsk/internal/config"
 )
 
-func NewSources(cdb config.DB) (*Sources, error) {
+func NewSources(cdb config.DB, dataDir string) (*Sources, error) {
 	log.Print("Initializing sources...")
 
 	ss := &Sources{
 		Teardown: &Teardown{Scope: "sources"},
 		data:     make(map[string]*Source, 0),
 		configDB: cdb,
+		dataDir:  dataDir,
 	}
 
 	return ss, ss.Open()
@@ -34,6 +35,9 @@ type Sources struct {
 	data map[string]*Source
 
 	configDB config.DB
+
+	// dataDir is passed to each source, see Source.DataDir.
+	dataDir string
 }
 
 func (ss *Sources) Open() error {
@@ -58,13 +62,13 @@ func (ss *Sources) Close() error {
 func (ss *Sources) Add(name string, path string) (*Source, error) {
 	log.Printf("Adding source %s...", name)
 
-	s, err := NewSource(name, path, ss.configDB)
+	s, err := NewSource(name, path, ss.configDB, ss.dataDir)
 	ss.data[name] = s
 	return s, err
 }
 
 func (ss *Sources) AddLazy(name string, completeFn sourceCompleteFunc) (*Source, error) {
-	s, err := NewLazySource(name, completeFn, ss.configDB)
+	s, err := NewLazySource(name, completeFn, ss.configDB, ss.dataDir)
 	ss.data[name] = s
 	return s, err
 }
@@ -0,0 +1,316 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve/document"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/blevesearch/bleve/search"
+	"github.com/blevesearch/bleve/search/highlight"
+	"github.com/blevesearch/bleve/search/highlight/highlighter/html"
+	"github.com/go-yaml/yaml"
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+// Only this many bytes of an asset are read, when extracting its
+// text. Larger assets are indexed partially.
+const maxExtractSize = 10 << 20
+
+var (
+	// AssetTextExtractors are all extractors, assets are indexed by.
+	// Further extractors may be added before the search is
+	// initialized.
+	AssetTextExtractors = []*AssetTextExtractor{
+		{"svg", []string{".svg"}, extractSVGText},
+		{"data", []string{".json", ".yaml", ".yml"}, extractDataText},
+		{"table", []string{".csv", ".tsv"}, extractTableText},
+		{"text", []string{".txt"}, extractPlainText},
+		{"pdf", []string{".pdf"}, extractPDFText},
+	}
+)
+
+// AssetTextExtractor extracts searchable text from the contents of
+// assets, i.e. the titles inside an SVG.
+type AssetTextExtractor struct {
+	Name string
+
+	// Exts are the file extensions of the assets handled by this
+	// extractor, including the leading ".".
+	Exts []string
+
+	// Extract returns the text of the asset, its contents are read
+	// from r. The extension is lower-cased and selects the format,
+	// when an extractor handles more than one.
+	Extract func(r io.Reader, ext string) (string, error)
+}
+
+// AssetTextExtractorByExt looks up an extractor by the file extension
+// of an asset. The extension is matched case-insensitively.
+func AssetTextExtractorByExt(ext string) (bool, *AssetTextExtractor) {
+	ext = strings.ToLower(ext)
+
+	for _, e := range AssetTextExtractors {
+		for _, eext := range e.Exts {
+			if eext == ext {
+				return true, e
+			}
+		}
+	}
+	return false, nil
+}
+
+// extractAssetText extracts the text of the asset, "ok" indicates if
+// there is an extractor for the asset.
+func extractAssetText(a *ddt.NodeAsset) (bool, string, error) {
+	ext := strings.ToLower(filepath.Ext(a.Path))
+
+	ok, e := AssetTextExtractorByExt(ext)
+	if !ok {
+		return false, "", nil
+	}
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return true, "", err
+	}
+	defer f.Close()
+
+	text, err := e.Extract(io.LimitReader(f, maxExtractSize), ext)
+	if err != nil {
+		return true, "", fmt.Errorf("%s extractor: %s", e.Name, err)
+	}
+	return true, text, nil
+}
+
+// extractSVGText extracts the text of titles, descriptions and text
+// elements.
+func extractSVGText(r io.Reader, ext string) (string, error) {
+	d := xml.NewDecoder(r)
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+
+	var texts []string
+	var depth int // How deep we are inside text elements.
+
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return strings.Join(texts, "\n"), err
+		}
+
+		switch el := t.(type) {
+		case xml.StartElement:
+			if depth > 0 || isSVGTextElement(el.Name.Local) {
+				depth++
+			}
+		case xml.EndElement:
+			if depth > 0 {
+				depth--
+			}
+		case xml.CharData:
+			if depth == 0 {
+				continue
+			}
+			if text := strings.TrimSpace(string(el)); text != "" {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+func isSVGTextElement(name string) bool {
+	switch name {
+	case "title", "desc", "text":
+		return true
+	}
+	return false
+}
+
+// extractDataText extracts all strings from JSON and YAML documents,
+// keys are not extracted.
+func extractDataText(r io.Reader, ext string) (string, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	var data interface{}
+	switch ext {
+	case ".json":
+		err = json.Unmarshal(contents, &data)
+	default:
+		err = yaml.Unmarshal(contents, &data)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(dataStrings(data), "\n"), nil
+}
+
+// dataStrings walks the decoded data and collects its strings.
+func dataStrings(data interface{}) []string {
+	var ss []string
+
+	switch v := data.(type) {
+	case string:
+		if s := strings.TrimSpace(v); s != "" {
+			ss = append(ss, s)
+		}
+	case []interface{}:
+		for _, e := range v {
+			ss = append(ss, dataStrings(e)...)
+		}
+	case map[string]interface{}:
+		// Sorted for a deterministic order of the strings.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			ss = append(ss, dataStrings(v[k])...)
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = e
+		}
+		ss = append(ss, dataStrings(m)...)
+	}
+	return ss
+}
+
+// extractTableText extracts the cells of CSV and TSV files, including
+// the header row.
+func extractTableText(r io.Reader, ext string) (string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	if ext == ".tsv" {
+		cr.Comma = '\t'
+	}
+
+	var rows []string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return strings.Join(rows, "\n"), err
+		}
+
+		var cells []string
+		for _, cell := range record {
+			if cell = strings.TrimSpace(cell); cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+		rows = append(rows, strings.Join(cells, " "))
+	}
+	return strings.Join(rows, "\n"), nil
+}
+
+func extractPlainText(r io.Reader, ext string) (string, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(string(contents), ""), nil
+}
+
+// assetHits returns the assets of the node, whose text matched, each
+// with the best fragment of its text.
+func (s *Search) assetHits(n *ddt.Node, hit *search.DocumentMatch) ([]*AssetHit, error) {
+	hits := make([]*AssetHit, 0)
+
+	// Texts are indexed as an array, the array positions tell us
+	// which of the assets matched.
+	matched := make(map[uint64]bool)
+	for _, locations := range hit.Locations["Assets"] {
+		for _, l := range locations {
+			if len(l.ArrayPositions) > 0 {
+				matched[l.ArrayPositions[0]] = true
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return hits, nil
+	}
+
+	doc, err := s.wideIndex.Document(hit.ID)
+	if err != nil || doc == nil {
+		return hits, err
+	}
+	names := make(map[uint64]string)
+	texts := make(map[uint64]document.Field)
+
+	for _, f := range doc.Fields {
+		if len(f.ArrayPositions()) == 0 {
+			continue
+		}
+		switch f.Name() {
+		case "AssetNames":
+			names[f.ArrayPositions()[0]] = string(f.Value())
+		case "Assets":
+			texts[f.ArrayPositions()[0]] = f
+		}
+	}
+
+	h, err := highlighter()
+	if err != nil {
+		return hits, err
+	}
+
+	positions := make([]uint64, 0, len(matched))
+	for p := range matched {
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i] < positions[j]
+	})
+
+	for _, p := range positions {
+		ok, a, err := n.Asset(names[p])
+		if err != nil {
+			return hits, err
+		}
+		if !ok {
+			log.Printf("Asset %s of hit %s not found, skipping asset", names[p], hit.ID)
+			continue
+		}
+
+		var fragment string
+		if f, ok := texts[p]; ok {
+			// Limit highlighting to the asset's text.
+			fragment = h.BestFragmentInField(hit, &document.Document{ID: hit.ID, Fields: []document.Field{f}}, "Assets")
+		}
+		hits = append(hits, &AssetHit{a, fragment})
+	}
+	return hits, nil
+}
+
+// highlighter returns the highlighter, that is used for the fragments
+// of hits.
+func highlighter() (highlight.Highlighter, error) {
+	return registry.NewCache().HighlighterNamed(html.Name)
+}
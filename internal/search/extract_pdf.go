@@ -0,0 +1,310 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Stream dictionaries are looked up within this many bytes before
+// the stream's data.
+const pdfMaxDictSize = 4096
+
+// Compressed streams are inflated up to these sizes, per stream and
+// in total per document. A small crafted document may otherwise
+// inflate to gigabytes. Streams exceeding the limits are skipped.
+const pdfMaxStreamSize = 4 << 20
+const pdfMaxInflatedSize = 32 << 20
+
+var (
+	pdfStreamRegexp = regexp.MustCompile(`stream\r?\n`)
+
+	// Streams with these filters can be read, other filters are used
+	// for images or are uncommon for text.
+	pdfFilterRegexp      = regexp.MustCompile(`/Filter\s*\[?\s*/(\w+)`)
+	pdfMultiFilterRegexp = regexp.MustCompile(`/Filter\s*\[\s*/\w+\s*/`)
+
+	// Images and embedded fonts never contain text.
+	pdfBinaryRegexp = regexp.MustCompile(`/Subtype\s*/Image|/Length[123]\b|/Subtype\s*/(Type1C|CIDFontType0C|OpenType)`)
+)
+
+// extractPDFText extracts the text layer of a PDF. This is a basic
+// extractor, that doesn't need a full PDF parser: it reads the text
+// showing operators of all content streams. Text of fonts with custom
+// encodings cannot be decoded this way and is skipped.
+func extractPDFText(r io.Reader, ext string) (string, error) {
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if !bytes.HasPrefix(contents, []byte("%PDF-")) {
+		return "", errors.New("not a PDF document")
+	}
+
+	var b strings.Builder
+	for _, s := range pdfStreams(contents) {
+		pdfContentText(&b, s)
+	}
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
+// pdfStreams returns the decoded data of all streams, that may
+// contain text.
+func pdfStreams(contents []byte) [][]byte {
+	streams := make([][]byte, 0)
+	var inflated int
+
+	for _, loc := range pdfStreamRegexp.FindAllIndex(contents, -1) {
+		// The stream's dictionary is between the start of the object
+		// and the stream keyword.
+		head := contents[:loc[0]]
+		if len(head) > pdfMaxDictSize {
+			head = head[len(head)-pdfMaxDictSize:]
+		}
+		if !bytes.HasSuffix(bytes.TrimSpace(head), []byte(">>")) {
+			continue // The keyword was part of other data.
+		}
+		dict := head[bytes.LastIndex(head, []byte("obj"))+len("obj"):]
+
+		end := bytes.Index(contents[loc[1]:], []byte("endstream"))
+		if end < 0 {
+			continue
+		}
+		data := contents[loc[1] : loc[1]+end]
+
+		if pdfBinaryRegexp.Match(dict) || pdfMultiFilterRegexp.Match(dict) {
+			continue
+		}
+		if m := pdfFilterRegexp.FindSubmatch(dict); m != nil {
+			if string(m[1]) != "FlateDecode" {
+				continue
+			}
+			limit := pdfMaxStreamSize
+			if left := pdfMaxInflatedSize - inflated; left < limit {
+				limit = left
+			}
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				continue
+			}
+			// Truncated streams still yield the data decoded so far.
+			data, _ = ioutil.ReadAll(io.LimitReader(zr, int64(limit)+1))
+			if len(data) > limit {
+				continue
+			}
+			inflated += len(data)
+		}
+		streams = append(streams, data)
+	}
+	return streams
+}
+
+// pdfContentText writes the text shown by the operators of the
+// content stream to b.
+func pdfContentText(b *strings.Builder, content []byte) {
+	var operands []string // Strings since the last operator.
+	var inText, inArray bool
+
+	i := 0
+	for i < len(content) {
+		c := content[i]
+
+		switch {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := pdfLiteralString(content[i:])
+			operands = append(operands, s)
+			i += n
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			i += 2
+		case c == '>' && i+1 < len(content) && content[i+1] == '>':
+			i += 2
+		case c == '<':
+			s, n := pdfHexString(content[i:])
+			operands = append(operands, s)
+			i += n
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '/':
+			i++
+			for i < len(content) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			i++
+			for i < len(content) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+			// Large negative adjustments inside TJ arrays separate words.
+			if n, err := strconv.ParseFloat(string(content[start:i]), 64); err == nil && inArray && n < -200 {
+				operands = append(operands, " ")
+			}
+		case isPDFDelimiter(c):
+			i++
+		default:
+			start := i
+			for i < len(content) && !isPDFDelimiter(content[i]) {
+				i++
+			}
+			op := string(content[start:i])
+
+			switch op {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				b.WriteString("\n")
+			case "Tj", "TJ", "'", "\"":
+				if !inText {
+					break
+				}
+				if op != "Tj" && op != "TJ" {
+					b.WriteString("\n")
+				}
+				for _, s := range operands {
+					b.WriteString(s)
+				}
+			case "Td", "TD", "Tm", "T*":
+				b.WriteString(" ")
+			}
+			operands = operands[:0]
+		}
+	}
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0, '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLiteralString decodes the string in parentheses at the start of
+// data, returns the string and the number of bytes it occupied.
+func pdfLiteralString(data []byte) (string, int) {
+	var s []byte
+	depth := 0
+
+	i := 0
+	for ; i < len(data); i++ {
+		c := data[i]
+
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfText(s), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(data) {
+				return pdfText(s), i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				s = append(s, '\n')
+			case 'r':
+				s = append(s, '\r')
+			case 't':
+				s = append(s, '\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// Line continuation, the line break isn't part of the string.
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					n := 0
+					j := i
+					for ; j < len(data) && j < i+3 && data[j] >= '0' && data[j] <= '7'; j++ {
+						n = n*8 + int(data[j]-'0')
+					}
+					s = append(s, byte(n))
+					i = j - 1
+				} else {
+					s = append(s, e)
+				}
+			}
+			continue
+		}
+		s = append(s, c)
+	}
+	return pdfText(s), i
+}
+
+// pdfHexString decodes the string in angle brackets at the start of
+// data, returns the string and the number of bytes it occupied.
+func pdfHexString(data []byte) (string, int) {
+	end := bytes.IndexByte(data, '>')
+	n := end + 1
+	if end < 0 {
+		end = len(data)
+		n = end
+	}
+
+	var digits []byte
+	for _, c := range data[1:end] {
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+
+	s := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		c, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		s = append(s, byte(c))
+	}
+	return pdfText(s), n
+}
+
+// pdfText converts the bytes of a string to text. Strings are either
+// UTF-16 with a byte order mark or in a single byte encoding, which
+// is assumed to be Latin-1 compatible. Strings, that don't look like
+// text, are written using custom encodings and are dropped.
+func pdfText(s []byte) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		u := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+
+	rs := make([]rune, 0, len(s))
+	for _, c := range s {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return ""
+		}
+		rs = append(rs, rune(c))
+	}
+	return string(rs)
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+func TestExtractAssetText(t *testing.T) {
+	expected := map[string]struct {
+		contents string
+		text     string
+	}{
+		".svg": {
+			`<svg xmlns="http://www.w3.org/2000/svg"><title>Arrow &amp; Chevron</title><path d="M0"/><text x="0">Go <tspan>back</tspan></text></svg>`,
+			"Arrow & Chevron\nGo\nback",
+		},
+		".json": {
+			`{"name": "Brand", "colors": [{"label": "Ocean blue", "value": 3}], "active": true}`,
+			"Ocean blue\nBrand",
+		},
+		".yml": {
+			"name: Brand\ncolors:\n  - label: Ocean blue\n",
+			"Ocean blue\nBrand",
+		},
+		".csv": {
+			"name,usage\nprimary,\"Calls to action, i.e. buttons\"\n",
+			"name usage\nprimary Calls to action, i.e. buttons",
+		},
+		".tsv": {
+			"name\tusage\nprimary\tHeadlines\n",
+			"name usage\nprimary Headlines",
+		},
+		".TXT": {
+			"Voice and tone",
+			"Voice and tone",
+		},
+	}
+	for ext, e := range expected {
+		ok, extractor := AssetTextExtractorByExt(ext)
+		if !ok {
+			t.Errorf("Expected extractor for %s", ext)
+			continue
+		}
+		text, err := extractor.Extract(strings.NewReader(e.contents), strings.ToLower(ext))
+		if err != nil {
+			t.Errorf("Failed to extract text of %s: %s", ext, err)
+			continue
+		}
+		if text != e.text {
+			t.Errorf("Expected text '%s' for %s, got: '%s'", e.text, ext, text)
+		}
+	}
+
+	if ok, _ := AssetTextExtractorByExt(".png"); ok {
+		t.Errorf("Expected no extractor for images")
+	}
+}
+
+func TestExtractPDFText(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("BT /F1 12 Tf 72 700 Td [(Spa)-20(cing) -300 (rules)] TJ ET"))
+	zw.Close()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	pdf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	content := "BT /F1 24 Tf 72 720 Td (Brand \\(Guidelines\\)) Tj 0 -30 Td <56 6f 69 63 65> Tj ET"
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+	fmt.Fprintf(&pdf, "5 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("6 0 obj\n<< /Length 10 /Subtype /Image /Filter /DCTDecode >>\nstream\nBT (x) Tj ET\nendstream\nendobj\n")
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	text, err := extractPDFText(&pdf, ".pdf")
+	if err != nil {
+		t.Fatalf("Failed to extract text: %s", err)
+	}
+	expected := "Brand (Guidelines) Voice Spacing rules"
+	if text != expected {
+		t.Errorf("Expected text '%s', got: '%s'", expected, text)
+	}
+
+	if _, err := extractPDFText(strings.NewReader("<svg/>"), ".pdf"); err == nil {
+		t.Errorf("Expected error for non-PDF contents")
+	}
+}
+
+func TestExtractPDFTextOversizedStream(t *testing.T) {
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+
+	writeStream := func(obj int, content []byte) {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(content)
+		zw.Close()
+
+		fmt.Fprintf(&pdf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", obj, compressed.Len())
+		pdf.Write(compressed.Bytes())
+		pdf.WriteString("\nendstream\nendobj\n")
+	}
+	writeStream(1, []byte("BT (Before) Tj ET"))
+	writeStream(2, append([]byte("BT (Bomb) Tj ET "), make([]byte, pdfMaxStreamSize)...))
+	writeStream(3, []byte("BT (After) Tj ET"))
+
+	if pdf.Len() > maxExtractSize {
+		t.Fatalf("Expected compressed document to be small, got: %d bytes", pdf.Len())
+	}
+
+	text, err := extractPDFText(&pdf, ".pdf")
+	if err != nil {
+		t.Fatalf("Failed to extract text: %s", err)
+	}
+	expected := "Before After"
+	if text != expected {
+		t.Errorf("Expected text '%s', got: '%s'", expected, text)
+	}
+}
+
+func TestFullSearchAssetText(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp, "Icons"), tmp)
+	n0.Create()
+	ioutil.WriteFile(filepath.Join(n0.Path, "arrow.svg"), []byte(`<svg><title>Chevron pointing left</title></svg>`), 0666)
+	ioutil.WriteFile(filepath.Join(n0.Path, "star.svg"), []byte(`<svg><title>Favorite</title></svg>`), 0666)
+	ioutil.WriteFile(filepath.Join(n0.Path, "broken.json"), []byte(`{"chevron": `), 0666)
+	n0.Load()
+
+	n1 := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n1.Create()
+	n1.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1}, false)
+	defer teardownSearchTest(tmp, s)
+
+	rs, _, _, _, err := s.FullSearch("chevron")
+	if err != nil {
+		t.Fatalf("Failed to search: %s", err)
+	}
+	expectFullSearchResult(t, rs, "Icons")
+	expectNoFullSearchResult(t, rs, "Colors")
+
+	for _, r := range rs {
+		if r.Node.URL() != "Icons" {
+			continue
+		}
+		if len(r.Assets) != 1 {
+			t.Fatalf("Expected 1 asset hit, got: %d", len(r.Assets))
+		}
+		if r.Assets[0].Asset.Name() != "arrow.svg" {
+			t.Errorf("Expected hit for arrow.svg, got: %s", r.Assets[0].Asset.Name())
+		}
+		if !strings.Contains(r.Assets[0].Fragment, "<mark>Chevron</mark>") {
+			t.Errorf("Expected fragment to mark match, got: %s", r.Assets[0].Fragment)
+		}
+	}
+}
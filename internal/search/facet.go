@@ -0,0 +1,257 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+// The maximum number of values returned per facet.
+const facetSize = 20
+
+// BuiltinFacets are always available, further facets can be
+// configured for custom fields.
+var BuiltinFacets = []string{
+	"tag",
+	"author",
+	"section", // The top-level aspect, a node is located under.
+	"asset",   // The types of assets, i.e. "sketch" or "png".
+}
+
+// NewFacets returns the names of the builtin facets and the ones
+// configured in the search configuration, which may be nil. Custom
+// facets are named after the custom field, i.e. "custom.lifecycle".
+func NewFacets(c *config.SearchConfig) []string {
+	facets := append([]string{}, BuiltinFacets...)
+	if c == nil {
+		return facets
+	}
+	for _, f := range c.Facets {
+		if !strings.HasPrefix(f, "custom.") || len(f) == len("custom.") {
+			log.Printf("Ignoring search facet, expected a custom field i.e. custom.lifecycle: %s", f)
+			continue
+		}
+		if isFacet(facets, f) {
+			continue
+		}
+		facets = append(facets, f)
+	}
+	return facets
+}
+
+// Facet counts the hits by the values of a field.
+type Facet struct {
+	// Name of the facet, i.e. "tag" or "custom.lifecycle".
+	Name string
+
+	// The most frequent values, ordered by count.
+	Values []*FacetValue
+
+	// Number of hits without any value.
+	Missing int
+}
+
+type FacetValue struct {
+	Value string
+	Count int
+}
+
+// MergeFacets sums up the counts of equally named facets. Values are
+// ordered by count, the most frequent ones are kept.
+func MergeFacets(facets ...[]*Facet) []*Facet {
+	merged := make([]*Facet, 0)
+	lookup := make(map[string]*Facet)
+	counts := make(map[string]map[string]int)
+
+	for _, fs := range facets {
+		for _, f := range fs {
+			m, ok := lookup[f.Name]
+			if !ok {
+				m = &Facet{Name: f.Name}
+				lookup[f.Name] = m
+				counts[f.Name] = make(map[string]int)
+				merged = append(merged, m)
+			}
+			m.Missing += f.Missing
+
+			for _, v := range f.Values {
+				counts[f.Name][v.Value] += v.Count
+			}
+		}
+	}
+
+	for _, m := range merged {
+		m.Values = make([]*FacetValue, 0, len(counts[m.Name]))
+		for v, c := range counts[m.Name] {
+			m.Values = append(m.Values, &FacetValue{v, c})
+		}
+		sort.Slice(m.Values, func(i, j int) bool {
+			if m.Values[i].Count != m.Values[j].Count {
+				return m.Values[i].Count > m.Values[j].Count
+			}
+			return m.Values[i].Value < m.Values[j].Value
+		})
+		if len(m.Values) > facetSize {
+			m.Values = m.Values[:facetSize]
+		}
+	}
+	return merged
+}
+
+// facetField is the field of the wide index holding the facet's
+// values.
+func facetField(name string) string {
+	return "Facets." + name
+}
+
+// newFacetsMapping creates the mapping for the values of the facets.
+// Facet values are counted as is and must not match free text.
+func newFacetsMapping(facets []string) *mapping.DocumentMapping {
+	fm := bleve.NewTextFieldMapping()
+	fm.Analyzer = keyword.Name
+	fm.IncludeInAll = false
+
+	dm := bleve.NewDocumentMapping()
+	dm.Dynamic = false
+
+	for _, f := range facets {
+		// Fields are looked up by their path, i.e. "custom.lifecycle"
+		// is the "lifecycle" property of the "custom" sub-document.
+		current := dm
+		for _, p := range strings.Split(f, ".") {
+			sdm, ok := current.Properties[p]
+			if !ok {
+				sdm = bleve.NewDocumentMapping()
+				sdm.Dynamic = false
+				current.AddSubDocumentMapping(p, sdm)
+			}
+			current = sdm
+		}
+		current.AddFieldMapping(fm)
+	}
+	return dm
+}
+
+func isFacet(facets []string, name string) bool {
+	for _, f := range facets {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// facetValues returns the node's values for each of the facets.
+func facetValues(n *ddt.Node, facets []string) (map[string][]string, error) {
+	values := make(map[string][]string, len(facets))
+
+	for _, f := range facets {
+		switch f {
+		case "tag":
+			values[f] = n.Tags()
+		case "author":
+			var as []string
+			for _, a := range n.Authors() {
+				as = append(as, a.Email)
+			}
+			values[f] = as
+		case "section":
+			if n.URL() != "" {
+				values[f] = []string{strings.SplitN(n.URL(), "/", 2)[0]}
+			}
+		case "asset":
+			assets, err := n.Assets()
+			if err != nil {
+				return values, err
+			}
+			seen := make(map[string]bool)
+			for _, a := range assets {
+				ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(a.Name())), ".")
+				if ext == "" || seen[ext] {
+					continue
+				}
+				values[f] = append(values[f], ext)
+				seen[ext] = true
+			}
+		default:
+			path := strings.Split(strings.TrimPrefix(f, "custom."), ".")
+			values[f] = customValues(n.Custom(), path)
+		}
+	}
+	return values, nil
+}
+
+// customValues looks up the value at path inside the custom data.
+// Lists yield multiple values.
+func customValues(custom interface{}, path []string) []string {
+	if len(path) == 0 {
+		switch v := custom.(type) {
+		case nil:
+			return nil
+		case []interface{}:
+			var vs []string
+			for _, e := range v {
+				vs = append(vs, customValues(e, nil)...)
+			}
+			return vs
+		case map[string]interface{}, map[interface{}]interface{}:
+			return nil
+		default:
+			return []string{fmt.Sprint(v)}
+		}
+	}
+	switch v := custom.(type) {
+	case map[string]interface{}:
+		return customValues(v[path[0]], path[1:])
+	case map[interface{}]interface{}:
+		return customValues(v[path[0]], path[1:])
+	}
+	return nil
+}
+
+// facetQuery restricts results to the selected facet values. Values
+// of the same facet are alternatives, while all facets must match.
+// Returns nil, when nothing has been selected.
+func facetQuery(facets []string, selected map[string][]string) (query.Query, error) {
+	var fqs []query.Query
+
+	// Sorted for deterministic queries.
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !isFacet(facets, name) {
+			return nil, fmt.Errorf("unknown facet: %s", name)
+		}
+		var tqs []query.Query
+		for _, v := range selected[name] {
+			tq := bleve.NewTermQuery(v)
+			tq.SetField(facetField(name))
+			tqs = append(tqs, tq)
+		}
+		if len(tqs) > 0 {
+			fqs = append(fqs, bleve.NewDisjunctionQuery(tqs...))
+		}
+	}
+	if len(fqs) == 0 {
+		return nil, nil
+	}
+	return bleve.NewConjunctionQuery(fqs...), nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+func TestNewFacets(t *testing.T) {
+	facets := NewFacets(&config.SearchConfig{
+		Facets: []string{"custom.lifecycle", "lifecycle", "custom.", "custom.lifecycle"},
+	})
+	expected := []string{"tag", "author", "section", "asset", "custom.lifecycle"}
+
+	if !reflect.DeepEqual(facets, expected) {
+		t.Errorf("Expected facets %v, got: %v", expected, facets)
+	}
+}
+
+func TestFacetedFullSearch(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	os.Mkdir(filepath.Join(tmp, "DataEntry"), 0777)
+
+	n0 := newTestNode(filepath.Join(tmp, "DataEntry", "DatePicker"), tmp)
+	n0.Create()
+	n0.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "A component to select dates.",
+		Authors:     []string{"jane@example.org"},
+		Tags:        []string{"forms"},
+		Custom:      map[string]string{"lifecycle": "stable"},
+	})
+	ioutil.WriteFile(filepath.Join(n0.Path, "DatePicker.sketch"), []byte(""), 0666)
+	n0.Load()
+
+	n1 := newTestNode(filepath.Join(tmp, "DataEntry", "Input"), tmp)
+	n1.Create()
+	n1.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "A component to enter text.",
+		Tags:        []string{"forms", "text"},
+		Custom:      map[string]string{"lifecycle": "beta"},
+	})
+	ioutil.WriteFile(filepath.Join(n1.Path, "Input.png"), []byte(""), 0666)
+	n1.Load()
+
+	n2 := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n2.Create()
+	n2.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "A component to show colors.",
+		Custom:      map[string]string{"lifecycle": "stable"},
+	})
+	n2.Load()
+
+	s := setupSearchTest(t, tmp, "en", nil, false)
+	defer teardownSearchTest(tmp, s)
+
+	s.facets = NewFacets(&config.SearchConfig{Facets: []string{"custom.lifecycle"}})
+	s.wideIndex.Close()
+	s.narrowIndex.Close()
+	s.wideIndex, s.narrowIndex, _ = NewIndexes("", s.analyzers, s.facets, false)
+
+	nodes := map[string]*ddt.Node{n0.URL(): n0, n1.URL(): n1, n2.URL(): n2}
+	s.getNode = func(url string) (bool, *ddt.Node, error) {
+		n, ok := nodes[url]
+		return ok, n, nil
+	}
+	s.getAllNodes = func() []*ddt.Node {
+		return []*ddt.Node{n0, n1, n2}
+	}
+	if err := s.IndexTree(nil); err != nil {
+		t.Fatalf("Failed to index tree: %s", err)
+	}
+
+	counts := func(facets []*Facet) map[string]map[string]int {
+		r := make(map[string]map[string]int)
+		for _, f := range facets {
+			r[f.Name] = make(map[string]int)
+			for _, v := range f.Values {
+				r[f.Name][v.Value] = v.Count
+			}
+		}
+		return r
+	}
+
+	rs, facets, total, _, _, err := s.FacetedFullSearch("component", nil, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to search: %s", err)
+	}
+	if total != 3 {
+		t.Errorf("Expected 3 hits, got: %d", total)
+	}
+	expected := map[string]map[string]int{
+		"tag":              {"forms": 2, "text": 1},
+		"author":           {"jane@example.org": 1},
+		"section":          {"DataEntry": 2, "Colors": 1},
+		"asset":            {"sketch": 1, "png": 1},
+		"custom.lifecycle": {"stable": 2, "beta": 1},
+	}
+	if c := counts(facets); !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected facet counts %v, got: %v", expected, c)
+	}
+
+	rs, facets, _, _, _, _ = s.FacetedFullSearch("component", map[string][]string{
+		"custom.lifecycle": {"stable"},
+	}, 0, 0)
+	expectFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectFullSearchResult(t, rs, "Colors")
+	expectNoFullSearchResult(t, rs, "DataEntry/Input")
+
+	if c := counts(facets)["section"]; !reflect.DeepEqual(c, map[string]int{"DataEntry": 1, "Colors": 1}) {
+		t.Errorf("Expected section counts of selected hits, got: %v", c)
+	}
+
+	rs, _, _, _, _, _ = s.FacetedFullSearch("component", map[string][]string{
+		"section": {"DataEntry"},
+		"tag":     {"text", "unknown"},
+	}, 0, 0)
+	expectFullSearchResult(t, rs, "DataEntry/Input")
+	expectNoFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectNoFullSearchResult(t, rs, "Colors")
+
+	_, _, _, _, _, err = s.FacetedFullSearch("component", map[string][]string{
+		"custom.platform": {"web"},
+	}, 0, 0)
+	if err == nil {
+		t.Errorf("Expected error for unknown facet")
+	}
+}
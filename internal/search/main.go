@@ -7,80 +7,371 @@
 package search
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/analysis/analyzer/simple"
+	"github.com/blevesearch/bleve/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/analysis/analyzer/web"
+	"github.com/blevesearch/bleve/analysis/lang/ar"
+	"github.com/blevesearch/bleve/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/analysis/lang/ckb"
+	"github.com/blevesearch/bleve/analysis/lang/da"
 	"github.com/blevesearch/bleve/analysis/lang/de"
 	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/lang/es"
+	"github.com/blevesearch/bleve/analysis/lang/fa"
+	"github.com/blevesearch/bleve/analysis/lang/fi"
+	"github.com/blevesearch/bleve/analysis/lang/fr"
+	"github.com/blevesearch/bleve/analysis/lang/hi"
+	"github.com/blevesearch/bleve/analysis/lang/hu"
+	"github.com/blevesearch/bleve/analysis/lang/it"
+	"github.com/blevesearch/bleve/analysis/lang/nl"
+	"github.com/blevesearch/bleve/analysis/lang/no"
+	"github.com/blevesearch/bleve/analysis/lang/pt"
+	"github.com/blevesearch/bleve/analysis/lang/ro"
+	"github.com/blevesearch/bleve/analysis/lang/ru"
+	"github.com/blevesearch/bleve/analysis/lang/sv"
+	"github.com/blevesearch/bleve/analysis/lang/tr"
 	"github.com/blevesearch/bleve/mapping"
 	"github.com/blevesearch/bleve/search/query"
+	"github.com/rundsk/dsk/internal/config"
 	"github.com/rundsk/dsk/internal/ddt"
+	"github.com/rundsk/dsk/internal/tokens"
 )
 
+// Default and maximum number of results per page, see NewLimits().
 const searchResultLimit = 50
+const maxSearchResultLimit = 200
 const filterResultLimit = 500
+const maxFilterResultLimit = 1000
 
 var (
+	// Keys of the values we store alongside the indexed nodes.
+	indexHashKey     = []byte("dsk.hash")
+	indexNodesKey    = []byte("dsk.nodes")
+	indexRevisionKey = []byte("dsk.revision")
+	indexMappingKey  = []byte("dsk.mapping")
+
 	// AvailableSearchLangs are languages mapped to their analyzer names.
 	AvailableSearchLangs = map[string]string{
-		"de": de.AnalyzerName,
-		"en": en.AnalyzerName,
+		"ar":  ar.AnalyzerName,
+		"ckb": ckb.AnalyzerName,
+		"da":  da.AnalyzerName,
+		"de":  de.AnalyzerName,
+		"en":  en.AnalyzerName,
+		"es":  es.AnalyzerName,
+		"fa":  fa.AnalyzerName,
+		"fi":  fi.AnalyzerName,
+		"fr":  fr.AnalyzerName,
+		"hi":  hi.AnalyzerName,
+		"hu":  hu.AnalyzerName,
+		"it":  it.AnalyzerName,
+		"nl":  nl.AnalyzerName,
+		"no":  no.AnalyzerName,
+		"pt":  pt.AnalyzerName,
+		"ro":  ro.AnalyzerName,
+		"ru":  ru.AnalyzerName,
+		"sv":  sv.AnalyzerName,
+		"tr":  tr.AnalyzerName,
+		// Words aren't separated by spaces in these languages, text
+		// is split into overlapping pairs of characters instead.
+		"ja": cjk.AnalyzerName,
+		"ko": cjk.AnalyzerName,
+		"zh": cjk.AnalyzerName,
+	}
+
+	// AvailableSearchAnalyzers are the language-neutral analyzers, that
+	// can be configured in addition to the language analyzers.
+	AvailableSearchAnalyzers = []string{
+		standard.Name,
+		simple.Name,
+		keyword.Name,
+		web.Name,
+	}
+
+	// SearchFields are the fields of a node, that are indexed. The
+	// narrow index contains just the title and the tags.
+	SearchFields = []string{
+		"Title",
+		"Tags",
+		"SecondaryTitles",
+		"Authors",
+		"Description",
+		"Docs",
+		"Files",
+		"Version",
+		"Custom",
+		"TokenNames",
+		"TokenValues",
+		"Assets",
 	}
 )
 
-// NewSearch constructs and initializes a Search. The selected
-// language is validated and checked for availability.
-func NewSearch(path string, t *ddt.Tree, lang string, isPersistent bool) (*Search, error) {
-	log.Print("Initializing search...")
+// NewAnalyzers selects the analyzers for the given language and
+// applies the overrides from the search configuration, which may be
+// nil. Unsupported languages and unknown analyzers don't fail
+// initialization, the language-neutral standard analyzer is used
+// instead.
+func NewAnalyzers(lang string, c *config.SearchConfig) *Analyzers {
+	a := &Analyzers{
+		Text:   standard.Name,
+		Fields: make(map[string]string),
+	}
 
-	s := &Search{
-		path:        path,
-		getNode:     t.Get,
-		getAllNodes: t.GetAll,
-		getTreeHash: t.CalculateHash,
+	// Use the primary language subtag, i.e. "pt" of "pt-BR".
+	primary := strings.ToLower(lang)
+	if i := strings.IndexAny(primary, "-_"); i >= 0 {
+		primary = primary[:i]
+	}
+
+	if name, ok := AvailableSearchLangs[primary]; ok {
+		a.Text = name
+	} else {
+		log.Printf("No search analyzer for language %s, using language-neutral analyzer", lang)
+	}
+	if c == nil {
+		return a
+	}
+
+	if c.Analyzer != "" {
+		if isAnalyzer(c.Analyzer) {
+			a.Text = c.Analyzer
+		} else {
+			log.Printf("Ignoring unknown search analyzer: %s", c.Analyzer)
+		}
+	}
+	for f, name := range c.Fields {
+		field, ok := searchField(f)
+		if !ok {
+			log.Printf("Ignoring search analyzer for unknown field: %s", f)
+			continue
+		}
+		if !isAnalyzer(name) {
+			log.Printf("Ignoring unknown search analyzer for field %s: %s", field, name)
+			continue
+		}
+		a.Fields[field] = name
 	}
+	a.Synonyms = parseSynonyms(c.Synonyms)
+	return a
+}
+
+// Analyzers holds the names of the analyzers used for indexing.
+type Analyzers struct {
+	// Text is used for prose: titles, descriptions and documents.
+	Text string
+
+	// Fields maps names of fields to the analyzer, that is used
+	// instead of the field's default analyzers.
+	Fields map[string]string
+
+	// Synonyms are groups of words with the same meaning. When given,
+	// these are added to all text analyzed by the standard analyzer.
+	Synonyms [][]string
+}
 
-	_, ok := AvailableSearchLangs[lang]
-	if !ok {
-		return s, fmt.Errorf("unsupported language: %s", lang)
+// isAnalyzer checks whether an analyzer with the given name is
+// available.
+func isAnalyzer(name string) bool {
+	for _, n := range AvailableSearchLangs {
+		if n == name {
+			return true
+		}
+	}
+	for _, n := range AvailableSearchAnalyzers {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// searchField finds the field by its case-insensitive name.
+func searchField(name string) (string, bool) {
+	for _, f := range SearchFields {
+		if strings.EqualFold(f, name) {
+			return f, true
+		}
 	}
-	s.lang = lang
+	return "", false
+}
 
-	wideIndex, narrowIndex, err := NewIndexes(s.path, s.lang, isPersistent)
+// NewLimits returns the default and maximum number of results per
+// page, as configured in the search configuration, which may be nil.
+func NewLimits(c *config.SearchConfig) *Limits {
+	l := &Limits{
+		Search:    searchResultLimit,
+		MaxSearch: maxSearchResultLimit,
+		Filter:    filterResultLimit,
+		MaxFilter: maxFilterResultLimit,
+	}
+	if c == nil {
+		return l
+	}
+	if c.Limit > 0 {
+		l.Search = c.Limit
+	}
+	if c.MaxLimit > 0 {
+		l.MaxSearch = c.MaxLimit
+	}
+	if c.FilterLimit > 0 {
+		l.Filter = c.FilterLimit
+	}
+	if c.MaxFilterLimit > 0 {
+		l.MaxFilter = c.MaxFilterLimit
+	}
+
+	// A default exceeding the maximum would always be capped.
+	if l.Search > l.MaxSearch {
+		l.Search = l.MaxSearch
+	}
+	if l.Filter > l.MaxFilter {
+		l.Filter = l.MaxFilter
+	}
+	return l
+}
+
+// Limits holds the default and maximum number of results per page.
+type Limits struct {
+	Search    int
+	MaxSearch int
+	Filter    int
+	MaxFilter int
+}
+
+// SearchLimit returns the number of full search hits per page, for
+// the requested limit. Zero requests the default.
+func (l *Limits) SearchLimit(limit int) int {
+	return clampLimit(limit, l.Search, l.MaxSearch)
+}
+
+// FilterLimit returns the number of filter results per page, for
+// the requested limit. Zero requests the default.
+func (l *Limits) FilterLimit(limit int) int {
+	return clampLimit(limit, l.Filter, l.MaxFilter)
+}
+
+func clampLimit(limit int, def int, max int) int {
+	if limit <= 0 {
+		return def
+	}
+	if limit > max {
+		return max
+	}
+	return limit
+}
+
+// NewSearch constructs and initializes a Search. The analyzers are
+// selected by the language and the optional search configuration,
+// see NewAnalyzers().
+//
+// Persisted indexes are reused as is, when they have been built
+// from the current node tree, otherwise only the nodes that changed
+// are re-indexed. The hash of the tree covers the paths of its nodes
+// and their modification times, which change whenever the tree is
+// checked out anew. Indexes built from the same, optional, revision
+// are therefore reused, too.
+//
+// Tokens are indexed as provided by the tokens database, so that
+// their values are resolved tree-wide, as they are everywhere else.
+func NewSearch(path string, revision string, t *ddt.Tree, tdb *tokens.DB, lang string, c *config.SearchConfig, isPersistent bool) (*Search, error) {
+	log.Print("Initializing search...")
+
+	s := &Search{
+		path:         path,
+		isPersistent: isPersistent,
+		revision:     revision,
+		getNode:      t.Get,
+		getAllNodes:  t.GetAll,
+		getTreeHash:  t.CalculateHash,
+		getTokens:    tdb.ForNode,
+		analyzers:    NewAnalyzers(lang, c),
+		facets:       NewFacets(c),
+		limits:       NewLimits(c),
+		relevance:    NewRelevance(c),
+	}
+
+	wideIndex, narrowIndex, err := NewIndexes(s.path, s.analyzers, s.facets, isPersistent)
 	if err != nil {
 		return s, err
 	}
 	s.wideIndex = wideIndex
 	s.narrowIndex = narrowIndex
 
-	go s.IndexTree()
+	if isPersistent {
+		th, err := s.getTreeHash()
+		if err != nil {
+			return s, err
+		}
+		h, current, err := s.calculateHash(s.getAllNodes())
+		if err != nil {
+			return s, err
+		}
+		indexed, err := indexedNodes(wideIndex)
+		if err != nil {
+			return s, err
+		}
+		s.indexed = indexed
+
+		isSameRevision := revision != "" && indexedRevision(wideIndex) == revision && indexedRevision(narrowIndex) == revision
+
+		if isSameRevision || (indexedHash(wideIndex) == h && indexedHash(narrowIndex) == h) {
+			log.Printf("Reusing search indexes in: %s", path)
+			s.hash = h
+			s.treeHash = th
+			s.indexed = current
+
+			terms, err := suggestTerms(wideIndex)
+			if err != nil {
+				return s, err
+			}
+			s.terms.Store(terms)
+			s.isBoosted = isBoosted(s.getAllNodes())
+			return s, nil
+		}
+		// Without knowing which nodes have been indexed, we cannot
+		// remove the ones that don't exist anymore.
+		if s.indexed == nil {
+			if err := s.resetIndexes(); err != nil {
+				return s, err
+			}
+		}
+	}
+
+	go s.IndexTree(nil)
 	return s, nil
 }
 
-func NewIndexes(path string, lang string, isPersistent bool) (bleve.Index, bleve.Index, error) {
+func NewIndexes(path string, a *Analyzers, facets []string, isPersistent bool) (bleve.Index, bleve.Index, error) {
 	var wideIndex bleve.Index
 	var wideErr error
 	widePath := filepath.Join(path, "wide.bleve")
-	wideMapping := NewSearchMapping(lang, true)
+	wideMapping := NewSearchMapping(a, facets, true)
 
 	var narrowIndex bleve.Index
 	var narrowErr error
 	narrowPath := filepath.Join(path, "narrow.bleve")
-	narrowMapping := NewSearchMapping(lang, false)
+	narrowMapping := NewSearchMapping(a, facets, false)
 
 	if isPersistent {
 		log.Printf("Persisting search indexes in: %s", path)
 
-		wideIndex, wideErr = bleve.New(widePath, wideMapping)
-		narrowIndex, narrowErr = bleve.New(narrowPath, narrowMapping)
+		wideIndex, wideErr = openIndex(widePath, wideMapping)
+		narrowIndex, narrowErr = openIndex(narrowPath, narrowMapping)
 	} else {
 		wideIndex, wideErr = bleve.NewMemOnly(wideMapping)
 		narrowIndex, narrowErr = bleve.NewMemOnly(narrowMapping)
@@ -92,7 +383,79 @@ func NewIndexes(path string, lang string, isPersistent bool) (bleve.Index, bleve
 	return wideIndex, narrowIndex, narrowErr
 }
 
-func NewSearchMapping(lang string, isWide bool) *mapping.IndexMappingImpl {
+// openIndex opens the index persisted at path. A new index is
+// created, when there is none yet, or when the existing index was
+// created with a different mapping, i.e. for another language.
+func openIndex(path string, m *mapping.IndexMappingImpl) (bleve.Index, error) {
+	fingerprint, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	i, err := bleve.Open(path)
+	if err == nil {
+		stored, err := i.GetInternal(indexMappingKey)
+		if err == nil && bytes.Equal(stored, fingerprint) {
+			return i, nil
+		}
+		log.Printf("Mapping of search index in %s changed, recreating...", path)
+		i.Close()
+
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+	} else if err != bleve.ErrorIndexPathDoesNotExist {
+		log.Printf("Failed to open search index in %s, recreating: %s", path, err)
+
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+	}
+
+	i, err = bleve.New(path, m)
+	if err != nil {
+		return i, err
+	}
+	return i, i.SetInternal(indexMappingKey, fingerprint)
+}
+
+// indexedNodes returns the URLs of the nodes in the index, mapped to
+// the hashes of the nodes, when they were indexed. Returns nil, when
+// these are unknown.
+func indexedNodes(i bleve.Index) (map[string]string, error) {
+	j, err := i.GetInternal(indexNodesKey)
+	if err != nil || j == nil {
+		return nil, err
+	}
+	var nodes map[string]string
+	return nodes, json.Unmarshal(j, &nodes)
+}
+
+// indexedHash returns the hash of the node tree, the index was built
+// from, or an empty string if it is unknown.
+func indexedHash(i bleve.Index) string {
+	h, err := i.GetInternal(indexHashKey)
+	if err != nil {
+		return ""
+	}
+	return string(h)
+}
+
+// indexedRevision returns the revision of the repository, the index
+// was built from, or an empty string if it is unknown.
+func indexedRevision(i bleve.Index) string {
+	r, err := i.GetInternal(indexRevisionKey)
+	if err != nil {
+		return ""
+	}
+	return string(r)
+}
+
+// NewSearchMapping creates the mapping for the wide or the narrow
+// index. Queries without a field are analyzed using the standard
+// analyzer, all fields are additionally indexed using it, so that
+// i.e. unstemmed words can still be found by prefix.
+func NewSearchMapping(a *Analyzers, facets []string, isWide bool) *mapping.IndexMappingImpl {
 	im := bleve.NewIndexMapping()
 
 	sm := bleve.NewTextFieldMapping()
@@ -101,24 +464,75 @@ func NewSearchMapping(lang string, isWide bool) *mapping.IndexMappingImpl {
 	km := bleve.NewTextFieldMapping()
 	km.Analyzer = keyword.Name
 
-	tm := bleve.NewTextFieldMapping()
-	tm.Analyzer = AvailableSearchLangs[lang]
+	// Token values are i.e. hex colors or dimensions, we want to
+	// analyze them in the same way the query is analyzed.
+	vm := bleve.NewTextFieldMapping()
+	vm.Analyzer = standard.Name
+
+	// Synonyms are added when indexing and when analyzing queries,
+	// which are analyzed using the default analyzer.
+	if len(a.Synonyms) > 0 {
+		if err := addSynonymsAnalyzer(im, a.Synonyms); err != nil {
+			log.Printf("Not using search synonyms: %s", err)
+		} else {
+			vm.Analyzer = synonymsName
+			im.DefaultAnalyzer = synonymsName
+		}
+	}
+
+	tms := []*mapping.FieldMapping{vm}
+	if a.Text != standard.Name {
+		tm := bleve.NewTextFieldMapping()
+		tm.Analyzer = a.Text
+
+		tms = append(tms, tm)
+	}
 
 	node := bleve.NewDocumentMapping()
 
-	node.AddFieldMappingsAt("Title", tm)
-	node.AddFieldMappingsAt("Tags", km)
+	add := func(field string, fms ...*mapping.FieldMapping) {
+		if name, ok := a.Fields[field]; ok {
+			fms = []*mapping.FieldMapping{vm}
+
+			if name != standard.Name {
+				fm := bleve.NewTextFieldMapping()
+				fm.Analyzer = name
+
+				fms = append(fms, fm)
+			}
+		}
+		node.AddFieldMappingsAt(field, fms...)
+	}
+
+	add("Title", tms...)
+	// Tags are searched by prefix, each of their words individually.
+	add("Tags", vm, km)
 	if isWide {
-		node.AddFieldMappingsAt("SecondaryTitles", tm)
-		node.AddFieldMappingsAt("Authors", sm)
-		node.AddFieldMappingsAt("Description", tm)
-		node.AddFieldMappingsAt("Docs", tm)
-		node.AddFieldMappingsAt("Files", sm)
-		node.AddFieldMappingsAt("Version", sm, km)
-		node.AddFieldMappingsAt("Custom", sm)
+		add("SecondaryTitles", tms...)
+		add("Authors", vm, sm)
+		add("Description", tms...)
+		add("Docs", tms...)
+		add("Files", vm, sm)
+		add("Version", vm, sm, km)
+		add("Custom", vm, sm)
+		add("TokenNames", vm, sm, km)
+		add("TokenValues", vm)
+		add("Assets", tms...)
+
+		// Names of the assets, their text has been extracted from,
+		// in the same order as the texts. Not searchable.
+		anm := bleve.NewTextFieldMapping()
+		anm.Index = false
+		anm.IncludeInAll = false
+		node.AddFieldMappingsAt("AssetNames", anm)
+
+		node.AddFieldMappingsAt(suggestField, newSuggestMapping())
+		node.AddSubDocumentMapping("Facets", newFacetsMapping(facets))
 	}
 
-	im.AddDocumentMapping("article", node)
+	// We index anonymous structs, which have no type a document
+	// mapping could be selected by.
+	im.DefaultMapping = node
 	return im
 }
 
@@ -133,31 +547,134 @@ type Search struct {
 	// activated.
 	path string
 
+	isPersistent bool
+
+	// Revision of the repository, the node tree has been checked out
+	// from, or an empty string if it is unknown.
+	revision string
+
 	getNode     ddt.NodeGetter
 	getAllNodes ddt.NodesGetter
 	getTreeHash func() (string, error)
+	getTokens   func(url string) []*tokens.Token
+
+	// Analyzers used in our mapping setup.
+	analyzers *Analyzers
 
-	// Language that should be used in our mapping/analyzer setup.
-	lang string
+	// Names of the facets, hits are counted by.
+	facets []string
+
+	limits *Limits
+
+	relevance *Relevance
 
 	wideIndex   bleve.Index
 	narrowIndex bleve.Index
 
-	// Hash of the node tree that was indexed last.
+	// Hash over the nodes, that were indexed last, see
+	// calculateHash().
 	hash string
+
+	// Hash of the node tree, as it was indexed last, see IsStale().
+	treeHash string
+
+	// Dictionary of the words suggestions are made from, holds an
+	// immutable []*suggestTerm, that is swapped as a whole once the
+	// tree has been indexed. Suggesting never waits for the lock.
+	terms atomic.Value
+
+	// Whether any of the indexed nodes has a search boost, hits are
+	// then re-ranked.
+	isBoosted bool
+
+	// URLs of the indexed nodes, mapped to the hashes of the nodes
+	// when they were indexed, used to detect which nodes changed.
+	indexed map[string]string
+
+	// Ensures the tree is indexed by one caller at a time, while
+	// queries are still answered.
+	indexing sync.Mutex
 }
 
 type FullSearchHit struct {
 	Node      *ddt.Node
 	Fragments []string
+
+	// Relevance of the hit, higher scores are more relevant.
+	Score float64
+
+	// Assets of the node, whose text matched.
+	Assets []*AssetHit
+}
+
+// AssetHit is an asset, whose extracted text matched the query.
+type AssetHit struct {
+	Asset    *ddt.NodeAsset
+	Fragment string
 }
 
+// IsStale tells whether the node tree changed since it was indexed
+// last. The hash of the tree has already been calculated by its last
+// sync, so this is cheap. Takes the lock for reading, so it must not
+// be called while holding it.
 func (s *Search) IsStale() bool {
+	h, err := s.getTreeHash()
+	if err != nil {
+		return true
+	}
 	s.RLock()
 	defer s.RUnlock()
+	return s.treeHash != h
+}
 
-	h, _ := s.getTreeHash()
-	return s.hash != h
+// calculateHash calculates a hash over all nodes, that can be
+// indexed, see nodeHash(). The hashes of the nodes are returned, too,
+// mapped by their URLs.
+func (s *Search) calculateHash(nodes []*ddt.Node) (string, map[string]string, error) {
+	hashes := make(map[string]string, len(nodes))
+	urls := make([]string, 0, len(nodes))
+
+	for _, n := range nodes {
+		// The root node has no URL, that could identify it in the
+		// indexes.
+		if n.URL() == "" {
+			continue
+		}
+		nh, err := s.nodeHash(n)
+		if err != nil {
+			return "", hashes, err
+		}
+		hashes[n.URL()] = nh
+		urls = append(urls, n.URL())
+	}
+	sort.Strings(urls)
+
+	h := sha1.New()
+	for _, url := range urls {
+		fmt.Fprintf(h, "%s:%s\n", url, hashes[url])
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), hashes, nil
+}
+
+// nodeHash calculates a hash over everything that reaches the
+// node's documents in the indexes. The node's hash doesn't cover its
+// authors, which are looked up in the author database, and its
+// tokens, whose aliases are resolved tree-wide.
+func (s *Search) nodeHash(n *ddt.Node) (string, error) {
+	nh, err := n.CalculateHash()
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	h.Write([]byte(nh))
+
+	for _, a := range n.Authors() {
+		fmt.Fprintf(h, "\nauthor:%s:%s", a.Email, a.Name)
+	}
+	for _, t := range s.getTokens(n.URL()) {
+		fmt.Fprintf(h, "\ntoken:%s:%s", t.Name, t.TextValue())
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
 func (s *Search) Close() error {
@@ -170,36 +687,114 @@ func (s *Search) Close() error {
 	return narrowErr
 }
 
-func (s *Search) Refresh() error {
-	s.Lock()
+// Refresh re-indexes the nodes, that changed since the node tree was
+// indexed last. The changes of the last tree sync may be nil, see
+// IndexTree(). We don't ask IsStale() first: the tree's hash doesn't
+// cover the authors of the nodes.
+func (s *Search) Refresh(c *ddt.TreeChanges) error {
+	return s.IndexTree(c)
+}
 
-	// Throw away previous indexes and start from scratch until we
-	// have the needs to incrementally invalidate and re-index.
-	wideIndex, narrowIndex, err := NewIndexes("", s.lang, false)
+// resetIndexes replaces the indexes with empty ones, persisted
+// indexes are removed from disk. Must not be used once the indexes
+// are in use.
+func (s *Search) resetIndexes() error {
+	s.wideIndex.Close()
+	s.narrowIndex.Close()
+
+	if s.isPersistent {
+		for _, p := range []string{"wide.bleve", "narrow.bleve"} {
+			if err := os.RemoveAll(filepath.Join(s.path, p)); err != nil {
+				return err
+			}
+		}
+	}
+	wideIndex, narrowIndex, err := NewIndexes(s.path, s.analyzers, s.facets, s.isPersistent)
 	if err != nil {
-		s.Unlock()
 		return err
 	}
 	s.wideIndex = wideIndex
 	s.narrowIndex = narrowIndex
-	s.Unlock()
-
-	return s.IndexTree()
+	s.indexed = nil
+	return nil
 }
 
-func (s *Search) IndexTree() error {
+// IndexTree indexes the nodes, that have been added or changed since
+// the tree was indexed last, and removes the nodes, that don't exist
+// anymore, from the indexes. The indexes are updated in place, so
+// they can be queried during the update.
+//
+// The changes of the last tree sync, which may be nil, tell which
+// nodes have been changed or removed. As authors and tokens of the
+// nodes are looked up outside of them, all other nodes are still
+// compared by their hashes, see nodeHash(). Their node hashes have
+// already been calculated by the sync, so this is cheap. Without
+// changes, we rely on the hashes alone.
+func (s *Search) IndexTree(c *ddt.TreeChanges) error {
+	s.indexing.Lock()
+	defer s.indexing.Unlock()
+
 	start := time.Now()
 
+	// Calculate the hashes upfront, the tree might change while we
+	// are indexing it.
+	th, err := s.getTreeHash()
+	if err != nil {
+		return err
+	}
+	nodes := s.getAllNodes()
+
+	h, current, err := s.calculateHash(nodes)
+	if err != nil {
+		return err
+	}
+
+	s.RLock()
+	indexed := s.indexed
+	s.RUnlock()
+
 	wideBatch := s.wideIndex.NewBatch()
 	narrowBatch := s.narrowIndex.NewBatch()
 
-	for _, n := range s.getAllNodes() {
+	isChanged := make(map[string]bool)
+	isRemoved := make(map[string]bool)
+
+	if c != nil {
+		for _, url := range c.Changed {
+			isChanged[url] = true
+		}
+		for _, url := range c.Removed {
+			if _, ok := current[url]; !ok {
+				isRemoved[url] = true
+			}
+		}
+	}
+	for url := range indexed {
+		if _, ok := current[url]; !ok {
+			isRemoved[url] = true
+		}
+	}
+
+	var changed int
+
+	for _, n := range nodes {
+		nh, ok := current[n.URL()]
+		if !ok {
+			continue
+		}
+		if ih, ok := indexed[n.URL()]; ok && ih == nh && !isChanged[n.URL()] {
+			continue
+		}
 		if err := s.IndexNode(n, wideBatch, narrowBatch); err != nil {
 			return err
 		}
+		changed++
+	}
+	for url := range isRemoved {
+		wideBatch.Delete(url)
+		narrowBatch.Delete(url)
 	}
 
-	var err error
 	err = s.wideIndex.Batch(wideBatch)
 	if err != nil {
 		return err
@@ -209,18 +804,56 @@ func (s *Search) IndexTree() error {
 		return err
 	}
 
+	// Allows persisted indexes to be reused, see NewSearch().
+	j, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if err := s.wideIndex.SetInternal(indexNodesKey, j); err != nil {
+		return err
+	}
+	if err := s.wideIndex.SetInternal(indexHashKey, []byte(h)); err != nil {
+		return err
+	}
+	if err := s.narrowIndex.SetInternal(indexHashKey, []byte(h)); err != nil {
+		return err
+	}
+	if err := s.wideIndex.SetInternal(indexRevisionKey, []byte(s.revision)); err != nil {
+		return err
+	}
+	if err := s.narrowIndex.SetInternal(indexRevisionKey, []byte(s.revision)); err != nil {
+		return err
+	}
+
+	terms, err := suggestTerms(s.wideIndex)
+	if err != nil {
+		return err
+	}
+
 	took := time.Since(start)
 
 	s.Lock()
-	h, _ := s.getTreeHash()
 	s.hash = h
+	s.treeHash = th
+	s.indexed = current
+	s.isBoosted = isBoosted(nodes)
 	s.Unlock()
 
-	log.Printf("Indexed node tree for search in %s", took)
+	s.terms.Store(terms)
+
+	log.Printf("Indexed %d changed and removed %d node/s for search in %s", changed, len(isRemoved), took)
 	return nil
 }
 
+// IndexNode adds the node to the batches, its children are not
+// indexed. Nodes excluded from search are removed instead.
 func (s *Search) IndexNode(n *ddt.Node, wideBatch, narrowBatch *bleve.Batch) error {
+	if n.IsSearchExcluded() {
+		wideBatch.Delete(n.URL())
+		narrowBatch.Delete(n.URL())
+		return nil
+	}
+
 	var as []string
 	var ts []string
 	var fs []string
@@ -247,6 +880,9 @@ func (s *Search) IndexNode(n *ddt.Node, wideBatch, narrowBatch *bleve.Batch) err
 		secondaryTitles = append(secondaryTitles, doc.Title())
 	}
 
+	var ats []string
+	var ans []string
+
 	assets, err := n.Assets()
 	if err != nil {
 		return err
@@ -254,6 +890,47 @@ func (s *Search) IndexNode(n *ddt.Node, wideBatch, narrowBatch *bleve.Batch) err
 	for _, a := range assets {
 		fs = append(fs, a.Name())
 		secondaryTitles = append(secondaryTitles, a.Title())
+
+		ok, text, err := extractAssetText(a)
+		if err != nil {
+			// Malformed assets should not prevent the node from
+			// being indexed.
+			log.Printf("Not indexing text of %s: %s", a.URL, err)
+		}
+		if ok && err == nil && text != "" {
+			ats = append(ats, text)
+			ans = append(ans, a.Name())
+		}
+
+		// Pages and artboards of design files are titles, too.
+		_, pages, err := a.SketchPages()
+		if err != nil {
+			log.Printf("Not indexing pages of %s: %s", a.URL, err)
+		}
+		for _, p := range pages {
+			secondaryTitles = append(secondaryTitles, p.Name)
+			secondaryTitles = append(secondaryTitles, p.Artboards...)
+		}
+	}
+
+	var tns []string
+	var tvs []string
+
+	for _, t := range s.getTokens(n.URL()) {
+		// Index the name as a whole and its segments, so that
+		// "color.brand.primary" can be found by "primary".
+		tns = append(tns, t.Name, strings.Replace(t.Name, ".", " ", -1))
+		tvs = append(tvs, t.TextValue())
+	}
+
+	fvs, err := facetValues(n, s.facets)
+	if err != nil {
+		return err
+	}
+
+	svs, err := suggestValues(n, docs, s.getNode)
+	if err != nil {
+		return err
 	}
 
 	wideData := struct {
@@ -266,6 +943,12 @@ func (s *Search) IndexNode(n *ddt.Node, wideBatch, narrowBatch *bleve.Batch) err
 		SecondaryTitles []string
 		Version         string
 		Custom          interface{}
+		TokenNames      []string
+		TokenValues     []string
+		Assets          []string
+		AssetNames      []string
+		Facets          map[string][]string
+		Suggest         []string
 	}{
 		Authors:         as,
 		Description:     n.Description(),
@@ -276,6 +959,12 @@ func (s *Search) IndexNode(n *ddt.Node, wideBatch, narrowBatch *bleve.Batch) err
 		SecondaryTitles: secondaryTitles,
 		Version:         n.Version(),
 		Custom:          n.Custom(),
+		TokenNames:      tns,
+		TokenValues:     tvs,
+		Assets:          ats,
+		AssetNames:      ans,
+		Facets:          fvs,
+		Suggest:         svs,
 	}
 	narrowData := struct {
 		Tags  []string
@@ -285,59 +974,107 @@ func (s *Search) IndexNode(n *ddt.Node, wideBatch, narrowBatch *bleve.Batch) err
 		Title: wideData.Title,
 	}
 
-	s.RLock()
-	wideBatch.Index(n.URL(), wideData)
-	narrowBatch.Index(n.URL(), narrowData)
-	s.RUnlock()
-
-	for _, v := range n.Children {
-		s.IndexNode(v, wideBatch, narrowBatch)
+	if err := wideBatch.Index(n.URL(), wideData); err != nil {
+		return err
 	}
-	return nil
+	return narrowBatch.Index(n.URL(), narrowData)
 }
 
 // FullSearch performs a full text search over all possible attributes
-// of each node using the wide index. Returns a slice of FullSearchHits.
+// of each node using the wide index. Returns a slice of FullSearchHits,
+// the first page of them.
 func (s *Search) FullSearch(q string) ([]*FullSearchHit, int, time.Duration, bool, error) {
-	s.RLock()
-	defer s.RUnlock()
+	hits, _, total, took, isStale, err := s.FacetedFullSearch(q, nil, 0, 0)
+	return hits, total, took, isStale, err
+}
 
-	// Prefix query is case sensitive, we want to have it case insensitive.
-	qlower := strings.ToLower(q)
+// Facets returns the names of the facets, hits can be counted by.
+func (s *Search) Facets() []string {
+	return s.facets
+}
 
-	mq := bleve.NewMatchQuery(q)
-	mq.SetFuzziness(1)
+// Limits returns the default and maximum number of results per page.
+func (s *Search) Limits() *Limits {
+	return s.limits
+}
 
-	pq := bleve.NewPrefixQuery(qlower)
+// FacetedFullSearch performs a full text search like FullSearch(),
+// restricted to the selected values of each facet. Additionally
+// returns the number of hits per value, for each facet.
+//
+// Returns the page of hits starting at offset, with at most limit
+// hits, see Limits.SearchLimit(). The total is the number of all hits.
+func (s *Search) FacetedFullSearch(q string, selected map[string][]string, offset int, limit int) ([]*FullSearchHit, []*Facet, int, time.Duration, bool, error) {
+	return s.facetedFullSearch(q, selected, offset, limit, false)
+}
 
-	tmq := bleve.NewMatchQuery(q)
-	tmq.SetField("Title")
-	tmq.SetBoost(2)
+// facetedFullSearch performs a faceted full search, see
+// FacetedFullSearch(). When ignoreMissing is true, clauses referring
+// to aspects, that don't exist, match nothing, instead of failing the
+// query, see fullQuery().
+func (s *Search) facetedFullSearch(q string, selected map[string][]string, offset int, limit int, ignoreMissing bool) ([]*FullSearchHit, []*Facet, int, time.Duration, bool, error) {
+	// Must be checked before taking the lock, see IsStale().
+	isStale := s.IsStale()
 
-	tpq := bleve.NewPrefixQuery(qlower)
-	tpq.SetField("Title")
-	tpq.SetBoost(3)
+	s.RLock()
+	defer s.RUnlock()
 
-	dq := bleve.NewDisjunctionQuery(
-		mq,
-		pq,
-		tmq,
-		tpq,
-	)
+	fq, err := s.fullQuery(q, ignoreMissing)
+	if err != nil {
+		return nil, nil, 0, time.Duration(0), isStale, err
+	}
+	sq, err := facetQuery(s.facets, selected)
+	if err != nil {
+		return nil, nil, 0, time.Duration(0), isStale, err
+	}
+	if sq != nil {
+		fq = bleve.NewConjunctionQuery(fq, sq)
+	}
 
-	req := bleve.NewSearchRequest(dq)
+	limit = s.limits.SearchLimit(limit)
+
+	// Hits of boosted nodes may be ranked higher than the page they
+	// were found on, all hits up to the page's end are re-ranked.
+	from, size := offset, limit
+	if s.isBoosted {
+		from = 0
+		size = offset + limit
+		if size < boostWindow {
+			size = boostWindow
+		}
+	}
+	req := bleve.NewSearchRequestOptions(fq, size, from, false)
 	req.Highlight = bleve.NewHighlight()
-	req.Size = searchResultLimit
+	for _, f := range s.facets {
+		req.AddFacet(f, bleve.NewFacetRequest(facetField(f), facetSize))
+	}
 	res, err := s.wideIndex.Search(req)
 	if err != nil {
-		return nil, 0, time.Duration(0), s.IsStale(), fmt.Errorf("query '%s' failed: %s", q, err)
+		return nil, nil, 0, time.Duration(0), isStale, fmt.Errorf("query '%s' failed: %s", q, err)
+	}
+
+	facets := make([]*Facet, 0, len(s.facets))
+	for _, f := range s.facets {
+		fr, ok := res.Facets[f]
+		if !ok {
+			continue
+		}
+		facet := &Facet{
+			Name:    f,
+			Values:  make([]*FacetValue, 0, len(fr.Terms)),
+			Missing: fr.Missing,
+		}
+		for _, t := range fr.Terms {
+			facet.Values = append(facet.Values, &FacetValue{t.Term, t.Count})
+		}
+		facets = append(facets, facet)
 	}
 
 	hits := make([]*FullSearchHit, 0, len(res.Hits))
 	for _, hit := range res.Hits {
 		ok, n, err := s.getNode(hit.ID)
 		if err != nil {
-			return hits, int(res.Total), res.Took, s.IsStale(), fmt.Errorf("failed to get node for hit %s: %s", hit.ID, err)
+			return hits, facets, int(res.Total), res.Took, isStale, fmt.Errorf("failed to get node for hit %s: %s", hit.ID, err)
 		}
 		if !ok {
 			log.Printf("Node for hit %s not found, skipping hit", hit.ID)
@@ -355,15 +1092,40 @@ func (s *Search) FullSearch(q string) ([]*FullSearchHit, int, time.Duration, boo
 			fragments = append(fragments, subFragment)
 		}
 
-		hits = append(hits, &FullSearchHit{n, fragments})
+		assetHits, err := s.assetHits(n, hit)
+		if err != nil {
+			return hits, facets, int(res.Total), res.Took, isStale, fmt.Errorf("failed to get assets for hit %s: %s", hit.ID, err)
+		}
+		hits = append(hits, &FullSearchHit{n, fragments, hit.Score * n.SearchBoost(), assetHits})
+	}
+
+	if s.isBoosted {
+		sort.SliceStable(hits, func(i, j int) bool {
+			return hits[i].Score > hits[j].Score
+		})
+		if offset > len(hits) {
+			offset = len(hits)
+		}
+		end := offset + limit
+		if end > len(hits) {
+			end = len(hits)
+		}
+		hits = hits[offset:end]
 	}
-	return hits, int(res.Total), res.Took, s.IsStale(), nil
+	return hits, facets, int(res.Total), res.Took, isStale, nil
 }
 
 // FilterSearch performs a narrow restricted prefix search on the
 // node's visible attributes (the title) plus tags using the narrow
 // index by default. Returns a slice of found unique Nodes.
-func (s *Search) FilterSearch(q string) ([]*ddt.Node, int, time.Duration, bool, error) {
+//
+// Returns the page of nodes starting at offset, with at most limit
+// nodes, see Limits.FilterLimit(). The total is the number of all
+// found nodes.
+func (s *Search) FilterSearch(q string, offset int, limit int) ([]*ddt.Node, int, time.Duration, bool, error) {
+	// Must be checked before taking the lock, see IsStale().
+	isStale := s.IsStale()
+
 	s.RLock()
 	defer s.RUnlock()
 
@@ -384,33 +1146,29 @@ func (s *Search) FilterSearch(q string) ([]*ddt.Node, int, time.Duration, bool,
 	}
 
 	cq := bleve.NewConjunctionQuery(pqs...)
-	req := bleve.NewSearchRequest(cq)
-	req.Size = filterResultLimit
+	req := bleve.NewSearchRequestOptions(cq, s.limits.FilterLimit(limit), offset, false)
 
 	res, err := s.narrowIndex.Search(req)
 
 	if err != nil {
-		return nil, 0, time.Duration(0), s.IsStale(), fmt.Errorf("query '%s' failed: %s", q, err)
+		return nil, 0, time.Duration(0), isStale, fmt.Errorf("query '%s' failed: %s", q, err)
 	}
 
+	// Each node is indexed as a single document, hits are unique
+	// nodes. The total counts all hits, not just the ones of the page.
 	var nodes []*ddt.Node
-	seen := make(map[string]bool)
 	for _, hit := range res.Hits {
 		ok, n, err := s.getNode(hit.ID)
 		if err != nil {
-			return nodes, len(nodes), res.Took, s.IsStale(), fmt.Errorf("failed to get node for hit %s: %s", hit.ID, err)
-		}
-		if _, hasSeen := seen[n.URL()]; hasSeen {
-			continue // Keep nodes unique.
+			return nodes, int(res.Total), res.Took, isStale, fmt.Errorf("failed to get node for hit %s: %s", hit.ID, err)
 		}
 		if !ok {
 			log.Printf("Node for hit %s not found, skipping hit", hit.ID)
 			continue
 		}
 		nodes = append(nodes, n)
-		seen[n.URL()] = true
 	}
-	return nodes, len(nodes), res.Took, s.IsStale(), nil
+	return nodes, int(res.Total), res.Took, isStale, nil
 }
 
 // LegacyFilterSearch performs a narrow restricted haystack/needle
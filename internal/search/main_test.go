@@ -11,13 +11,16 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/blevesearch/bleve"
 	"github.com/rundsk/dsk/internal/author"
+	"github.com/rundsk/dsk/internal/bus"
 	"github.com/rundsk/dsk/internal/config"
 	"github.com/rundsk/dsk/internal/ddt"
 	"github.com/rundsk/dsk/internal/meta"
+	"github.com/rundsk/dsk/internal/tokens"
 )
 
 // Tests for FullSearch:
@@ -191,6 +194,79 @@ func TestFullSearchConsidersSecondaryTitles(t *testing.T) {
 	expectFullSearchResult(t, rs, "Diversity")
 }
 
+func TestFullSearchConsidersTokens(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n.Create()
+	ioutil.WriteFile(filepath.Join(n.Path, "tokens.yml"), []byte("color:\n  brand:\n    ultramarine: \"#0055ff\"\n"), 0666)
+	n.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n}, false)
+	defer teardownSearchTest(tmp, s)
+
+	rs, _, _, _, _ := s.FullSearch("ultramarine")
+	expectFullSearchResult(t, rs, "Colors")
+
+	rs, _, _, _, _ = s.FullSearch("#0055ff")
+	expectFullSearchResult(t, rs, "Colors")
+}
+
+func TestFullSearchTokensResolvedAcrossNodes(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n0.Create()
+	ioutil.WriteFile(filepath.Join(n0.Path, "tokens.yml"), []byte("palette:\n  ultramarine: \"#0055ff\"\n"), 0666)
+	ioutil.WriteFile(filepath.Join(n0.Path, "broken.tokens.json"), []byte(`{"palette": `), 0666)
+
+	n1 := newTestNode(filepath.Join(tmp, "Button"), tmp)
+	n1.Create()
+	ioutil.WriteFile(filepath.Join(n1.Path, "tokens.json"), []byte(`{"button": {"background": {"$value": "{palette.ultramarine}"}}}`), 0666)
+
+	b, _ := bus.NewBroker()
+	defer b.Close()
+
+	tree, err := ddt.NewTree(tmp, config.NewStaticDB("example"), author.NewNoopDB(), meta.NewNoopDB(), b)
+	if err != nil {
+		t.Fatalf("Failed to create tree: %s", err)
+	}
+	tdb, err := tokens.NewDB(tree)
+	if err != nil {
+		t.Fatalf("Failed to create tokens database: %s", err)
+	}
+
+	s := setupSearchTest(t, tmp, "en", nil, false)
+	defer teardownSearchTest(tmp, s)
+
+	// Includes the root node, which cannot be indexed.
+	s.getNode = tree.Get
+	s.getAllNodes = tree.GetAll
+	s.getTreeHash = tree.CalculateHash
+	s.getTokens = tdb.ForNode
+
+	if err := s.IndexTree(nil); err != nil {
+		t.Fatalf("Failed to index tree: %s", err)
+	}
+
+	// The malformed file doesn't prevent the node's other tokens
+	// from being indexed, the alias is resolved from another node.
+	rs, _, _, _, _ := s.FullSearch("#0055ff")
+	expectFullSearchResult(t, rs, "Colors")
+	expectFullSearchResult(t, rs, "Button")
+
+	// Button didn't change, but the token it aliases did.
+	ioutil.WriteFile(filepath.Join(tmp, "Colors", "tokens.yml"), []byte("palette:\n  ultramarine: \"#0033cc\"\n"), 0666)
+	tree.Sync()
+	tdb.Refresh()
+
+	if err := s.IndexTree(&ddt.TreeChanges{Changed: []string{"Colors"}}); err != nil {
+		t.Fatalf("Failed to index tree: %s", err)
+	}
+	rs, _, _, _, _ = s.FullSearch("#0033cc")
+	expectFullSearchResult(t, rs, "Button")
+}
+
 func TestFullSearchAuthorsEmail(t *testing.T) {
 	tmp, _ := ioutil.TempDir("", "tree")
 
@@ -328,13 +404,13 @@ func TestFilterSearchPrefixes(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("c")
+	rs, _, _, _, _ := s.FilterSearch("c", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 
-	rs, _, _, _, _ = s.FilterSearch("co")
+	rs, _, _, _, _ = s.FilterSearch("co", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 
-	rs, _, _, _, _ = s.FilterSearch("col")
+	rs, _, _, _, _ = s.FilterSearch("col", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 }
 
@@ -348,10 +424,10 @@ func TestFilterSearchWordPartials(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("na")
+	rs, _, _, _, _ := s.FilterSearch("na", 0, 0)
 	expectFilterSearchResult(t, rs, "Navigation")
 
-	rs, _, _, _, _ = s.FilterSearch("naviga")
+	rs, _, _, _, _ = s.FilterSearch("naviga", 0, 0)
 	expectFilterSearchResult(t, rs, "Navigation")
 }
 
@@ -365,10 +441,10 @@ func TestFilterSearchGermanWordPartials(t *testing.T) {
 	s := setupSearchTest(t, tmp, "de", []*ddt.Node{n}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("diversit")
+	rs, _, _, _, _ := s.FilterSearch("diversit", 0, 0)
 	expectFilterSearchResult(t, rs, "Diversitat")
 
-	rs, _, _, _, _ = s.FilterSearch("diversitä")
+	rs, _, _, _, _ = s.FilterSearch("diversitä", 0, 0)
 	expectFilterSearchResult(t, rs, "Diversitat")
 }
 
@@ -399,7 +475,7 @@ func TestFilterSearchTags(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1, n2}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("react")
+	rs, _, _, _, _ := s.FilterSearch("react", 0, 0)
 	expectFilterSearchResult(t, rs, "Button")
 	expectFilterSearchResult(t, rs, "Form-Element")
 	expectFilterSearchResult(t, rs, "Radio-Button-Group")
@@ -432,25 +508,25 @@ func TestFilterSearchMultipleTagsWithLogicalAndInQuery(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1, n2}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("foo")
+	rs, _, _, _, _ := s.FilterSearch("foo", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectFilterSearchResult(t, rs, "Navigation")
 
-	rs, _, _, _, _ = s.FilterSearch("bar")
+	rs, _, _, _, _ = s.FilterSearch("bar", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectFilterSearchResult(t, rs, "Type")
 
-	rs, _, _, _, _ = s.FilterSearch("foo bar")
+	rs, _, _, _, _ = s.FilterSearch("foo bar", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectNoFilterSearchResult(t, rs, "Navigation")
 	expectNoFilterSearchResult(t, rs, "Type")
 
-	rs, _, _, _, _ = s.FilterSearch("foo col")
+	rs, _, _, _, _ = s.FilterSearch("foo col", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectNoFilterSearchResult(t, rs, "Navigation")
 	expectNoFilterSearchResult(t, rs, "Type")
 
-	rs, _, _, _, _ = s.FilterSearch("foo shadows")
+	rs, _, _, _, _ = s.FilterSearch("foo shadows", 0, 0)
 	expectNoFilterSearchResult(t, rs, "Colors")
 	expectNoFilterSearchResult(t, rs, "Navigation")
 	expectNoFilterSearchResult(t, rs, "Type")
@@ -465,13 +541,13 @@ func TestFilterSearchIsCaseInsensitive(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("colors")
+	rs, _, _, _, _ := s.FilterSearch("colors", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 
-	rs, _, _, _, _ = s.FilterSearch("Colors")
+	rs, _, _, _, _ = s.FilterSearch("Colors", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 
-	rs, _, _, _, _ = s.FilterSearch("coLOrs")
+	rs, _, _, _, _ = s.FilterSearch("coLOrs", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 }
 
@@ -502,17 +578,17 @@ func TestFilterSearchNamespacedTags(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1, n2}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("status")
+	rs, _, _, _, _ := s.FilterSearch("status", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectFilterSearchResult(t, rs, "Navigation")
 	expectNoFilterSearchResult(t, rs, "Type")
 
-	rs, _, _, _, _ = s.FilterSearch("status/draft")
+	rs, _, _, _, _ = s.FilterSearch("status/draft", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectNoFilterSearchResult(t, rs, "Navigation")
 	expectNoFilterSearchResult(t, rs, "Type")
 
-	rs, _, _, _, _ = s.FilterSearch("draft")
+	rs, _, _, _, _ = s.FilterSearch("draft", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 	expectNoFilterSearchResult(t, rs, "Navigation")
 	expectFilterSearchResult(t, rs, "Type")
@@ -531,13 +607,13 @@ func TestFilterSearchTagsWithSpaces(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("needs")
+	rs, _, _, _, _ := s.FilterSearch("needs", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 
-	rs, _, _, _, _ = s.FilterSearch("images")
+	rs, _, _, _, _ = s.FilterSearch("images", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 
-	rs, _, _, _, _ = s.FilterSearch("needs images")
+	rs, _, _, _, _ = s.FilterSearch("needs images", 0, 0)
 	expectFilterSearchResult(t, rs, "Colors")
 }
 
@@ -554,13 +630,13 @@ func TestFilterSearchTagsWithSpacesWhenTitleContainsSpace(t *testing.T) {
 	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("needs")
+	rs, _, _, _, _ := s.FilterSearch("needs", 0, 0)
 	expectFilterSearchResult(t, rs, "Color-Definition")
 
-	rs, _, _, _, _ = s.FilterSearch("images")
+	rs, _, _, _, _ = s.FilterSearch("images", 0, 0)
 	expectFilterSearchResult(t, rs, "Color-Definition")
 
-	rs, _, _, _, _ = s.FilterSearch("needs images")
+	rs, _, _, _, _ = s.FilterSearch("needs images", 0, 0)
 	expectFilterSearchResult(t, rs, "Color-Definition")
 }
 
@@ -596,7 +672,7 @@ func TestFilterSearchMoreThan10Results(t *testing.T) {
 	}, false)
 	defer teardownSearchTest(tmp, s)
 
-	rs, _, _, _, _ := s.FilterSearch("foo")
+	rs, _, _, _, _ := s.FilterSearch("foo", 0, 0)
 	expectFilterSearchResult(t, rs, "Node-0")
 	expectFilterSearchResult(t, rs, "Node-1")
 	expectFilterSearchResult(t, rs, "Node-2")
@@ -612,6 +688,334 @@ func TestFilterSearchMoreThan10Results(t *testing.T) {
 	expectFilterSearchResult(t, rs, "Node-12")
 }
 
+func TestIndexTreeIsIncremental(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	a := newTestNode(filepath.Join(tmp, "Alpha"), tmp)
+	a.Create()
+	b := newTestNode(filepath.Join(tmp, "Beta"), tmp)
+	b.Create()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{a, b}, false)
+	defer teardownSearchTest(tmp, s)
+
+	// Simulate a tree sync: Beta has been renamed to Gamma.
+	os.Rename(b.Path, filepath.Join(tmp, "Gamma"))
+	g := newTestNode(filepath.Join(tmp, "Gamma"), tmp)
+	a = newTestNode(filepath.Join(tmp, "Alpha"), tmp)
+
+	s.getNode = func(url string) (bool, *ddt.Node, error) {
+		for _, n := range []*ddt.Node{a, g} {
+			if n.URL() == url {
+				return true, n, nil
+			}
+		}
+		return false, nil, nil
+	}
+	s.getAllNodes = func() []*ddt.Node {
+		return []*ddt.Node{a, g}
+	}
+	if !s.IsStale() {
+		t.Fatal("Expected search to be stale")
+	}
+	if err := s.Refresh(&ddt.TreeChanges{Changed: []string{"Gamma"}, Removed: []string{"Beta"}}); err != nil {
+		t.Fatalf("Failed to refresh: %s", err)
+	}
+
+	if c, _ := s.wideIndex.DocCount(); c != 2 {
+		t.Errorf("Expected 2 documents in wide index, got: %d", c)
+	}
+	if c, _ := s.narrowIndex.DocCount(); c != 2 {
+		t.Errorf("Expected 2 documents in narrow index, got: %d", c)
+	}
+	rs, _, _, _, _ := s.FullSearch("gamma")
+	expectFullSearchResult(t, rs, "Gamma")
+
+	rs, _, _, _, _ = s.FullSearch("beta")
+	expectNoFullSearchResult(t, rs, "Beta")
+
+	if len(s.indexed) != 2 || s.indexed["Alpha"] == "" || s.indexed["Gamma"] == "" {
+		t.Errorf("Unexpected indexed nodes: %v", s.indexed)
+	}
+}
+
+// Tests for pagination:
+
+func TestNewLimits(t *testing.T) {
+	l := NewLimits(&config.SearchConfig{Limit: 20, MaxLimit: 10, FilterLimit: 100})
+
+	if l.Search != 10 || l.MaxSearch != 10 {
+		t.Errorf("Expected default to be capped by maximum, got: %d/%d", l.Search, l.MaxSearch)
+	}
+	if l.Filter != 100 || l.MaxFilter != maxFilterResultLimit {
+		t.Errorf("Expected configured filter limit, got: %d/%d", l.Filter, l.MaxFilter)
+	}
+
+	expected := map[int]int{0: 100, -1: 100, 5: 5, 5000: maxFilterResultLimit}
+	for limit, e := range expected {
+		if r := l.FilterLimit(limit); r != e {
+			t.Errorf("Expected limit %d for requested %d, got: %d", e, limit, r)
+		}
+	}
+}
+
+func TestSearchPagination(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	var nodes []*ddt.Node
+	for _, name := range []string{"Color1", "Color2", "Color3", "Color4", "Color5"} {
+		n := newTestNode(filepath.Join(tmp, name), tmp)
+		n.Create()
+		n.Load()
+		nodes = append(nodes, n)
+	}
+
+	s := setupSearchTest(t, tmp, "en", nodes, false)
+	defer teardownSearchTest(tmp, s)
+
+	seen := make(map[string]bool)
+	for offset := 0; offset < 5; offset += 2 {
+		ns, total, _, _, err := s.FilterSearch("color", offset, 2)
+		if err != nil {
+			t.Fatalf("Failed to search: %s", err)
+		}
+		if total != 5 {
+			t.Errorf("Expected total of all pages, got: %d", total)
+		}
+		for _, n := range ns {
+			seen[n.URL()] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("Expected all nodes across pages, got: %v", seen)
+	}
+
+	hits, _, total, _, _, _ := s.FacetedFullSearch("color", nil, 4, 2)
+	if len(hits) != 1 || total != 5 {
+		t.Errorf("Expected 1 hit on last page of 5 hits, got %d of %d", len(hits), total)
+	}
+}
+
+// Tests for analyzers:
+
+func TestAnalyzersFallBackToLanguageNeutral(t *testing.T) {
+	expected := map[string]string{
+		"en":    "en",
+		"pt-BR": "pt",
+		"zh_TW": "cjk",
+		"ja":    "cjk",
+		"xx":    "standard",
+		"":      "standard",
+	}
+	for lang, e := range expected {
+		if a := NewAnalyzers(lang, nil); a.Text != e {
+			t.Errorf("Expected analyzer %s for language '%s', got: %s", e, lang, a.Text)
+		}
+	}
+}
+
+func TestAnalyzersConfiguration(t *testing.T) {
+	a := NewAnalyzers("en", &config.SearchConfig{
+		Analyzer: "cjk",
+		Fields: map[string]string{
+			"docs":    "fr",
+			"Title":   "unknown",
+			"Unknown": "de",
+		},
+	})
+	if a.Text != "cjk" {
+		t.Errorf("Expected configured text analyzer, got: %s", a.Text)
+	}
+	if len(a.Fields) != 1 || a.Fields["Docs"] != "fr" {
+		t.Errorf("Expected only known fields and analyzers, got: %v", a.Fields)
+	}
+
+	a = NewAnalyzers("en", &config.SearchConfig{Analyzer: "unknown"})
+	if a.Text != "en" {
+		t.Errorf("Expected unknown analyzer to be ignored, got: %s", a.Text)
+	}
+}
+
+func TestSearchMappingUsesAnalyzers(t *testing.T) {
+	m := NewSearchMapping(&Analyzers{
+		Text:   "de",
+		Fields: map[string]string{"Docs": "fr"},
+	}, nil, true)
+
+	analyzers := func(field string) []string {
+		var as []string
+		for _, fm := range m.DefaultMapping.Properties[field].Fields {
+			as = append(as, fm.Analyzer)
+		}
+		return as
+	}
+	if as := analyzers("Description"); !reflect.DeepEqual(as, []string{"standard", "de"}) {
+		t.Errorf("Expected language analyzer for description, got: %v", as)
+	}
+	if as := analyzers("Docs"); !reflect.DeepEqual(as, []string{"standard", "fr"}) {
+		t.Errorf("Expected configured analyzer for docs, got: %v", as)
+	}
+}
+
+func TestFullSearchWithUnsupportedLanguage(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n.Create()
+	n.CreateDoc("readme.md", []byte("Färger och typografi"))
+	n.Load()
+
+	s := setupSearchTest(t, tmp, "is", []*ddt.Node{n}, false)
+	defer teardownSearchTest(tmp, s)
+
+	rs, _, _, _, _ := s.FullSearch("typografi")
+	expectFullSearchResult(t, rs, "Colors")
+}
+
+// Tests for persistence:
+
+func TestPersistedIndexesAreReused(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	searchPath, _ := ioutil.TempDir("", "search")
+	defer os.RemoveAll(searchPath)
+
+	n := newTestNode(filepath.Join(tmp, "Navigation"), tmp)
+	n.Create()
+
+	wideIndex, narrowIndex, err := NewIndexes(searchPath, NewAnalyzers("en", nil), NewFacets(nil), true)
+	if err != nil {
+		t.Fatalf("Failed to create indexes: %s", err)
+	}
+	s := &Search{
+		path:         searchPath,
+		isPersistent: true,
+		getNode: func(url string) (bool, *ddt.Node, error) {
+			return url == n.URL(), n, nil
+		},
+		getAllNodes: func() []*ddt.Node {
+			return []*ddt.Node{n}
+		},
+		getTreeHash: n.CalculateHash,
+		getTokens: func(url string) []*tokens.Token {
+			return nil
+		},
+		analyzers:   NewAnalyzers("en", nil),
+		facets:      NewFacets(nil),
+		limits:      NewLimits(nil),
+		relevance:   NewRelevance(nil),
+		wideIndex:   wideIndex,
+		narrowIndex: narrowIndex,
+	}
+	if err := s.IndexTree(nil); err != nil {
+		t.Fatalf("Failed to index tree: %s", err)
+	}
+	hash := s.hash
+	teardownSearchTest(tmp, s)
+
+	wideIndex, narrowIndex, err = NewIndexes(searchPath, NewAnalyzers("en", nil), NewFacets(nil), true)
+	if err != nil {
+		t.Fatalf("Failed to open indexes: %s", err)
+	}
+	if h := indexedHash(wideIndex); h == "" || h != hash {
+		t.Errorf("Expected hash of indexed tree to be persisted, got: %s", h)
+	}
+	if c, _ := narrowIndex.DocCount(); c != 1 {
+		t.Errorf("Expected indexed node to be persisted, got %d documents", c)
+	}
+	wideIndex.Close()
+	narrowIndex.Close()
+
+	// A different language requires a different mapping.
+	wideIndex, narrowIndex, err = NewIndexes(searchPath, NewAnalyzers("de", nil), NewFacets(nil), true)
+	if err != nil {
+		t.Fatalf("Failed to open indexes: %s", err)
+	}
+	defer wideIndex.Close()
+	defer narrowIndex.Close()
+
+	if h := indexedHash(wideIndex); h != "" {
+		t.Errorf("Expected index to be recreated, got hash: %s", h)
+	}
+	if c, _ := narrowIndex.DocCount(); c != 0 {
+		t.Errorf("Expected index to be recreated, got %d documents", c)
+	}
+}
+
+func TestPersistedIndexesAreReusedByRevision(t *testing.T) {
+	searchPath, _ := ioutil.TempDir("", "search")
+	defer os.RemoveAll(searchPath)
+
+	b, _ := bus.NewBroker()
+	defer b.Close()
+
+	// The same revision is checked out into different directories.
+	newTree := func() *ddt.Tree {
+		tmp, _ := ioutil.TempDir("", "tree")
+		n := newTestNode(filepath.Join(tmp, "Navigation"), tmp)
+		n.Create()
+
+		tree, err := ddt.NewTree(tmp, config.NewStaticDB("example"), author.NewNoopDB(), meta.NewNoopDB(), b)
+		if err != nil {
+			t.Fatalf("Failed to create tree: %s", err)
+		}
+		return tree
+	}
+
+	tree := newTree()
+	defer os.RemoveAll(tree.Path)
+
+	wideIndex, narrowIndex, err := NewIndexes(searchPath, NewAnalyzers("en", nil), NewFacets(nil), true)
+	if err != nil {
+		t.Fatalf("Failed to create indexes: %s", err)
+	}
+	s := &Search{
+		path:         searchPath,
+		isPersistent: true,
+		revision:     "abc",
+		getNode:      tree.Get,
+		getAllNodes:  tree.GetAll,
+		getTreeHash:  tree.CalculateHash,
+		getTokens: func(url string) []*tokens.Token {
+			return nil
+		},
+		analyzers:   NewAnalyzers("en", nil),
+		facets:      NewFacets(nil),
+		limits:      NewLimits(nil),
+		relevance:   NewRelevance(nil),
+		wideIndex:   wideIndex,
+		narrowIndex: narrowIndex,
+	}
+	if err := s.IndexTree(nil); err != nil {
+		t.Fatalf("Failed to index tree: %s", err)
+	}
+	previous := s.hash
+	s.Close()
+
+	tree = newTree()
+	defer os.RemoveAll(tree.Path)
+
+	tdb, err := tokens.NewDB(tree)
+	if err != nil {
+		t.Fatalf("Failed to create tokens database: %s", err)
+	}
+	s, err = NewSearch(searchPath, "abc", tree, tdb, "en", nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create search: %s", err)
+	}
+	defer s.Close()
+
+	// Reused indexes are ready right away, otherwise the tree is
+	// indexed in the background.
+	if s.hash == "" || s.hash == previous {
+		t.Errorf("Expected indexes to be reused with the hash of the new tree, got: %s", s.hash)
+	}
+	if len(s.indexed) != 1 || s.indexed["Navigation"] == "" {
+		t.Errorf("Unexpected indexed nodes: %v", s.indexed)
+	}
+	rs, _, _, _, _ := s.FullSearch("navigation")
+	expectFullSearchResult(t, rs, "Navigation")
+}
+
 // Search test helpers:
 
 func newTestNode(path string, root string) *ddt.Node {
@@ -626,9 +1030,9 @@ func setupSearchTest(t *testing.T, tmp string, lang string, nodes []*ddt.Node, d
 
 	if dumpIndex {
 		searchPath, _ := ioutil.TempDir("", "dsk"+t.Name())
-		wideIndex, narrowIndex, _ = NewIndexes(searchPath, lang, true)
+		wideIndex, narrowIndex, _ = NewIndexes(searchPath, NewAnalyzers(lang, nil), NewFacets(nil), true)
 	} else {
-		wideIndex, narrowIndex, _ = NewIndexes("", lang, false)
+		wideIndex, narrowIndex, _ = NewIndexes("", NewAnalyzers(lang, nil), NewFacets(nil), false)
 	}
 
 	lookup := make(map[string]*ddt.Node)
@@ -651,14 +1055,26 @@ func setupSearchTest(t *testing.T, tmp string, lang string, nodes []*ddt.Node, d
 			}
 			return ns
 		},
-		getTreeHash: func() (string, error) {
-			return "<node-tree-hash>", nil
-		},
-		lang:        lang,
+		analyzers:   NewAnalyzers(lang, nil),
+		facets:      NewFacets(nil),
+		limits:      NewLimits(nil),
+		relevance:   NewRelevance(nil),
 		wideIndex:   wideIndex,
 		narrowIndex: narrowIndex,
 	}
-	s.IndexTree()
+	// Tests replace the node getters, tokens are resolved only
+	// inside their node, see TestFullSearchTokensResolvedAcrossNodes.
+	s.getTokens = func(url string) []*tokens.Token {
+		_, n, _ := s.getNode(url)
+		ts, _ := tokens.FromNode(n)
+		return ts
+	}
+	// Without a tree, the nodes stand in for it.
+	s.getTreeHash = func() (string, error) {
+		h, _, err := s.calculateHash(s.getAllNodes())
+		return h, err
+	}
+	s.IndexTree(nil)
 	return s
 }
 
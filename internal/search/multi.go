@@ -0,0 +1,130 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxMultiSearchOffset is the largest offset, a full search across
+// multiple searches accepts. Each search must provide all of its hits
+// up to the page's end, see MultiFullSearch().
+const MaxMultiSearchOffset = 1000
+
+// MultiFullSearchHit is a hit of a full search across multiple
+// searches, i.e. one per version.
+type MultiFullSearchHit struct {
+	*FullSearchHit
+
+	// Name of the search, the hit was found in.
+	Name string
+}
+
+// MultiFullSearch performs a faceted full search on each of the given
+// searches concurrently, these are keyed by name. Hits are merged by
+// their score and facets by their values. The total is the sum of
+// all totals, took is the time the slowest search took.
+//
+// Searches, which lack an aspect the query refers to, i.e. older
+// versions, contribute no hits for that clause, instead of failing
+// the whole search. Only an invalid query fails.
+//
+// Returns the page of hits starting at offset, with at most limit
+// hits. The limit must have been checked against the searches'
+// limits already, the offset must not exceed MaxMultiSearchOffset.
+func MultiFullSearch(searches map[string]*Search, q string, selected map[string][]string, offset int, limit int) ([]*MultiFullSearchHit, []*Facet, int, time.Duration, error) {
+	if offset > MaxMultiSearchOffset {
+		return nil, nil, 0, time.Duration(0), fmt.Errorf("offset must not exceed %d", MaxMultiSearchOffset)
+	}
+
+	type result struct {
+		hits   []*MultiFullSearchHit
+		facets []*Facet
+		total  int
+		took   time.Duration
+		err    error
+	}
+	results := make(chan *result, len(searches))
+
+	var wg sync.WaitGroup
+	for name, s := range searches {
+		wg.Add(1)
+
+		go func(name string, s *Search) {
+			defer wg.Done()
+			r := &result{}
+
+			// The page may start with hits of any of the searches, each
+			// search must provide all the hits up to the page's end.
+			// These are fetched in pages as large as the search allows.
+			size := s.Limits().SearchLimit(offset + limit)
+
+			for fetched := 0; fetched < offset+limit; fetched += size {
+				hits, facets, total, took, _, err := s.facetedFullSearch(q, selected, fetched, size, true)
+				if err != nil {
+					r.err = err
+					break
+				}
+				if r.facets == nil {
+					r.facets = facets
+				}
+				r.total = total
+				r.took += took
+
+				for _, hit := range hits {
+					r.hits = append(r.hits, &MultiFullSearchHit{hit, name})
+				}
+				if fetched+size >= total {
+					break
+				}
+			}
+			results <- r
+		}(name, s)
+	}
+	wg.Wait()
+	close(results)
+
+	var hits []*MultiFullSearchHit
+	var facets [][]*Facet
+	var total int
+	var took time.Duration
+
+	for r := range results {
+		if r.err != nil {
+			return nil, nil, 0, took, r.err
+		}
+		hits = append(hits, r.hits...)
+		facets = append(facets, r.facets)
+		total += r.total
+
+		if r.took > took {
+			took = r.took
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		// Order equally scored hits deterministically.
+		if hits[i].Name != hits[j].Name {
+			return hits[i].Name < hits[j].Name
+		}
+		return hits[i].Node.URL() < hits[j].Node.URL()
+	})
+
+	if offset > len(hits) {
+		offset = len(hits)
+	}
+	end := offset + limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[offset:end], MergeFacets(facets...), total, took, nil
+}
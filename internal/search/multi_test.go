@@ -0,0 +1,105 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+func TestMultiFullSearch(t *testing.T) {
+	tmp0, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp0, "Button"), tmp0)
+	n0.Create()
+	n0.CreateMeta("meta.yaml", &ddt.NodeMeta{Tags: []string{"actions"}})
+	n0.Load()
+
+	s0 := setupSearchTest(t, tmp0, "en", []*ddt.Node{n0}, false)
+	defer teardownSearchTest(tmp0, s0)
+
+	tmp1, _ := ioutil.TempDir("", "tree")
+
+	n1 := newTestNode(filepath.Join(tmp1, "Button"), tmp1)
+	n1.Create()
+	n1.CreateMeta("meta.yaml", &ddt.NodeMeta{Tags: []string{"actions"}})
+	n1.Load()
+
+	n2 := newTestNode(filepath.Join(tmp1, "Button Group"), tmp1)
+	n2.Create()
+	n2.CreateMeta("meta.yaml", &ddt.NodeMeta{Tags: []string{"layout"}})
+	n2.Load()
+
+	s1 := setupSearchTest(t, tmp1, "en", []*ddt.Node{n1, n2}, false)
+	defer teardownSearchTest(tmp1, s1)
+
+	searches := map[string]*Search{"1.0.0": s0, "2.0.0": s1}
+
+	hits, facets, total, _, err := MultiFullSearch(searches, "button", nil, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to search: %s", err)
+	}
+	if total != 3 || len(hits) != 3 {
+		t.Fatalf("Expected 3 hits in total, got %d of %d", len(hits), total)
+	}
+	versions := make(map[string]int)
+	for i, hit := range hits {
+		versions[hit.Name]++
+
+		if i > 0 && hit.Score > hits[i-1].Score {
+			t.Errorf("Expected hits to be ordered by score, got: %f after %f", hit.Score, hits[i-1].Score)
+		}
+	}
+	if versions["1.0.0"] != 1 || versions["2.0.0"] != 2 {
+		t.Errorf("Expected hits to be annotated with their version, got: %v", versions)
+	}
+
+	for _, f := range facets {
+		if f.Name != "tag" {
+			continue
+		}
+		if len(f.Values) != 2 || f.Values[0].Value != "actions" || f.Values[0].Count != 2 {
+			t.Errorf("Expected merged tag counts, got: %v", f.Values)
+		}
+	}
+
+	page, _, total, _, _ := MultiFullSearch(searches, "button", nil, 2, 2)
+	if total != 3 || len(page) != 1 {
+		t.Fatalf("Expected 1 hit on second page, got %d of %d", len(page), total)
+	}
+	if page[0].Name != hits[2].Name || page[0].Node.URL() != hits[2].Node.URL() {
+		t.Errorf("Expected last hit on second page, got: %s in %s", page[0].Node.URL(), page[0].Name)
+	}
+
+	_, _, _, _, err = MultiFullSearch(searches, `"button`, nil, 0, 10)
+	if err == nil {
+		t.Errorf("Expected query error")
+	}
+
+	// Only the newer version has the aspect.
+	hits, _, total, _, err = MultiFullSearch(searches, "button under:"+n2.URL(), nil, 0, 10)
+	if err != nil {
+		t.Fatalf("Expected aspect missing in a version not to fail the search, got: %s", err)
+	}
+	if total != 1 || hits[0].Name != "2.0.0" || hits[0].Node.URL() != n2.URL() {
+		t.Errorf("Expected single hit in newer version, got %d hits", total)
+	}
+	hits, _, total, _, err = MultiFullSearch(searches, "button -under:"+n2.URL(), nil, 0, 10)
+	if err != nil {
+		t.Fatalf("Expected aspect missing in a version not to fail the search, got: %s", err)
+	}
+	if total != 2 {
+		t.Errorf("Expected both buttons as hits, got %d hits", total)
+	}
+
+	_, _, _, _, err = MultiFullSearch(searches, "button", nil, MaxMultiSearchOffset+1, 10)
+	if err == nil {
+		t.Errorf("Expected error for offset beyond maximum")
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+)
+
+// QueryFields maps the fields, that can be used in queries, to the
+// fields of the wide index. Custom fields are selected via
+// "custom.<name>", subtrees via "under".
+var QueryFields = map[string]string{
+	"tag":     "Tags",
+	"author":  "Authors",
+	"version": "Version",
+}
+
+// QueryError describes why a query is invalid.
+type QueryError struct {
+	// Position of the offending character inside the query, 1-based
+	// and counted in characters.
+	Position int
+
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Position, e.Message)
+}
+
+// queryClause is a single whitespace separated part of a query,
+// i.e. "-tag:deprecated" or "\"date picker\"".
+type queryClause struct {
+	// Position of the clause inside the query, 1-based.
+	Position int
+
+	// Matching nodes are excluded, the clause was prefixed with "-".
+	IsNegated bool
+
+	// Field as given in the query, i.e. "tag" or "custom.platform",
+	// empty for free text.
+	Field string
+
+	Value string
+
+	// The value was quoted and must match as a whole.
+	IsPhrase bool
+}
+
+// parseQuery splits the query into clauses. The syntax is:
+//
+//	clause = ["-"] [field ":"] (word | '"' phrase '"')
+//
+// Clauses are separated by whitespace. Fields are the ones of
+// QueryFields, "custom.<name>" and "under".
+func parseQuery(q string) ([]*queryClause, error) {
+	clauses := make([]*queryClause, 0)
+	rs := []rune(q)
+
+	i := 0
+	for {
+		for i < len(rs) && unicode.IsSpace(rs[i]) {
+			i++
+		}
+		if i >= len(rs) {
+			return clauses, nil
+		}
+		c := &queryClause{Position: i + 1}
+
+		if rs[i] == '-' {
+			c.IsNegated = true
+			i++
+
+			if i >= len(rs) || unicode.IsSpace(rs[i]) {
+				return clauses, &QueryError{c.Position, "expected a term after '-'"}
+			}
+		}
+
+		// Look ahead for a field name, the name is terminated by a colon.
+		j := i
+		for j < len(rs) && !unicode.IsSpace(rs[j]) && rs[j] != ':' && rs[j] != '"' {
+			j++
+		}
+		if j < len(rs) && rs[j] == ':' && j > i {
+			field := strings.ToLower(string(rs[i:j]))
+			if !isQueryField(field) {
+				return clauses, &QueryError{i + 1, fmt.Sprintf("unknown field '%s'", string(rs[i:j]))}
+			}
+			if strings.HasPrefix(field, "custom.") {
+				// Custom data is indexed using its original keys.
+				field = "custom" + string(rs[i+len("custom"):j])
+			}
+			c.Field = field
+			i = j + 1
+
+			if i >= len(rs) || unicode.IsSpace(rs[i]) {
+				return clauses, &QueryError{i + 1, fmt.Sprintf("expected a value for field '%s'", field)}
+			}
+		}
+
+		if rs[i] == '"' {
+			start := i
+			i++
+			for i < len(rs) && rs[i] != '"' {
+				i++
+			}
+			if i >= len(rs) {
+				return clauses, &QueryError{start + 1, "unterminated phrase"}
+			}
+			c.Value = strings.TrimSpace(string(rs[start+1 : i]))
+			c.IsPhrase = true
+			i++
+
+			if c.Value == "" {
+				return clauses, &QueryError{start + 1, "empty phrase"}
+			}
+			if i < len(rs) && !unicode.IsSpace(rs[i]) {
+				return clauses, &QueryError{i + 1, "expected whitespace after phrase"}
+			}
+		} else {
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) {
+				i++
+			}
+			c.Value = string(rs[start:i])
+		}
+		clauses = append(clauses, c)
+	}
+}
+
+// isQueryField checks whether the lower-cased field can be used in
+// queries.
+func isQueryField(field string) bool {
+	if _, ok := QueryFields[field]; ok {
+		return true
+	}
+	if field == "under" {
+		return true
+	}
+	return strings.HasPrefix(field, "custom.") && len(field) > len("custom.")
+}
+
+// fullQuery parses the query and turns it into a query against the
+// wide index. Free text is combined and searched for in all fields.
+//
+// Referring to an aspect, that doesn't exist, is an error, unless
+// ignoreMissing is true: the same query is run against all versions,
+// and older versions may lack the aspect.
+func (s *Search) fullQuery(q string, ignoreMissing bool) (query.Query, error) {
+	clauses, err := parseQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	bq := bleve.NewBooleanQuery()
+
+	for _, c := range clauses {
+		if c.Field == "" && !c.IsPhrase && !c.IsNegated {
+			words = append(words, c.Value)
+			continue
+		}
+
+		var cq query.Query
+		switch {
+		case c.Field == "under":
+			cq, err = s.underQuery(c, ignoreMissing)
+			if err != nil {
+				return nil, err
+			}
+		case c.Field == "":
+			cq = valueQuery("", c)
+		case strings.HasPrefix(c.Field, "custom."):
+			cq = valueQuery("Custom"+strings.TrimPrefix(c.Field, "custom"), c)
+		default:
+			cq = valueQuery(QueryFields[c.Field], c)
+		}
+
+		if c.IsNegated {
+			bq.AddMustNot(cq)
+		} else {
+			bq.AddMust(cq)
+		}
+	}
+
+	if bq.Must == nil && bq.MustNot == nil {
+		return s.relevance.textQuery(strings.Join(words, " ")), nil
+	}
+	if len(words) > 0 {
+		bq.AddMust(s.relevance.textQuery(strings.Join(words, " ")))
+	}
+	return bq, nil
+}
+
+// valueQuery matches the clause's value in the given field, or in
+// all fields when field is empty. All words of the value must match.
+// Values ending in ".x" or "*" are prefixes, i.e. "version:2.x".
+func valueQuery(field string, c *queryClause) query.Query {
+	if c.IsPhrase {
+		q := bleve.NewMatchPhraseQuery(c.Value)
+		q.SetField(field)
+		return q
+	}
+	if field != "" && (strings.HasSuffix(c.Value, ".x") || strings.HasSuffix(c.Value, "*")) {
+		prefix := c.Value[:len(c.Value)-1]
+
+		q := bleve.NewPrefixQuery(strings.ToLower(prefix))
+		q.SetField(field)
+		return q
+	}
+	q := bleve.NewMatchQuery(c.Value)
+	q.SetField(field)
+	q.SetOperator(query.MatchQueryOperatorAnd)
+	return q
+}
+
+// underQuery matches the node, the clause's value refers to, and all
+// of its descendants. Matches nothing, when the node doesn't exist
+// and ignoreMissing is true.
+func (s *Search) underQuery(c *queryClause, ignoreMissing bool) (query.Query, error) {
+	ok, n, err := s.getNode(c.Value)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if ignoreMissing {
+			return bleve.NewMatchNoneQuery(), nil
+		}
+		return nil, &QueryError{c.Position, fmt.Sprintf("no such aspect '%s'", c.Value)}
+	}
+	prefix := n.URL() + "/"
+
+	var ids []string
+	for _, d := range s.getAllNodes() {
+		if d.URL() == n.URL() || strings.HasPrefix(d.URL(), prefix) {
+			ids = append(ids, d.URL())
+		}
+	}
+	return bleve.NewDocIDQuery(ids), nil
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+func TestParseQuery(t *testing.T) {
+	clauses, err := parseQuery(`date  -tag:deprecated "date picker" Custom.Platform:web author:"Jane Doe"`)
+	if err != nil {
+		t.Fatalf("Failed to parse query: %s", err)
+	}
+	expected := []queryClause{
+		{Position: 1, Value: "date"},
+		{Position: 7, IsNegated: true, Field: "tag", Value: "deprecated"},
+		{Position: 23, Value: "date picker", IsPhrase: true},
+		{Position: 37, Field: "custom.Platform", Value: "web"},
+		{Position: 57, Field: "author", Value: "Jane Doe", IsPhrase: true},
+	}
+	if len(clauses) != len(expected) {
+		t.Fatalf("Expected %d clauses, got %d", len(expected), len(clauses))
+	}
+	for i, c := range clauses {
+		if *c != expected[i] {
+			t.Errorf("Expected clause %+v, got %+v", expected[i], *c)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	expected := map[string]int{
+		`button "date picker`: 8,
+		`button foo:bar`:      8,
+		`tag: button`:         5,
+		`button -`:            8,
+		`"date"picker`:        7,
+		`""`:                  1,
+		`custom.:web`:         1,
+	}
+	for q, e := range expected {
+		_, err := parseQuery(q)
+
+		var qerr *QueryError
+		if !errors.As(err, &qerr) {
+			t.Errorf("Expected query error for: %s", q)
+			continue
+		}
+		if qerr.Position != e {
+			t.Errorf("Expected error at position %d for '%s', got: %s", e, q, qerr)
+		}
+	}
+}
+
+func TestFullSearchFieldFilters(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp, "DataEntry"), tmp)
+	n0.Create()
+	n0.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "Components for entering data into forms.",
+		Tags:        []string{"forms"},
+	})
+	n0.Load()
+
+	n1 := newTestNode(filepath.Join(tmp, "DataEntry", "DatePicker"), tmp)
+	n1.Create()
+	n1.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "Select a date from a calendar.",
+		Authors:     []string{"jane@example.org"},
+		Tags:        []string{"forms", "deprecated"},
+		Version:     "2.1.0",
+		Custom:      map[string]string{"platform": "web"},
+	})
+	n1.Load()
+
+	n2 := newTestNode(filepath.Join(tmp, "Calendar"), tmp)
+	n2.Create()
+	n2.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "Shows a date in a month.",
+		Authors:     []string{"john@example.org"},
+		Version:     "1.0.0",
+		Custom:      map[string]string{"platform": "ios"},
+	})
+	n2.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1, n2}, false)
+	defer teardownSearchTest(tmp, s)
+
+	rs, _, _, _, _ := s.FullSearch("date tag:forms")
+	expectFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectNoFullSearchResult(t, rs, "Calendar")
+
+	rs, _, _, _, _ = s.FullSearch("tag:forms -tag:deprecated")
+	expectFullSearchResult(t, rs, "DataEntry")
+	expectNoFullSearchResult(t, rs, "DataEntry/DatePicker")
+
+	rs, _, _, _, _ = s.FullSearch("author:jane@example.org")
+	expectFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectNoFullSearchResult(t, rs, "Calendar")
+
+	rs, _, _, _, _ = s.FullSearch("version:2.x")
+	expectFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectNoFullSearchResult(t, rs, "Calendar")
+
+	rs, _, _, _, _ = s.FullSearch("custom.platform:ios")
+	expectFullSearchResult(t, rs, "Calendar")
+	expectNoFullSearchResult(t, rs, "DataEntry/DatePicker")
+
+	rs, _, _, _, _ = s.FullSearch("date under:DataEntry")
+	expectFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectNoFullSearchResult(t, rs, "Calendar")
+
+	rs, _, _, _, _ = s.FullSearch(`"select a date"`)
+	expectFullSearchResult(t, rs, "DataEntry/DatePicker")
+	expectNoFullSearchResult(t, rs, "Calendar")
+
+	rs, _, _, _, _ = s.FullSearch("-under:DataEntry")
+	expectFullSearchResult(t, rs, "Calendar")
+	expectNoFullSearchResult(t, rs, "DataEntry")
+	expectNoFullSearchResult(t, rs, "DataEntry/DatePicker")
+}
+
+func TestFullSearchInvalidQuery(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n.Create()
+	n.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n}, false)
+	defer teardownSearchTest(tmp, s)
+
+	var qerr *QueryError
+
+	_, _, _, _, err := s.FullSearch(`color "primary`)
+	if !errors.As(err, &qerr) || qerr.Position != 7 {
+		t.Errorf("Expected query error at position 7, got: %v", err)
+	}
+
+	_, _, _, _, err = s.FullSearch("under:Typography")
+	if !errors.As(err, &qerr) || qerr.Position != 1 {
+		t.Errorf("Expected query error at position 1, got: %v", err)
+	}
+}
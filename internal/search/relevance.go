@@ -0,0 +1,155 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+// Default relevance tuning, see NewRelevance().
+const defaultFuzziness = 1
+const maxFuzziness = 2
+
+// Prefix matches in boosted fields are weighted higher than full
+// matches, as they are more likely what is being looked for, while
+// typing.
+const prefixBoostFactor = 1.5
+
+// Hits of boosted nodes may be ranked higher than the page they were
+// found on, at least this many hits are re-ranked.
+const boostWindow = 200
+
+var (
+	// AvailablePrefixModes selects where words of a query also match
+	// words starting with them: in all fields, only in boosted ones
+	// or nowhere.
+	AvailablePrefixModes = []string{"all", "boosted", "none"}
+
+	defaultBoosts = map[string]float64{
+		"Title": 2,
+	}
+)
+
+// NewRelevance returns the relevance tuning, as configured in the
+// search configuration, which may be nil. Invalid settings are
+// ignored and the defaults used instead.
+func NewRelevance(c *config.SearchConfig) *Relevance {
+	r := &Relevance{
+		Boosts:    make(map[string]float64, len(defaultBoosts)),
+		Fuzziness: defaultFuzziness,
+		Prefix:    AvailablePrefixModes[0],
+	}
+	for f, b := range defaultBoosts {
+		r.Boosts[f] = b
+	}
+	if c == nil {
+		return r
+	}
+
+	for f, b := range c.Boosts {
+		field, ok := searchField(f)
+		if !ok {
+			log.Printf("Ignoring search boost for unknown field: %s", f)
+			continue
+		}
+		if b <= 0 {
+			log.Printf("Ignoring search boost for field %s, must be positive: %g", field, b)
+			continue
+		}
+		r.Boosts[field] = b
+	}
+	if c.Fuzziness != nil {
+		if *c.Fuzziness >= 0 && *c.Fuzziness <= maxFuzziness {
+			r.Fuzziness = *c.Fuzziness
+		} else {
+			log.Printf("Ignoring search fuzziness, must be between 0 and %d: %d", maxFuzziness, *c.Fuzziness)
+		}
+	}
+	if c.Prefix != "" {
+		if isPrefixMode(c.Prefix) {
+			r.Prefix = c.Prefix
+		} else {
+			log.Printf("Ignoring unknown search prefix mode: %s", c.Prefix)
+		}
+	}
+	return r
+}
+
+// Relevance controls how free text is matched and how hits are
+// ranked.
+type Relevance struct {
+	// Boosts maps names of fields to the weight of matches in them.
+	Boosts map[string]float64
+
+	// Fuzziness is the number of edits, a word may differ by.
+	Fuzziness int
+
+	// Prefix is one of AvailablePrefixModes.
+	Prefix string
+}
+
+func isPrefixMode(mode string) bool {
+	for _, m := range AvailablePrefixModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// textQuery searches for free text in all fields, matching words
+// fuzzily and by prefix, favoring matches in boosted fields.
+func (r *Relevance) textQuery(text string) query.Query {
+	// Prefix query is case sensitive, we want to have it case insensitive.
+	lower := strings.ToLower(text)
+
+	mq := bleve.NewMatchQuery(text)
+	mq.SetFuzziness(r.Fuzziness)
+
+	qs := []query.Query{mq}
+	if r.Prefix == "all" {
+		qs = append(qs, bleve.NewPrefixQuery(lower))
+	}
+
+	// Sorted for deterministic queries.
+	fields := make([]string, 0, len(r.Boosts))
+	for f := range r.Boosts {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	for _, f := range fields {
+		fmq := bleve.NewMatchQuery(text)
+		fmq.SetField(f)
+		fmq.SetBoost(r.Boosts[f])
+		qs = append(qs, fmq)
+
+		if r.Prefix != "none" {
+			fpq := bleve.NewPrefixQuery(lower)
+			fpq.SetField(f)
+			fpq.SetBoost(r.Boosts[f] * prefixBoostFactor)
+			qs = append(qs, fpq)
+		}
+	}
+	return bleve.NewDisjunctionQuery(qs...)
+}
+
+// isBoosted checks whether any of the nodes has a search boost.
+func isBoosted(nodes []*ddt.Node) bool {
+	for _, n := range nodes {
+		if n.SearchBoost() != 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+func TestNewRelevance(t *testing.T) {
+	r := NewRelevance(nil)
+	if !reflect.DeepEqual(r.Boosts, map[string]float64{"Title": 2}) || r.Fuzziness != 1 || r.Prefix != "all" {
+		t.Errorf("Expected default relevance, got: %+v", r)
+	}
+
+	fuzziness := 0
+	r = NewRelevance(&config.SearchConfig{
+		Boosts: map[string]float64{
+			"tags":    1.5,
+			"Unknown": 3,
+			"Docs":    -1,
+		},
+		Fuzziness: &fuzziness,
+		Prefix:    "boosted",
+	})
+	expected := map[string]float64{"Title": 2, "Tags": 1.5}
+	if !reflect.DeepEqual(r.Boosts, expected) {
+		t.Errorf("Expected boosts %v, got: %v", expected, r.Boosts)
+	}
+	if r.Fuzziness != 0 {
+		t.Errorf("Expected fuzziness to be disabled, got: %d", r.Fuzziness)
+	}
+	if r.Prefix != "boosted" {
+		t.Errorf("Expected prefix mode 'boosted', got: %s", r.Prefix)
+	}
+
+	fuzziness = 3
+	r = NewRelevance(&config.SearchConfig{Fuzziness: &fuzziness, Prefix: "some"})
+	if r.Fuzziness != 1 || r.Prefix != "all" {
+		t.Errorf("Expected invalid settings to be ignored, got: %+v", r)
+	}
+}
+
+func TestParseSynonyms(t *testing.T) {
+	synonyms := parseSynonyms([]string{
+		"Dropdown = select=picker",
+		"date picker = calendar",
+		"modal",
+		"toast = ",
+	})
+	expected := [][]string{{"dropdown", "select", "picker"}}
+
+	if !reflect.DeepEqual(synonyms, expected) {
+		t.Errorf("Expected synonyms %v, got: %v", expected, synonyms)
+	}
+}
+
+func TestFullSearchSynonyms(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp, "Select"), tmp)
+	n0.Create()
+	n0.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "Choose one of many options.",
+	})
+	n0.Load()
+
+	n1 := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n1.Create()
+	n1.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "Use a dropdown to choose the color scheme.",
+	})
+	n1.Load()
+
+	n2 := newTestNode(filepath.Join(tmp, "Typography"), tmp)
+	n2.Create()
+	n2.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1, n2}, false)
+	defer teardownSearchTest(tmp, s)
+
+	s.analyzers = NewAnalyzers("en", &config.SearchConfig{
+		Synonyms: []string{"dropdown = select = picker"},
+	})
+	s.wideIndex.Close()
+	s.narrowIndex.Close()
+	s.wideIndex, s.narrowIndex, _ = NewIndexes("", s.analyzers, s.facets, false)
+	s.indexed = nil
+
+	if err := s.IndexTree(nil); err != nil {
+		t.Fatalf("Failed to index tree: %s", err)
+	}
+
+	rs, _, _, _, _ := s.FullSearch("dropdown")
+	expectFullSearchResult(t, rs, "Select")
+	expectFullSearchResult(t, rs, "Colors")
+	expectNoFullSearchResult(t, rs, "Typography")
+
+	rs, _, _, _, _ = s.FullSearch("picker")
+	expectFullSearchResult(t, rs, "Select")
+	expectFullSearchResult(t, rs, "Colors")
+}
+
+func TestFullSearchNodeBoostAndExclude(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	var nodes []*ddt.Node
+	for name, meta := range map[string]*ddt.NodeSearchMeta{
+		"Alpha": nil,
+		"Beta":  {Boost: 3},
+		"Gamma": {Exclude: true},
+	} {
+		n := newTestNode(filepath.Join(tmp, name), tmp)
+		n.Create()
+		n.CreateMeta("meta.yaml", &ddt.NodeMeta{
+			Description: "A button to submit forms.",
+			Tags:        []string{"button"},
+			Search:      meta,
+		})
+		n.Load()
+		nodes = append(nodes, n)
+	}
+
+	s := setupSearchTest(t, tmp, "en", nodes, false)
+	defer teardownSearchTest(tmp, s)
+
+	rs, total, _, _, err := s.FullSearch("submit")
+	if err != nil {
+		t.Fatalf("Failed to search: %s", err)
+	}
+	if total != 2 || len(rs) != 2 {
+		t.Fatalf("Expected 2 hits, got: %d", total)
+	}
+	if rs[0].Node.URL() != "Beta" {
+		t.Errorf("Expected boosted node first, got: %s", rs[0].Node.URL())
+	}
+	expectNoFullSearchResult(t, rs, "Gamma")
+
+	rs, _, _, _, _, _ = s.FacetedFullSearch("submit", nil, 1, 1)
+	if len(rs) != 1 || rs[0].Node.URL() != "Alpha" {
+		t.Errorf("Expected second page to hold the unboosted node")
+	}
+
+	ns, _, _, _, _ := s.FilterSearch("button", 0, 0)
+	for _, n := range ns {
+		if n.URL() == "Gamma" {
+			t.Errorf("Expected excluded node not to be found by filter")
+		}
+	}
+}
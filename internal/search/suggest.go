@@ -0,0 +1,291 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/standard"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search"
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+// The maximum number of completions and corrections returned.
+const completionSize = 10
+const correctionSize = 3
+
+// Words shorter than this are not corrected, too many words are
+// similar to them.
+const minCorrectionLength = 3
+
+// suggestField is the field of the wide index holding the words of
+// titles, tags and doc headings, suggestions are made from.
+const suggestField = "Suggest"
+
+// Suggestions for a query, that is still being typed.
+type Suggestions struct {
+	// Queries, where the last word has been completed. Ordered by
+	// the number of nodes the completed word occurs in.
+	Completions []string
+
+	// Queries, where unknown words have been replaced by similar
+	// known ones, i.e. "buton" by "button".
+	Corrections []string
+}
+
+// suggestWordsRegexp matches the words of a query, anything else
+// separates them.
+var suggestWordsRegexp = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// suggestTerm is a word of the suggest field and the number of nodes
+// it occurs in.
+type suggestTerm struct {
+	Term  string
+	Count uint64
+}
+
+// newSuggestMapping creates the mapping for the suggest field. Words
+// are not stemmed, so they can be shown to the user as is.
+func newSuggestMapping() *mapping.FieldMapping {
+	fm := bleve.NewTextFieldMapping()
+	fm.Analyzer = standard.Name
+	fm.IncludeInAll = false
+	fm.Store = false
+	return fm
+}
+
+// suggestValues returns the node's words suggestions are made from:
+// its title, tags and the headings of its docs.
+func suggestValues(n *ddt.Node, docs []*ddt.NodeDoc, nodeGet ddt.NodeGetter) ([]string, error) {
+	values := []string{n.Title()}
+	values = append(values, n.Tags()...)
+
+	var walk func([]*ddt.TocEntry)
+	walk = func(entries []*ddt.TocEntry) {
+		for _, e := range entries {
+			values = append(values, e.Title)
+			walk(e.Children)
+		}
+	}
+	for _, doc := range docs {
+		toc, err := doc.Toc(n.URL(), nodeGet, "")
+		if err != nil {
+			return values, err
+		}
+		walk(toc)
+	}
+	return values, nil
+}
+
+// suggestTerms reads the dictionary of the suggest field from the
+// index. Terms are sorted.
+func suggestTerms(i bleve.Index) ([]*suggestTerm, error) {
+	terms := make([]*suggestTerm, 0)
+
+	d, err := i.FieldDict(suggestField)
+	if err != nil {
+		return terms, err
+	}
+	defer d.Close()
+
+	for {
+		e, err := d.Next()
+		if err != nil {
+			return terms, err
+		}
+		if e == nil {
+			break
+		}
+		terms = append(terms, &suggestTerm{e.Term, e.Count})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Term < terms[j].Term
+	})
+	return terms, nil
+}
+
+// Suggest completes the last word of the query and corrects
+// misspelled words. Suggestions are made from an in-memory snapshot
+// of the index's dictionary, which is swapped atomically once the tree
+// has been indexed, so suggesting never waits for indexing.
+func (s *Search) Suggest(q string) (*Suggestions, time.Duration, error) {
+	start := time.Now()
+
+	// Empty until the tree has been indexed for the first time.
+	terms, _ := s.terms.Load().([]*suggestTerm)
+
+	suggestions := &Suggestions{
+		Completions: make([]string, 0),
+		Corrections: make([]string, 0),
+	}
+
+	a := s.wideIndex.Mapping().AnalyzerNamed(standard.Name)
+	if a == nil {
+		return suggestions, time.Since(start), fmt.Errorf("no analyzer %s", standard.Name)
+	}
+	// Positions of the words allow to replace them in the query, while
+	// keeping everything else, i.e. field names, as is.
+	words := suggestWordsRegexp.FindAllStringIndex(q, -1)
+	if len(words) == 0 {
+		return suggestions, time.Since(start), nil
+	}
+
+	// The last word is still being typed, unless followed by anything.
+	last := -1
+	if words[len(words)-1][1] == len(q) {
+		last = len(words) - 1
+	}
+
+	if last >= 0 {
+		w := words[last]
+
+		for _, t := range completeTerm(terms, strings.ToLower(q[w[0]:w[1]])) {
+			suggestions.Completions = append(suggestions.Completions, q[:w[0]]+t)
+		}
+	}
+
+	corrections := make(map[int][]string)
+	for i, w := range words {
+		term := strings.ToLower(q[w[0]:w[1]])
+
+		if isTerm(terms, term) {
+			continue
+		}
+		if i == last && len(suggestions.Completions) > 0 {
+			continue
+		}
+		// Stop words are not indexed, but aren't misspelled either.
+		if len(a.Analyze([]byte(term))) == 0 {
+			continue
+		}
+		if cs := correctTerm(terms, term); len(cs) > 0 {
+			corrections[i] = cs
+		}
+	}
+	if len(corrections) == 0 {
+		return suggestions, time.Since(start), nil
+	}
+
+	// The n-th correction uses the n-th most similar word for each
+	// misspelled word, when there are fewer, the most similar one.
+	seen := make(map[string]bool)
+	for n := 0; n < correctionSize; n++ {
+		var b strings.Builder
+		pos := 0
+
+		for i, w := range words {
+			cs, ok := corrections[i]
+			if !ok {
+				continue
+			}
+			c := cs[0]
+			if n < len(cs) {
+				c = cs[n]
+			}
+			b.WriteString(q[pos:w[0]])
+			b.WriteString(c)
+			pos = w[1]
+		}
+		b.WriteString(q[pos:])
+
+		if c := b.String(); !seen[c] {
+			suggestions.Corrections = append(suggestions.Corrections, c)
+			seen[c] = true
+		}
+	}
+	return suggestions, time.Since(start), nil
+}
+
+// isTerm checks whether the term is in the sorted terms.
+func isTerm(terms []*suggestTerm, term string) bool {
+	i := sort.Search(len(terms), func(i int) bool {
+		return terms[i].Term >= term
+	})
+	return i < len(terms) && terms[i].Term == term
+}
+
+// completeTerm returns the most frequent terms starting with prefix,
+// the prefix itself is not a completion.
+func completeTerm(terms []*suggestTerm, prefix string) []string {
+	i := sort.Search(len(terms), func(i int) bool {
+		return terms[i].Term >= prefix
+	})
+
+	var matches []*suggestTerm
+	for ; i < len(terms) && strings.HasPrefix(terms[i].Term, prefix); i++ {
+		if terms[i].Term != prefix {
+			matches = append(matches, terms[i])
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Count > matches[j].Count
+	})
+
+	completions := make([]string, 0, completionSize)
+	for _, m := range matches {
+		if len(completions) == completionSize {
+			break
+		}
+		completions = append(completions, m.Term)
+	}
+	return completions
+}
+
+// correctTerm returns the terms most similar to the given one, these
+// are at most 1 edit away for short terms and 2 edits for longer
+// ones. Ordered by distance and then by frequency.
+func correctTerm(terms []*suggestTerm, term string) []string {
+	l := utf8.RuneCountInString(term)
+	if l < minCorrectionLength {
+		return nil
+	}
+	max := 1
+	if l > 4 {
+		max = 2
+	}
+
+	type candidate struct {
+		*suggestTerm
+		distance int
+	}
+	var candidates []*candidate
+
+	for _, t := range terms {
+		// Terms differing in length by more than max are further
+		// away than max, skip these cheaply.
+		d := utf8.RuneCountInString(t.Term) - l
+		if d > max || d < -max {
+			continue
+		}
+		distance, exceeded := search.LevenshteinDistanceMax(term, t.Term, max)
+		if exceeded || distance > max {
+			continue
+		}
+		candidates = append(candidates, &candidate{t, distance})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].Count > candidates[j].Count
+	})
+
+	corrections := make([]string, 0, correctionSize)
+	for _, c := range candidates {
+		if len(corrections) == correctionSize {
+			break
+		}
+		corrections = append(corrections, c.Term)
+	}
+	return corrections
+}
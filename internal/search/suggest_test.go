@@ -0,0 +1,114 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+func TestSuggest(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp, "Button"), tmp)
+	n0.Create()
+	n0.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Tags: []string{"buttons"},
+	})
+	n0.CreateDoc("readme.md", []byte("# Usage\n\nPress it.\n\n## Button Groups\n\nSide by side."))
+	n0.Load()
+
+	n1 := newTestNode(filepath.Join(tmp, "ButtonGroup"), tmp)
+	n1.Create()
+	n1.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Tags: []string{"button", "layout"},
+	})
+	n1.Load()
+
+	n2 := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n2.Create()
+	n2.CreateMeta("meta.yaml", &ddt.NodeMeta{
+		Description: "Unique words of descriptions are not suggested.",
+	})
+	n2.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0, n1, n2}, false)
+	defer teardownSearchTest(tmp, s)
+
+	expected := map[string]*Suggestions{
+		"but": {
+			Completions: []string{"button", "buttongroup", "buttons"},
+			Corrections: []string{},
+		},
+		"tag:lay": {
+			Completions: []string{"tag:layout"},
+			Corrections: []string{},
+		},
+		"buton": {
+			Completions: []string{},
+			Corrections: []string{"button", "buttons"},
+		},
+		"buton colrs ": {
+			Completions: []string{},
+			Corrections: []string{"button colors ", "buttons colors "},
+		},
+		"usage": {
+			Completions: []string{},
+			Corrections: []string{},
+		},
+		"unique": {
+			Completions: []string{},
+			Corrections: []string{},
+		},
+		"": {
+			Completions: []string{},
+			Corrections: []string{},
+		},
+	}
+	for q, e := range expected {
+		suggestions, _, err := s.Suggest(q)
+		if err != nil {
+			t.Fatalf("Failed to suggest for '%s': %s", q, err)
+		}
+		if !reflect.DeepEqual(suggestions, e) {
+			t.Errorf("Expected suggestions %+v for '%s', got: %+v", e, q, suggestions)
+		}
+	}
+}
+
+func TestSuggestWhileIndexing(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+
+	n0 := newTestNode(filepath.Join(tmp, "Button"), tmp)
+	n0.Create()
+	n0.Load()
+
+	s := setupSearchTest(t, tmp, "en", []*ddt.Node{n0}, false)
+	defer teardownSearchTest(tmp, s)
+
+	// Held by IndexTree() while swapping in the new state.
+	s.Lock()
+	defer s.Unlock()
+
+	done := make(chan *Suggestions)
+	go func() {
+		suggestions, _, _ := s.Suggest("butt")
+		done <- suggestions
+	}()
+	select {
+	case suggestions := <-done:
+		if !reflect.DeepEqual(suggestions.Completions, []string{"button"}) {
+			t.Errorf("Expected completion from snapshot, got: %v", suggestions.Completions)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected suggesting not to wait for indexing")
+	}
+}
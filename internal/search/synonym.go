@@ -0,0 +1,154 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package search
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+)
+
+// Name of the synonyms token filter type and of the analyzer, that
+// is used instead of the standard analyzer, once synonyms have been
+// configured.
+const synonymsName = "dsk_synonyms"
+
+func init() {
+	registry.RegisterTokenFilter(synonymsName, synonymsFilterConstructor)
+}
+
+// parseSynonyms parses groups of synonyms, words of a group are
+// separated by "=", i.e. "dropdown = select = picker".
+func parseSynonyms(groups []string) [][]string {
+	synonyms := make([][]string, 0, len(groups))
+
+Outer:
+	for _, g := range groups {
+		var words []string
+
+		for _, w := range strings.Split(g, "=") {
+			w = strings.ToLower(strings.TrimSpace(w))
+
+			if w == "" || strings.ContainsAny(w, " \t\r\n") {
+				log.Printf("Ignoring synonyms, expected single words separated by '=': %s", g)
+				continue Outer
+			}
+			words = append(words, w)
+		}
+		if len(words) < 2 {
+			log.Printf("Ignoring synonyms, expected at least 2 words: %s", g)
+			continue
+		}
+		synonyms = append(synonyms, words)
+	}
+	return synonyms
+}
+
+// addSynonymsAnalyzer adds the synonyms analyzer to the mapping. It
+// analyzes like the standard analyzer, but adds the synonyms of each
+// word at the same position.
+func addSynonymsAnalyzer(im *mapping.IndexMappingImpl, synonyms [][]string) error {
+	err := im.AddCustomTokenFilter(synonymsName, map[string]interface{}{
+		"type":   synonymsName,
+		"groups": synonyms,
+	})
+	if err != nil {
+		return err
+	}
+	return im.AddCustomAnalyzer(synonymsName, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name, en.StopName, synonymsName},
+	})
+}
+
+// synonymsFilter adds the synonyms of each token to the token stream.
+type synonymsFilter struct {
+	// Maps words to their synonyms.
+	synonyms map[string][]string
+}
+
+func newSynonymsFilter(groups [][]string) *synonymsFilter {
+	f := &synonymsFilter{synonyms: make(map[string][]string)}
+
+	for _, g := range groups {
+		for _, w := range g {
+			for _, s := range g {
+				if s != w && !isSynonym(f.synonyms[w], s) {
+					f.synonyms[w] = append(f.synonyms[w], s)
+				}
+			}
+		}
+	}
+	return f
+}
+
+func isSynonym(synonyms []string, word string) bool {
+	for _, s := range synonyms {
+		if s == word {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *synonymsFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	output := make(analysis.TokenStream, 0, len(input))
+
+	for _, token := range input {
+		output = append(output, token)
+
+		for _, s := range f.synonyms[string(token.Term)] {
+			output = append(output, &analysis.Token{
+				Term:     []byte(s),
+				Start:    token.Start,
+				End:      token.End,
+				Position: token.Position,
+				Type:     token.Type,
+				KeyWord:  token.KeyWord,
+			})
+		}
+	}
+	return output
+}
+
+// synonymsFilterConstructor creates the filter from its
+// configuration, which may have been read from a persisted mapping.
+func synonymsFilterConstructor(config map[string]interface{}, cache *registry.Cache) (analysis.TokenFilter, error) {
+	var groups [][]string
+
+	switch v := config["groups"].(type) {
+	case [][]string:
+		groups = v
+	case []interface{}:
+		for _, g := range v {
+			words, ok := g.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("synonyms must be a list of words: %v", g)
+			}
+			var group []string
+			for _, w := range words {
+				s, ok := w.(string)
+				if !ok {
+					return nil, fmt.Errorf("synonym must be a string: %v", w)
+				}
+				group = append(group, s)
+			}
+			groups = append(groups, group)
+		}
+	default:
+		return nil, fmt.Errorf("must specify groups of synonyms")
+	}
+	return newSynonymsFilter(groups), nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tokens
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+// NewDB constructs and initializes a DB, by discovering all tokens
+// in the tree.
+func NewDB(t *ddt.Tree) (*DB, error) {
+	log.Print("Initializing design tokens database...")
+
+	db := &DB{
+		getAllNodes: t.GetAll,
+		data:        make([]*Token, 0),
+		byNode:      make(map[string][]*Token),
+		lookup:      make(map[string]*Token),
+	}
+	return db, db.Refresh()
+}
+
+// DB holds all design tokens found in the tree. References inside
+// token values are resolved tree-wide: a token may alias tokens
+// defined in other nodes. References are first looked up in the same
+// node, before they are looked up in the whole tree. It is fully
+// synchronized.
+type DB struct {
+	sync.RWMutex
+
+	getAllNodes ddt.NodesGetter
+
+	// All tokens, sorted by node URL and name.
+	data []*Token
+
+	// Maps node URLs to tokens defined in that node.
+	byNode map[string][]*Token
+
+	// Maps token names to tokens, for quick lookup.
+	lookup map[string]*Token
+}
+
+// Refresh re-discovers all tokens in the tree.
+func (db *DB) Refresh() error {
+	start := time.Now()
+
+	nodes := db.getAllNodes()
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].URL() < nodes[j].URL()
+	})
+
+	data := make([]*Token, 0)
+	byNode := make(map[string][]*Token)
+	byNodeIndex := make(map[string]map[string]*Token)
+
+	for _, n := range nodes {
+		ts, err := parseNode(n)
+		if err != nil {
+			// A single unreadable node should not prevent us from
+			// providing all the other tokens.
+			log.Printf("Skipping tokens in %s: %s", n.URL(), err)
+			continue
+		}
+		if len(ts) == 0 {
+			continue
+		}
+		data = append(data, ts...)
+		byNode[n.URL()] = ts
+		byNodeIndex[n.URL()] = indexByName(ts)
+	}
+	global := indexByName(data)
+
+	resolve(data, func(from *Token, name string) (bool, *Token) {
+		if t, ok := byNodeIndex[from.Node.URL()][name]; ok {
+			return true, t
+		}
+		t, ok := global[name]
+		return ok, t
+	})
+
+	db.Lock()
+	db.data = data
+	db.byNode = byNode
+	db.lookup = global
+	db.Unlock()
+
+	log.Printf("Discovered %d design token/s in %s", len(data), time.Since(start))
+	return nil
+}
+
+// All returns all tokens of the tree.
+func (db *DB) All() []*Token {
+	db.RLock()
+	defer db.RUnlock()
+	return db.data
+}
+
+// ForNode returns the tokens defined in the node with the given URL.
+func (db *DB) ForNode(url string) []*Token {
+	db.RLock()
+	defer db.RUnlock()
+
+	if ts, ok := db.byNode[url]; ok {
+		return ts
+	}
+	return make([]*Token, 0)
+}
+
+// Get retrieves a token by its name. When multiple nodes define a
+// token with the same name, the one in the node with the lowest URL
+// is returned.
+func (db *DB) Get(name string) (bool, *Token) {
+	db.RLock()
+	defer db.RUnlock()
+
+	t, ok := db.lookup[name]
+	return ok, t
+}
+
+func (db *DB) Close() error {
+	return nil
+}
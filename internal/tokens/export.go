@@ -0,0 +1,486 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tokens
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rundsk/dsk/internal/config"
+)
+
+var (
+	// ExportFormats are all formats tokens can be exported to.
+	ExportFormats = []*ExportFormat{
+		{"css", ".css", "text/css; charset=utf-8", &config.TokensFormatConfig{Name: "kebab", Unit: "px"}, nil, exportCSS},
+		{"scss", ".scss", "text/x-scss; charset=utf-8", &config.TokensFormatConfig{Name: "kebab", Unit: "px"}, nil, exportSCSS},
+		{"js", ".js", "application/javascript; charset=utf-8", &config.TokensFormatConfig{Name: "camel", Unit: "px"}, jsReserved, exportJS},
+		{"ts", ".ts", "application/typescript; charset=utf-8", &config.TokensFormatConfig{Name: "camel", Unit: "px"}, jsReserved, exportTS},
+		{"android", ".xml", "application/xml; charset=utf-8", &config.TokensFormatConfig{Name: "snake", Unit: "dp"}, javaReserved, exportAndroid},
+		{"swift", ".swift", "text/x-swift; charset=utf-8", &config.TokensFormatConfig{Name: "camel", Unit: "px"}, swiftReserved, exportSwift},
+	}
+
+	// Reserved words cannot be used as identifiers, exported names
+	// matching one are prefixed, see ExportFormat.identifier(). Android
+	// resources are accessed as Java fields.
+	jsReserved = reservedWords(`
+		arguments await break case catch class const continue debugger
+		default delete do else enum eval export extends false finally for
+		function if implements import in instanceof interface let new null
+		package private protected public return static super switch this
+		throw true try typeof undefined var void while with yield
+	`)
+	javaReserved = reservedWords(`
+		abstract assert boolean break byte case catch char class const
+		continue default do double else enum extends false final finally
+		float for goto if implements import instanceof int interface long
+		native new null package private protected public return short
+		static strictfp super switch synchronized this throw throws
+		transient true try void volatile while
+	`)
+	swiftReserved = reservedWords(`
+		Any Self as associatedtype break case catch class continue default
+		defer deinit do else enum extension fallthrough false fileprivate
+		for func guard if import in init inout internal is let nil open
+		operator private protocol public repeat rethrows return self
+		static struct subscript super switch throw throws true try
+		typealias var where while
+	`)
+
+	pxValueRegexp  = regexp.MustCompile(`^(-?[0-9.]+)px$`)
+	hexColorRegexp = regexp.MustCompile(`(?i)^#([0-9a-f]{3,4}|[0-9a-f]{6}|[0-9a-f]{8})$`)
+)
+
+// ExportFormat describes a platform specific format, tokens can be
+// exported to.
+type ExportFormat struct {
+	// Name of the format, also used as the key for configuring it.
+	Name string
+
+	// Ext is the file extension, including the leading ".".
+	Ext string
+
+	ContentType string
+
+	// Defaults are used when the format isn't configured or only
+	// partially configured.
+	Defaults *config.TokensFormatConfig
+
+	// Words, that cannot be used as names.
+	reserved map[string]bool
+
+	fn exportFunc
+}
+
+// exportedToken is a token prepared for export, its name and value
+// are transformed according to the format's configuration.
+type exportedToken struct {
+	*Token
+	Name  string
+	Value interface{}
+}
+
+type exportFunc func(w io.Writer, ts []*exportedToken, header string) error
+
+// ExportFormatByName looks up a format by its name.
+func ExportFormatByName(name string) (bool, *ExportFormat) {
+	for _, f := range ExportFormats {
+		if f.Name == name {
+			return true, f
+		}
+	}
+	return false, nil
+}
+
+// ExportFormatByExt looks up a format by its file extension.
+func ExportFormatByExt(ext string) (bool, *ExportFormat) {
+	for _, f := range ExportFormats {
+		if f.Ext == ext {
+			return true, f
+		}
+	}
+	return false, nil
+}
+
+// Export writes the given tokens to w. The source name is included
+// in the generated header, so the origin of the output is traceable.
+// Tokens that failed to resolve are skipped.
+//
+// Tokens of different nodes may share a name, and different names may
+// be transformed into the same one. Such names are qualified by the
+// URL of the token's node. Fails, if names still collide.
+func (f *ExportFormat) Export(w io.Writer, ts []*Token, c *config.TokensConfig, source string) error {
+	fc := f.config(c)
+
+	remBase := 16.0
+	if c != nil && c.RemBase > 0 {
+		remBase = c.RemBase
+	}
+
+	ets := make([]*exportedToken, 0, len(ts))
+	for _, t := range ts {
+		if t.Error != nil {
+			continue
+		}
+		ets = append(ets, &exportedToken{
+			Token: t,
+			Name:  f.identifier(fc.Prefix+"."+t.Name, fc.Name),
+			Value: convertUnit(t.Value, fc.Unit, remBase),
+		})
+	}
+
+	byName := make(map[string][]*exportedToken, len(ets))
+	for _, et := range ets {
+		byName[et.Name] = append(byName[et.Name], et)
+	}
+	for _, colliding := range byName {
+		if len(colliding) < 2 {
+			continue
+		}
+		for _, et := range colliding {
+			et.Name = f.identifier(fc.Prefix+"."+nodeURL(et.Token)+"."+et.Token.Name, fc.Name)
+		}
+	}
+	seen := make(map[string]*exportedToken, len(ets))
+	for _, et := range ets {
+		if other, ok := seen[et.Name]; ok {
+			return fmt.Errorf(
+				"tokens %s in '%s' and %s in '%s' are both exported as %s",
+				other.Token.Name, nodeURL(other.Token), et.Token.Name, nodeURL(et.Token), et.Name,
+			)
+		}
+		seen[et.Name] = et
+	}
+	header := fmt.Sprintf("Generated by DSK from version %s, do not edit.", source)
+	return f.fn(w, ets, header)
+}
+
+// config merges the user provided configuration with the format's
+// defaults.
+func (f *ExportFormat) config(c *config.TokensConfig) *config.TokensFormatConfig {
+	fc := *f.Defaults
+
+	if c == nil || c.Formats == nil {
+		return &fc
+	}
+	uc, ok := c.Formats[f.Name]
+	if !ok || uc == nil {
+		return &fc
+	}
+	if uc.Name != "" {
+		fc.Name = uc.Name
+	}
+	if uc.Unit != "" {
+		fc.Unit = uc.Unit
+	}
+	fc.Prefix = uc.Prefix
+	return &fc
+}
+
+// identifier transforms the name according to the given style, see
+// transformName(). Reserved words are prefixed with an underscore.
+func (f *ExportFormat) identifier(name string, style string) string {
+	id := transformName(name, style)
+	if f.reserved[id] {
+		return "_" + id
+	}
+	return id
+}
+
+// nodeURL returns the URL of the node, the token was defined in.
+func nodeURL(t *Token) string {
+	if t.Node == nil {
+		return ""
+	}
+	return t.Node.URL()
+}
+
+func reservedWords(words string) map[string]bool {
+	reserved := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		reserved[w] = true
+	}
+	return reserved
+}
+
+// transformName splits the given name into words, on any non-alpha
+// numeric characters and on camel case boundaries, then joins the
+// words according to given style.
+func transformName(name string, style string) string {
+	words := make([]string, 0)
+
+	var current strings.Builder
+	var prev rune
+
+	flush := func() {
+		if current.Len() > 0 {
+			words = append(words, strings.ToLower(current.String()))
+			current.Reset()
+		}
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			prev = r
+			continue
+		}
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			flush()
+		}
+		current.WriteRune(r)
+		prev = r
+	}
+	flush()
+
+	switch style {
+	case "camel":
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		name = strings.Join(words, "")
+	case "snake":
+		name = strings.Join(words, "_")
+	default:
+		name = strings.Join(words, "-")
+	}
+
+	// Identifiers must not start with a digit in most languages.
+	if name != "" && unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// convertUnit converts pixel dimensions into the given unit.
+func convertUnit(v interface{}, unit string, remBase float64) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	m := pxValueRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return v
+	}
+	px, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return v
+	}
+
+	switch unit {
+	case "rem":
+		return strconv.FormatFloat(px/remBase, 'f', -1, 64) + "rem"
+	case "dp":
+		return strconv.FormatFloat(px, 'f', -1, 64) + "dp"
+	default:
+		return v
+	}
+}
+
+// scalar returns the value as a string and whether the value is a
+// scalar at all. Composite values cannot be represented as a
+// variable in most formats.
+func scalar(v interface{}) (string, bool) {
+	switch tv := v.(type) {
+	case string:
+		return tv, true
+	case float64:
+		return strconv.FormatFloat(tv, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(tv), true
+	default:
+		return "", false
+	}
+}
+
+func exportCSS(w io.Writer, ts []*exportedToken, header string) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "/* %s */\n\n:root {\n", header)
+	for _, t := range ts {
+		v, ok := scalar(t.Value)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&buf, "  --%s: %s;\n", t.Name, v)
+	}
+	buf.WriteString("}\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func exportSCSS(w io.Writer, ts []*exportedToken, header string) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// %s\n\n", header)
+	for _, t := range ts {
+		v, ok := scalar(t.Value)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&buf, "$%s: %s;\n", t.Name, v)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func exportJS(w io.Writer, ts []*exportedToken, header string) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// %s\n\n", header)
+	for _, t := range ts {
+		v, err := json.Marshal(t.Value)
+		if err != nil {
+			return err
+		}
+		if t.Description != "" {
+			fmt.Fprintf(&buf, "/** %s */\n", strings.Replace(t.Description, "*/", "* /", -1))
+		}
+		fmt.Fprintf(&buf, "export const %s = %s;\n", t.Name, v)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func exportTS(w io.Writer, ts []*exportedToken, header string) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// %s\n\n", header)
+	for _, t := range ts {
+		v, err := json.Marshal(t.Value)
+		if err != nil {
+			return err
+		}
+		if t.Description != "" {
+			fmt.Fprintf(&buf, "/** %s */\n", strings.Replace(t.Description, "*/", "* /", -1))
+		}
+		fmt.Fprintf(&buf, "export const %s = %s as const;\n", t.Name, v)
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func exportAndroid(w io.Writer, ts []*exportedToken, header string) error {
+	var buf bytes.Buffer
+
+	buf.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	fmt.Fprintf(&buf, "<!-- %s -->\n<resources>\n", header)
+
+	for _, t := range ts {
+		v, ok := scalar(t.Value)
+		if !ok {
+			continue
+		}
+		name := html.EscapeString(t.Name)
+
+		switch {
+		case hexColorRegexp.MatchString(v):
+			fmt.Fprintf(&buf, "  <color name=\"%s\">%s</color>\n", name, androidColor(v))
+		case strings.HasSuffix(v, "dp") || strings.HasSuffix(v, "sp"):
+			fmt.Fprintf(&buf, "  <dimen name=\"%s\">%s</dimen>\n", name, v)
+		default:
+			if f, ok := t.Value.(float64); ok {
+				if f == float64(int64(f)) {
+					fmt.Fprintf(&buf, "  <integer name=\"%s\">%s</integer>\n", name, v)
+				} else {
+					fmt.Fprintf(&buf, "  <item name=\"%s\" format=\"float\" type=\"dimen\">%s</item>\n", name, v)
+				}
+				continue
+			}
+			fmt.Fprintf(&buf, "  <string name=\"%s\">%s</string>\n", name, html.EscapeString(v))
+		}
+	}
+	buf.WriteString("</resources>\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// androidColor converts CSS hex colors into the format expected by
+// Android, which places the alpha channel first: #AARRGGBB.
+func androidColor(v string) string {
+	hex := expandHexColor(v)
+	if len(hex) == 8 {
+		return "#" + hex[6:8] + hex[0:6]
+	}
+	return "#" + hex
+}
+
+func exportSwift(w io.Writer, ts []*exportedToken, header string) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "// %s\n\nimport UIKit\n\npublic enum DesignTokens {\n", header)
+
+	for _, t := range ts {
+		v, ok := scalar(t.Value)
+		if !ok {
+			continue
+		}
+		if t.Description != "" {
+			fmt.Fprintf(&buf, "    /// %s\n", strings.Replace(t.Description, "\n", " ", -1))
+		}
+
+		switch {
+		case hexColorRegexp.MatchString(v):
+			r, g, b, a := rgba(v)
+			fmt.Fprintf(&buf, "    public static let %s = UIColor(red: %.3f, green: %.3f, blue: %.3f, alpha: %.3f)\n", t.Name, r, g, b, a)
+		case pxValueRegexp.MatchString(v):
+			fmt.Fprintf(&buf, "    public static let %s: CGFloat = %s\n", t.Name, pxValueRegexp.FindStringSubmatch(v)[1])
+		default:
+			if _, ok := t.Value.(float64); ok {
+				fmt.Fprintf(&buf, "    public static let %s: CGFloat = %s\n", t.Name, v)
+				continue
+			}
+			q, _ := json.Marshal(v)
+			fmt.Fprintf(&buf, "    public static let %s = %s\n", t.Name, q)
+		}
+	}
+	buf.WriteString("}\n")
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// expandHexColor returns the color as RRGGBB or RRGGBBAA, without
+// the leading "#".
+func expandHexColor(v string) string {
+	hex := strings.ToLower(strings.TrimPrefix(v, "#"))
+
+	if len(hex) == 3 || len(hex) == 4 {
+		var b strings.Builder
+		for _, r := range hex {
+			b.WriteRune(r)
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return hex
+}
+
+// rgba returns the color channels of a hex color, each in the range
+// of 0 to 1.
+func rgba(v string) (float64, float64, float64, float64) {
+	hex := expandHexColor(v)
+
+	channel := func(i int) float64 {
+		c, _ := strconv.ParseUint(hex[i:i+2], 16, 8)
+		return float64(c) / 255
+	}
+	if len(hex) == 8 {
+		return channel(0), channel(2), channel(4), channel(6)
+	}
+	return channel(0), channel(2), channel(4), 1
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tokens
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/config"
+)
+
+func TestTransformName(t *testing.T) {
+	expected := map[string][]string{
+		"color.brand.primary": {"color-brand-primary", "colorBrandPrimary", "color_brand_primary"},
+		"space.2xl":           {"space-2xl", "space2xl", "space_2xl"},
+		"font.bodyLarge":      {"font-body-large", "fontBodyLarge", "font_body_large"},
+		".ds.size":            {"ds-size", "dsSize", "ds_size"},
+	}
+	for name, e := range expected {
+		for i, style := range []string{"kebab", "camel", "snake"} {
+			r := transformName(name, style)
+			if r != e[i] {
+				t.Errorf("\nexpected: %s, result: %s", e[i], r)
+			}
+		}
+	}
+}
+
+func TestExportConvertsUnits(t *testing.T) {
+	ts := []*Token{
+		{Name: "size.base", Value: "24px"},
+		{Name: "color.primary", Value: "#0055ff"},
+	}
+	c := &config.TokensConfig{
+		RemBase: 16,
+		Formats: map[string]*config.TokensFormatConfig{
+			"css": {Unit: "rem"},
+		},
+	}
+
+	_, css := ExportFormatByName("css")
+	var buf bytes.Buffer
+	css.Export(&buf, ts, c, "1.2.0")
+
+	if !strings.Contains(buf.String(), "--size-base: 1.5rem;") {
+		t.Errorf("failed to convert px to rem, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "version 1.2.0") {
+		t.Errorf("failed to include version, got: %s", buf.String())
+	}
+
+	_, android := ExportFormatByName("android")
+	buf.Reset()
+	android.Export(&buf, ts, c, "1.2.0")
+
+	if !strings.Contains(buf.String(), `<dimen name="size_base">24dp</dimen>`) {
+		t.Errorf("failed to convert px to dp, got: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `<color name="color_primary">#0055ff</color>`) {
+		t.Errorf("failed to export color, got: %s", buf.String())
+	}
+}
+
+func TestExportQualifiesCollidingNames(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "tree")
+	buttons := newTestNode(filepath.Join(root, "Buttons"), root)
+	inputs := newTestNode(filepath.Join(root, "Inputs"), root)
+
+	ts := []*Token{
+		{Name: "color.primary", Value: "#0055ff", Node: buttons},
+		{Name: "color.primary", Value: "#00cc55", Node: inputs},
+		{Name: "default", Value: "16px", Node: buttons},
+	}
+
+	for _, name := range []string{"js", "ts", "swift"} {
+		_, f := ExportFormatByName(name)
+		var buf bytes.Buffer
+		if err := f.Export(&buf, ts, nil, "1.2.0"); err != nil {
+			t.Fatalf("failed to export %s: %s", name, err)
+		}
+		for _, id := range []string{"buttonsColorPrimary", "inputsColorPrimary", "_default"} {
+			if !strings.Contains(buf.String(), " "+id+" ") && !strings.Contains(buf.String(), " "+id+":") {
+				t.Errorf("expected %s in %s export, got: %s", id, name, buf.String())
+			}
+		}
+	}
+
+	// Both names are transformed into the same identifier.
+	ts = []*Token{
+		{Name: "color.primary", Value: "#0055ff", Node: buttons},
+		{Name: "colorPrimary", Value: "#00cc55", Node: buttons},
+	}
+	_, js := ExportFormatByName("js")
+	var buf bytes.Buffer
+	if err := js.Export(&buf, ts, nil, "1.2.0"); err == nil {
+		t.Errorf("expected colliding names to fail, got: %s", buf.String())
+	}
+}
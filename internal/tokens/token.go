@@ -0,0 +1,397 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tokens
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rundsk/dsk/internal/ddt"
+)
+
+var (
+	// FileRegexp matches basenames of node assets, that are considered
+	// to contain design token definitions, i.e. tokens.json,
+	// colors.tokens.yml or spacing-tokens.yaml.
+	FileRegexp = regexp.MustCompile(`(?i)^(.*[._-])?tokens\.(json|ya?ml)$`)
+
+	// AliasRegexp matches references to other tokens in token
+	// values, i.e. {color.brand.primary}.
+	AliasRegexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+	// Keys that are allowed inside an object using the simple form
+	// to define a token, i.e. {value: 16px, type: dimension}.
+	simpleTokenKeys = map[string]bool{
+		"value":       true,
+		"type":        true,
+		"description": true,
+		"comment":     true,
+	}
+)
+
+// Token is a single design token, i.e. a color or a spacing value.
+type Token struct {
+	// Name is the dot separated path of the token inside its file,
+	// i.e. color.brand.primary.
+	Name string
+
+	// Type of the token, i.e. color or dimension. Inherited from the
+	// enclosing group or from an aliased token, if not given.
+	Type string
+
+	// Value is the resolved value of the token, with all references
+	// to other tokens replaced by their values.
+	Value interface{}
+
+	// RawValue is the value as defined in the file.
+	RawValue interface{}
+
+	Description string
+
+	// Node, the token was defined in.
+	Node *ddt.Node
+
+	// Asset, the token was defined in.
+	Asset *ddt.NodeAsset
+
+	// Error is set when the token's value could not be resolved.
+	Error error
+}
+
+// IsAlias returns true, when the token's raw value is entirely made
+// up of a reference to another token.
+func (t *Token) IsAlias() bool {
+	_, ok := aliasOf(t.RawValue)
+	return ok
+}
+
+// Alias returns the name of the token that is referenced by the raw
+// value, if the token is an alias.
+func (t *Token) Alias() string {
+	name, _ := aliasOf(t.RawValue)
+	return name
+}
+
+// TextValue returns the resolved value as a string, composite values
+// are encoded as JSON.
+func (t *Token) TextValue() string {
+	switch v := t.Value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// TokenLookup retrieves a token by its name, as referenced by the
+// given token. When the token cannot be found ok will be false.
+type TokenLookup func(from *Token, name string) (ok bool, t *Token)
+
+// FromNode finds all token files of the given node and returns the
+// tokens defined therein. References are resolved only against the
+// tokens of the node itself.
+func FromNode(n *ddt.Node) ([]*Token, error) {
+	ts, err := parseNode(n)
+	if err != nil {
+		return ts, err
+	}
+	local := indexByName(ts)
+
+	resolve(ts, func(from *Token, name string) (bool, *Token) {
+		t, ok := local[name]
+		return ok, t
+	})
+	return ts, nil
+}
+
+// parseNode finds all token files of the given node and returns the
+// unresolved tokens, sorted by name. Malformed token files are
+// skipped.
+func parseNode(n *ddt.Node) ([]*Token, error) {
+	ts := make([]*Token, 0)
+
+	as, err := n.Assets()
+	if err != nil {
+		return ts, err
+	}
+	for _, a := range as {
+		if !FileRegexp.MatchString(a.Name()) {
+			continue
+		}
+		ats, err := parseAsset(n, a)
+		if err != nil {
+			// A single malformed file should not prevent us from
+			// providing the other tokens of the node.
+			log.Printf("Skipping tokens in %s: %s", a.URL, err)
+			continue
+		}
+		ts = append(ts, ats...)
+	}
+	sort.SliceStable(ts, func(i, j int) bool {
+		return ts[i].Name < ts[j].Name
+	})
+	return ts, nil
+}
+
+// parseAsset reads tokens from the given asset. We support the W3C
+// Design Tokens format, where tokens are objects with a "$value" key
+// and groups may provide a "$type" for all contained tokens:
+//
+//   color:
+//     $type: color
+//     primary:
+//       $value: "#0055ff"
+//       $description: Used for primary actions.
+//
+// As well as a simple nested form, where leaves are the token values,
+// or objects with "value", "type" and "description" keys:
+//
+//   color:
+//     primary: "#0055ff"
+//     secondary:
+//       value: "{color.primary}"
+//       description: Used for secondary actions.
+func parseAsset(n *ddt.Node, a *ddt.NodeAsset) ([]*Token, error) {
+	var data interface{}
+
+	// Let the asset do the heavy lifting of handling the different
+	// formats, we just have to deal with JSON.
+	_, r, err := a.As(".json")
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &data); err != nil {
+		return nil, err
+	}
+
+	ts := make([]*Token, 0)
+
+	var walk func(path []string, v interface{}, groupType string)
+	walk = func(path []string, v interface{}, groupType string) {
+		t := &Token{
+			Name:  strings.Join(path, "."),
+			Type:  groupType,
+			Node:  n,
+			Asset: a,
+		}
+
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			if len(path) == 0 {
+				return // A file containing just a scalar.
+			}
+			t.RawValue = v
+			ts = append(ts, t)
+			return
+		}
+
+		if value, ok := m["$value"]; ok {
+			t.RawValue = value
+			if typ, ok := m["$type"].(string); ok {
+				t.Type = typ
+			}
+			if desc, ok := m["$description"].(string); ok {
+				t.Description = desc
+			}
+			ts = append(ts, t)
+			return
+		}
+		if value, ok := m["value"]; ok && isSimpleToken(m) {
+			t.RawValue = value
+			if typ, ok := m["type"].(string); ok {
+				t.Type = typ
+			}
+			if desc, ok := m["description"].(string); ok {
+				t.Description = desc
+			} else if desc, ok := m["comment"].(string); ok {
+				t.Description = desc
+			}
+			ts = append(ts, t)
+			return
+		}
+
+		// We have found a group.
+		if typ, ok := m["$type"].(string); ok {
+			groupType = typ
+		}
+		for k, child := range m {
+			if strings.HasPrefix(k, "$") {
+				continue
+			}
+			walk(append(append([]string(nil), path...), k), child, groupType)
+		}
+	}
+	walk([]string{}, data, "")
+
+	return ts, nil
+}
+
+func isSimpleToken(m map[string]interface{}) bool {
+	for k := range m {
+		if !simpleTokenKeys[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexByName maps token names to tokens, the first token with a name
+// wins.
+func indexByName(ts []*Token) map[string]*Token {
+	index := make(map[string]*Token, len(ts))
+	for _, t := range ts {
+		if _, ok := index[t.Name]; !ok {
+			index[t.Name] = t
+		}
+	}
+	return index
+}
+
+// resolve replaces all references in the raw values of given tokens,
+// and sets the resolved value. References are looked up using the
+// given lookup function.
+func resolve(ts []*Token, lookup TokenLookup) {
+	resolving := make(map[*Token]bool)
+	resolved := make(map[*Token]bool)
+
+	var resolveToken func(t *Token) error
+	var resolveValue func(from *Token, v interface{}) (interface{}, string, error)
+
+	resolveToken = func(t *Token) error {
+		if resolved[t] {
+			return t.Error
+		}
+		if resolving[t] {
+			return fmt.Errorf("circular reference in %s", t.Name)
+		}
+		resolving[t] = true
+
+		v, typ, err := resolveValue(t, t.RawValue)
+		if err != nil {
+			t.Error = err
+			t.Value = t.RawValue
+		} else {
+			t.Value = v
+		}
+		if t.Type == "" {
+			t.Type = typ
+		}
+		if t.Type == "" {
+			t.Type = inferType(t.Value)
+		}
+
+		resolving[t] = false
+		resolved[t] = true
+		return t.Error
+	}
+
+	resolveValue = func(from *Token, v interface{}) (interface{}, string, error) {
+		switch tv := v.(type) {
+		case string:
+			if name, ok := aliasOf(tv); ok {
+				ok, ref := lookup(from, name)
+				if !ok {
+					return nil, "", fmt.Errorf("unresolved reference to %s", name)
+				}
+				if err := resolveToken(ref); err != nil {
+					return nil, "", err
+				}
+				return ref.Value, ref.Type, nil
+			}
+
+			var rerr error
+			r := AliasRegexp.ReplaceAllStringFunc(tv, func(m string) string {
+				name := m[1 : len(m)-1]
+
+				ok, ref := lookup(from, name)
+				if !ok {
+					rerr = fmt.Errorf("unresolved reference to %s", name)
+					return m
+				}
+				if err := resolveToken(ref); err != nil {
+					rerr = err
+					return m
+				}
+				return ref.TextValue()
+			})
+			return r, "", rerr
+		case map[string]interface{}:
+			r := make(map[string]interface{}, len(tv))
+			for k, cv := range tv {
+				rv, _, err := resolveValue(from, cv)
+				if err != nil {
+					return nil, "", err
+				}
+				r[k] = rv
+			}
+			return r, "", nil
+		case []interface{}:
+			r := make([]interface{}, 0, len(tv))
+			for _, cv := range tv {
+				rv, _, err := resolveValue(from, cv)
+				if err != nil {
+					return nil, "", err
+				}
+				r = append(r, rv)
+			}
+			return r, "", nil
+		default:
+			return v, "", nil
+		}
+	}
+
+	for _, t := range ts {
+		resolveToken(t)
+	}
+}
+
+func aliasOf(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return "", false
+	}
+	s = strings.TrimSpace(s)
+
+	m := AliasRegexp.FindStringSubmatchIndex(s)
+	if m == nil || m[0] != 0 || m[1] != len(s) {
+		return "", false
+	}
+	return s[m[2]:m[3]], true
+}
+
+var (
+	colorValueRegexp     = regexp.MustCompile(`(?i)^(#[0-9a-f]{3,8}|(rgb|hsl)a?\(.*\))$`)
+	dimensionValueRegexp = regexp.MustCompile(`^-?[0-9.]+(px|rem|em|pt|dp|sp|%)$`)
+)
+
+// inferType guesses the type of a token from its value, when it has
+// not been given explicitly.
+func inferType(v interface{}) string {
+	switch tv := v.(type) {
+	case float64, int:
+		return "number"
+	case string:
+		if colorValueRegexp.MatchString(tv) {
+			return "color"
+		}
+		if dimensionValueRegexp.MatchString(tv) {
+			return "dimension"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+// Copyright 2020 Marius Wilms, Christoph Labacher. All rights reserved.
+//
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tokens
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rundsk/dsk/internal/author"
+	"github.com/rundsk/dsk/internal/bus"
+	"github.com/rundsk/dsk/internal/config"
+	"github.com/rundsk/dsk/internal/ddt"
+	"github.com/rundsk/dsk/internal/meta"
+)
+
+func TestParseW3CFormat(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	n := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n.Create()
+	ioutil.WriteFile(filepath.Join(n.Path, "tokens.json"), []byte(`{
+  "color": {
+    "$type": "color",
+    "brand": {
+      "primary": { "$value": "#0055ff", "$description": "Primary actions." },
+      "accent": { "$value": "{color.brand.primary}" }
+    }
+  },
+  "size": {
+    "base": { "$value": "16px", "$type": "dimension" }
+  }
+}`), 0666)
+
+	ts, err := FromNode(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectToken(t, ts, "color.brand.primary", "color", "#0055ff")
+	expectToken(t, ts, "color.brand.accent", "color", "#0055ff")
+	expectToken(t, ts, "size.base", "dimension", "16px")
+
+	for _, tk := range ts {
+		if tk.Name == "color.brand.primary" && tk.Description != "Primary actions." {
+			t.Errorf("failed to parse description, got: %s", tk.Description)
+		}
+		if tk.Name == "color.brand.accent" && tk.Alias() != "color.brand.primary" {
+			t.Errorf("failed to detect alias, got: %s", tk.Alias())
+		}
+	}
+}
+
+func TestParseSimpleYAMLForm(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	n := newTestNode(filepath.Join(tmp, "Spacing"), tmp)
+	n.Create()
+	ioutil.WriteFile(filepath.Join(n.Path, "tokens.yml"), []byte(`
+space:
+  base: 8px
+  large:
+    value: "calc({space.base} * 2)"
+    description: Between sections.
+  ratio: 1.5
+`), 0666)
+
+	ts, err := FromNode(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectToken(t, ts, "space.base", "dimension", "8px")
+	expectToken(t, ts, "space.large", "", "calc(8px * 2)")
+	expectToken(t, ts, "space.ratio", "number", "1.5")
+}
+
+func TestResolveDetectsCircularReferences(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	n := newTestNode(filepath.Join(tmp, "Broken"), tmp)
+	n.Create()
+	ioutil.WriteFile(filepath.Join(n.Path, "tokens.yml"), []byte(`
+a: "{b}"
+b: "{a}"
+c: "{missing}"
+`), 0666)
+
+	ts, err := FromNode(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tk := range ts {
+		if tk.Error == nil {
+			t.Errorf("expected error for token %s", tk.Name)
+		}
+	}
+}
+
+func TestDBResolvesAcrossNodes(t *testing.T) {
+	tmp, _ := ioutil.TempDir("", "tree")
+	defer os.RemoveAll(tmp)
+
+	n0 := newTestNode(filepath.Join(tmp, "Colors"), tmp)
+	n0.Create()
+	ioutil.WriteFile(filepath.Join(n0.Path, "tokens.yml"), []byte("palette:\n  blue: \"#0055ff\"\n"), 0666)
+
+	n1 := newTestNode(filepath.Join(tmp, "Button"), tmp)
+	n1.Create()
+	ioutil.WriteFile(filepath.Join(n1.Path, "button.tokens.json"), []byte(`{"button": {"background": {"$value": "{palette.blue}"}}}`), 0666)
+
+	b, _ := bus.NewBroker()
+	defer b.Close()
+
+	tree, err := ddt.NewTree(tmp, config.NewStaticDB("example"), author.NewNoopDB(), meta.NewNoopDB(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := NewDB(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.All()) != 2 {
+		t.Errorf("expected 2 tokens, got: %d", len(db.All()))
+	}
+	expectToken(t, db.ForNode("Button"), "button.background", "color", "#0055ff")
+
+	ok, tk := db.Get("palette.blue")
+	if !ok || tk.Node.URL() != "Colors" {
+		t.Errorf("failed to get token by name")
+	}
+}
+
+func newTestNode(path string, root string) *ddt.Node {
+	return ddt.NewNode(path, root, config.NewStaticDB("example"), meta.NewNoopDB(), author.NewNoopDB())
+}
+
+func expectToken(t *testing.T, ts []*Token, name string, typ string, value string) {
+	t.Helper()
+
+	for _, tk := range ts {
+		if tk.Name != name {
+			continue
+		}
+		if tk.Error != nil {
+			t.Errorf("token %s failed to resolve: %s", name, tk.Error)
+		}
+		if tk.Type != typ {
+			t.Errorf("expected token %s to have type '%s', got: '%s'", name, typ, tk.Type)
+		}
+		if tk.TextValue() != value {
+			t.Errorf("expected token %s to have value '%s', got: '%s'", name, value, tk.TextValue())
+		}
+		return
+	}
+	t.Errorf("expected token %s, but not found", name)
+}